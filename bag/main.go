@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 
 	rbag "github.com/boxesandglue/cli/risor/backend/bag"
 	rfont "github.com/boxesandglue/cli/risor/backend/font"
 	rnode "github.com/boxesandglue/cli/risor/backend/node"
 	rbaseline "github.com/boxesandglue/cli/risor/baseline-pdf"
 	rfrontend "github.com/boxesandglue/cli/risor/frontend"
+	rbarcode "github.com/boxesandglue/cli/risor/frontend/barcode"
+	rpdfdraw "github.com/boxesandglue/cli/risor/frontend/pdfdraw"
 	"github.com/speedata/optionparser"
 	rcxpath "github.com/speedata/risorcxpath"
 
@@ -22,11 +26,13 @@ var Version string
 func dothings() error {
 	defaults := map[string]string{
 		"loglevel": "info",
+		"runs":     "1",
 	}
 	op := optionparser.NewOptionParser()
 	op.Banner = "bag - a frontend for boxes and glue"
 	op.Coda = "\nUsage: bag [options] <filename>"
 	op.On("--loglevel LVL", "Set the log level (debug, info, warn, error)", defaults)
+	op.On("--runs N", "Run the script up to N times until the page references are stable", defaults)
 	op.Command("help", "Show the help message")
 	op.Command("version", "Print version and exit")
 	if err := op.Parse(); err != nil {
@@ -63,20 +69,39 @@ func dothings() error {
 		return err
 	}
 
-	_, err = risor.Eval(ctx,
-		string(data),
-		risor.WithLocalImporter(wd),
-		risor.WithConcurrency(),
-		risor.WithGlobals(map[string]any{
-			"frontend":    rfrontend.Module(),
-			"bag":         rbag.Module(),
-			"node":        rnode.Module(),
-			"font":        rfont.Module(),
-			"cxpath":      rcxpath.Module(),
-			"baselinepdf": rbaseline.Module(),
-		}))
-	if err != nil {
-		return err
+	runs, err := strconv.Atoi(defaults["runs"])
+	if err != nil || runs < 1 {
+		return fmt.Errorf("--runs expects a positive number, got %q", defaults["runs"])
+	}
+
+	for run := 1; run <= runs; run++ {
+		if runs > 1 {
+			slog.Info("Start run", "run", run)
+		}
+		fr := &rfrontend.Run{}
+		_, err = risor.Eval(ctx,
+			string(data),
+			risor.WithLocalImporter(wd),
+			risor.WithConcurrency(),
+			risor.WithGlobals(map[string]any{
+				"frontend":    fr.Module(),
+				"draw":        rpdfdraw.Module(),
+				"bag":         rbag.Module(),
+				"node":        rnode.Module(),
+				"font":        rfont.Module(),
+				"cxpath":      rcxpath.Module(),
+				"baselinepdf": rbaseline.Module(),
+				"barcode":     rbarcode.Module(),
+			}))
+		if err != nil {
+			return err
+		}
+		if !fr.NeedsRerun() {
+			break
+		}
+		if run == runs {
+			slog.Warn("Page references might be wrong, increase the number of runs")
+		}
 	}
 
 	return nil
@@ -7,6 +7,9 @@ require (
 	github.com/risor-io/risor v1.8.1
 	github.com/speedata/optionparser v1.0.5
 	github.com/speedata/risorcxpath v0.0.1
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/image v0.27.0
+	golang.org/x/net v0.40.0
 )
 
 require (
@@ -17,8 +20,6 @@ require (
 	github.com/speedata/goxml v1.0.4 // indirect
 	github.com/speedata/goxpath v1.0.3 // indirect
 	github.com/speedata/hyphenation v1.0.1 // indirect
-	golang.org/x/image v0.27.0 // indirect
-	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 )
 
@@ -8,8 +8,23 @@ import (
 
 const BackendColorType = "backend.color"
 
+// RColor is a color. The components can be read as attributes (r, g, b, a, c,
+// m, y, k and gray), space is one of rgb, cmyk, gray, spot or none. Spot colors
+// have a name, a tint and an alternate color.
 type RColor struct {
 	Value *color.Color
+	// Tint is the tint of a spot color, 0 means full tint.
+	Tint float64
+	// Alternate is the color of a spot color in a process color space.
+	Alternate *color.Color
+}
+
+var spaceNames = map[color.Space]string{
+	color.ColorNone:      "none",
+	color.ColorRGB:       "rgb",
+	color.ColorCMYK:      "cmyk",
+	color.ColorGray:      "gray",
+	color.ColorSpotcolor: "spot",
 }
 
 // Type of the object.
@@ -19,6 +34,9 @@ func (col *RColor) Type() object.Type {
 
 // Inspect returns a string representation of the given object.
 func (col *RColor) Inspect() string {
+	if col.Value == nil {
+		return "<no color>"
+	}
 	return col.Value.String()
 }
 
@@ -34,6 +52,53 @@ func (col *RColor) Equals(other object.Object) object.Object {
 
 // GetAttr returns the attribute with the given name from this object.
 func (col *RColor) GetAttr(name string) (object.Object, bool) {
+	c := col.Value
+	if c == nil {
+		return nil, false
+	}
+	switch name {
+	case "space":
+		return object.NewString(spaceNames[c.Space]), true
+	case "r":
+		return object.NewFloat(c.R), true
+	case "g":
+		return object.NewFloat(c.G), true
+	case "b":
+		return object.NewFloat(c.B), true
+	case "a":
+		return object.NewFloat(c.A), true
+	case "c":
+		return object.NewFloat(c.C), true
+	case "m":
+		return object.NewFloat(c.M), true
+	case "y":
+		return object.NewFloat(c.Y), true
+	case "k":
+		return object.NewFloat(c.K), true
+	case "gray":
+		if c.Space != color.ColorGray {
+			return object.Nil, true
+		}
+		return object.NewFloat(c.G), true
+	case "name":
+		if c.Space != color.ColorSpotcolor {
+			return object.Nil, true
+		}
+		return object.NewString(c.Basecolor), true
+	case "tint":
+		if c.Space != color.ColorSpotcolor {
+			return object.Nil, true
+		}
+		if col.Tint == 0 {
+			return object.NewFloat(1), true
+		}
+		return object.NewFloat(col.Tint), true
+	case "alternate":
+		if col.Alternate == nil {
+			return object.Nil, true
+		}
+		return &RColor{Value: col.Alternate}, true
+	}
 	return nil, false
 }
 
@@ -12,6 +12,7 @@ import (
 	rlang "github.com/boxesandglue/cli/risor/backend/lang"
 	rnode "github.com/boxesandglue/cli/risor/backend/node"
 	rpdf "github.com/boxesandglue/cli/risor/baseline-pdf"
+	"github.com/boxesandglue/cli/risor/svg"
 
 	"github.com/risor-io/risor/object"
 	"github.com/risor-io/risor/op"
@@ -21,11 +22,20 @@ import (
 type Document struct {
 	PDFDoc      *document.PDFDocument
 	Attachments *object.List
+	// BeforeFinish is called by finish before the PDF file is written.
+	BeforeFinish func(ctx context.Context) error
+	// SVGFonts provides the fonts for the text in SVG images. Without it the
+	// text is not drawn.
+	SVGFonts svg.Fonts
 }
 
+// createImageNodeFromImagefile implements
+// create_image_node_from_imagefile(imagefile, page, box[, options]). The
+// options width, height, fit, clip and rotate scale the image into a target
+// area, min_dpi warns about raster images with a low resolution.
 func (doc *Document) createImageNodeFromImagefile(ctx context.Context, args ...object.Object) object.Object {
-	if len(args) != 3 {
-		return object.ArgsErrorf("document.create_image_node_from_imagefile() takes exactly three arguments")
+	if len(args) < 3 || len(args) > 4 {
+		return object.ArgsErrorf("document.create_image_node_from_imagefile() takes three or four arguments")
 	}
 	firstArg := args[0]
 	secondArg := args[1]
@@ -40,9 +50,29 @@ func (doc *Document) createImageNodeFromImagefile(ctx context.Context, args ...o
 	if thirdArg.Type() != object.STRING {
 		return object.ArgsErrorf("document.create_image_node_from_imagefile() expects a string argument (PDF box)")
 	}
-	imgNode := doc.PDFDoc.CreateImageNodeFromImagefile(firstArg.(*rpdf.ImageFile).Value, int(secondArg.(*object.Int).Value()), thirdArg.(*object.String).Value())
-	newnode := &rnode.Node{Value: imgNode}
-	return newnode
+	var opts *imageOptions
+	if len(args) == 4 {
+		m, errObj := object.AsMap(args[3])
+		if errObj != nil {
+			return errObj
+		}
+		if opts, errObj = parseImageOptions(m); errObj != nil {
+			return errObj
+		}
+	}
+	imgf := firstArg.(*rpdf.ImageFile).Value
+	imgNode := doc.PDFDoc.CreateImageNodeFromImagefile(imgf, int(secondArg.(*object.Int).Value()), thirdArg.(*object.String).Value())
+	if imgNode == nil {
+		return object.Errorf("document.create_image_node_from_imagefile(): cannot get the size of %s", imgf.Filename)
+	}
+	if opts == nil {
+		return &rnode.Node{Value: imgNode}
+	}
+	n := fitImage(imgNode, opts)
+	if dpi, ok := rnode.ImageDPI(imgNode); ok && dpi < opts.minDPI {
+		bag.Logger.Warn("Image resolution too low", "filename", imgf.Filename, "dpi", int(dpi), "min_dpi", opts.minDPI)
+	}
+	return &rnode.Node{Value: n}
 }
 
 func (doc *Document) newPage(ctx context.Context, args ...object.Object) object.Object {
@@ -96,6 +126,11 @@ func (doc *Document) finish(ctx context.Context, args ...object.Object) object.O
 	}
 
 	doc.PDFDoc.Attachments = attachments
+	if doc.BeforeFinish != nil {
+		if err := doc.BeforeFinish(ctx); err != nil {
+			return object.NewError(err)
+		}
+	}
 	doc.PDFDoc.Finish()
 	return nil
 }
@@ -123,6 +158,13 @@ func (doc *Document) loadImageFile(ctx context.Context, args ...object.Object) o
 		return object.ArgsErrorf("document.load_image_file() expects a string argument (filename)")
 	}
 	filename := args[0].(*object.String).Value()
+	if svg.IsSVG(filename) {
+		pdfFilename, err := svg.ToPDF(filename, doc.SVGFonts)
+		if err != nil {
+			return object.NewError(err)
+		}
+		filename = pdfFilename
+	}
 	imgf, err := doc.PDFDoc.LoadImageFile(filename)
 	if err != nil {
 		return object.NewError(err)
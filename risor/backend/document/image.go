@@ -0,0 +1,194 @@
+package document
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// imageOptions are the options of create_image_node_from_imagefile.
+type imageOptions struct {
+	width, height bag.ScaledPoint
+	// contain, cover or stretch
+	fit  string
+	clip bool
+	// counterclockwise in degrees, a multiple of 90
+	rotate int
+	// warn if the resolution of a raster image is lower
+	minDPI float64
+}
+
+// toSP converts a length option.
+func toSP(obj object.Object) (bag.ScaledPoint, error) {
+	switch t := obj.(type) {
+	case *rbag.RSP:
+		return t.Value, nil
+	case *object.String:
+		return bag.SP(t.Value())
+	}
+	return 0, fmt.Errorf("expected a bag.scaledpoint or a string with a unit, got %s", obj.Type())
+}
+
+func parseImageOptions(m *object.Map) (*imageOptions, *object.Error) {
+	const fn = "document.create_image_node_from_imagefile()"
+	opts := &imageOptions{fit: "contain"}
+	clipSet := false
+	for k, v := range m.Value() {
+		switch k {
+		case "width", "height":
+			sp, err := toSP(v)
+			if err != nil {
+				return nil, object.ArgsErrorf("%s: %s: %s", fn, k, err)
+			}
+			if sp <= 0 {
+				return nil, object.ArgsErrorf("%s: %s must be positive", fn, k)
+			}
+			if k == "width" {
+				opts.width = sp
+			} else {
+				opts.height = sp
+			}
+		case "fit":
+			s, errObj := object.AsString(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			switch s {
+			case "contain", "cover", "stretch":
+				opts.fit = s
+			default:
+				return nil, object.ArgsErrorf("%s: fit must be contain, cover or stretch, got %s", fn, s)
+			}
+		case "clip":
+			b, ok := v.(*object.Bool)
+			if !ok {
+				return nil, object.ArgsErrorf("%s: clip expects a bool, got %s", fn, v.Type())
+			}
+			opts.clip = b.Value()
+			clipSet = true
+		case "rotate":
+			i, errObj := object.AsInt(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			if i%90 != 0 {
+				return nil, object.ArgsErrorf("%s: rotate must be a multiple of 90, got %d", fn, i)
+			}
+			opts.rotate = int((i%360 + 360) % 360)
+		case "min_dpi":
+			switch t := v.(type) {
+			case *object.Int:
+				opts.minDPI = float64(t.Value())
+			case *object.Float:
+				opts.minDPI = t.Value()
+			default:
+				return nil, object.ArgsErrorf("%s: min_dpi expects a number, got %s", fn, v.Type())
+			}
+		default:
+			return nil, object.ArgsErrorf("%s: unknown option %s", fn, k)
+		}
+	}
+	if !clipSet {
+		// a covered slot is clipped unless requested otherwise
+		opts.clip = opts.fit == "cover"
+	}
+	return opts, nil
+}
+
+// fitImage scales and rotates the image node according to the options. The
+// image node is returned if it only needs to be resized, otherwise an hlist
+// with the size of the target area which contains the image.
+func fitImage(img *node.Image, opts *imageOptions) node.Node {
+	natWd, natHt := img.Width.ToPT(), img.Height.ToPT()
+	if opts.rotate == 90 || opts.rotate == 270 {
+		natWd, natHt = natHt, natWd
+	}
+	sx, sy := 1.0, 1.0
+	switch {
+	case opts.width > 0 && opts.height > 0:
+		sx, sy = opts.width.ToPT()/natWd, opts.height.ToPT()/natHt
+		switch opts.fit {
+		case "contain":
+			sx = min(sx, sy)
+			sy = sx
+		case "cover":
+			sx = max(sx, sy)
+			sy = sx
+		}
+	case opts.width > 0:
+		sx = opts.width.ToPT() / natWd
+		sy = sx
+	case opts.height > 0:
+		sx = opts.height.ToPT() / natHt
+		sy = sx
+	}
+	// the size of the rotated image and of the target area
+	fitWd, fitHt := bag.ScaledPointFromFloat(natWd*sx), bag.ScaledPointFromFloat(natHt*sy)
+	wd, ht := fitWd, fitHt
+	if opts.width > 0 {
+		wd = opts.width
+	}
+	if opts.height > 0 {
+		ht = opts.height
+	}
+	if opts.width > 0 && opts.height > 0 && opts.fit == "stretch" {
+		fitWd, fitHt = wd, ht
+	}
+	if opts.rotate == 90 || opts.rotate == 270 {
+		img.Width, img.Height = fitHt, fitWd
+	} else {
+		img.Width, img.Height = fitWd, fitHt
+	}
+	offsetX, offsetY := (wd-fitWd)/2, (ht-fitHt)/2
+	if opts.rotate == 0 && offsetX == 0 && offsetY == 0 {
+		return img
+	}
+
+	// The start rule moves the origin to the lower left corner of the image
+	// and rotates it, the stop rule restores the graphics state. Both must
+	// be at the same position, see the rule output in the backend.
+	var m string
+	switch opts.rotate {
+	case 0:
+		m = fmt.Sprintf("1 0 0 1 %s %s cm", offsetX, offsetY)
+	case 90:
+		m = fmt.Sprintf("0 1 -1 0 %s %s cm", img.Height+offsetX, offsetY)
+	case 180:
+		m = fmt.Sprintf("-1 0 0 -1 %s %s cm", img.Width+offsetX, img.Height+offsetY)
+	case 270:
+		m = fmt.Sprintf("0 -1 1 0 %s %s cm", offsetX, img.Width+offsetY)
+	}
+	clip := ""
+	if opts.clip {
+		clip = fmt.Sprintf("0 0 %s %s re W n ", wd, ht)
+	}
+	start := node.NewRule()
+	start.Hide = true
+	start.Pre = "q " + clip + m
+	stop := node.NewRule()
+	stop.Hide = true
+	stop.Pre = "Q"
+	back := node.NewKern()
+	back.Kern = -img.Width
+	advance := node.NewKern()
+	advance.Kern = wd
+
+	var head node.Node = start
+	node.InsertAfter(head, start, img)
+	node.InsertAfter(head, img, back)
+	node.InsertAfter(head, back, stop)
+	node.InsertAfter(head, stop, advance)
+	hl := node.Hpack(head)
+	hl.Width = wd
+	hl.Height = ht
+	hl.Depth = 0
+	hl.Attributes = node.H{"origin": "image"}
+	if dpi, ok := rnode.ImageDPI(img); ok {
+		hl.Attributes["dpi"] = dpi
+	}
+	return hl
+}
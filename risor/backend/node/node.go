@@ -2,9 +2,11 @@ package node
 
 import (
 	"context"
+	"strings"
 
 	"github.com/boxesandglue/boxesandglue/backend/node"
 	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
 	rlang "github.com/boxesandglue/cli/risor/backend/lang"
 	pdf "github.com/boxesandglue/cli/risor/baseline-pdf"
 	"github.com/risor-io/risor/object"
@@ -228,9 +230,37 @@ func (n *Node) Equals(other object.Object) object.Object {
 	return object.False
 }
 
+// ImageDPI returns the resolution of a raster image at the size of the image
+// node. If the image is scaled unevenly, the lower resolution is returned. ok
+// is false for PDF images.
+func ImageDPI(img *node.Image) (dpi float64, ok bool) {
+	imgf := img.ImageFile
+	if imgf == nil || imgf.Format == "pdf" || imgf.W == 0 || imgf.H == 0 || img.Width <= 0 || img.Height <= 0 {
+		return 0, false
+	}
+	// the width is in points, 72 per inch
+	dpiX := float64(imgf.W) * 72 / img.Width.ToPT()
+	dpiY := float64(imgf.H) * 72 / img.Height.ToPT()
+	return min(dpiX, dpiY), true
+}
+
 // GetAttr returns the attribute with the given name from this object.
 func (n *Node) GetAttr(name string) (object.Object, bool) {
 	switch name {
+	case "dpi":
+		switch t := n.Value.(type) {
+		case *node.Image:
+			if dpi, ok := ImageDPI(t); ok {
+				return object.NewFloat(dpi), true
+			}
+			return object.Nil, true
+		case *node.HList:
+			// set by create_image_node_from_imagefile
+			if dpi, ok := t.Attributes["dpi"].(float64); ok {
+				return object.NewFloat(dpi), true
+			}
+			return object.Nil, true
+		}
 	case "next":
 		if n.Value.Next() == nil {
 			return object.Nil, true
@@ -320,6 +350,20 @@ func (n *Node) SetAttr(name string, value object.Object) error {
 			t.Badness = int(val.Value())
 			return nil
 		}
+	case "color":
+		// The rule is filled with the color. Spot colors are printed with the
+		// tint of the color. The color is set around the PDF code the rule
+		// already has.
+		val, ok := value.(*rcolor.RColor)
+		if !ok || val.Value == nil {
+			return object.ArgsErrorf("node.color expects a backend.color value")
+		}
+		switch t := n.Value.(type) {
+		case *node.Rule:
+			t.Pre = strings.TrimSpace("q " + val.Value.PDFStringNonStroking() + " " + t.Pre)
+			t.Post = strings.TrimSpace(t.Post + " Q")
+			return nil
+		}
 	case "codepoint":
 		if value.Type() != object.INT {
 			return object.ArgsErrorf("node.codepoint() expects an int argument")
@@ -475,6 +519,10 @@ func (n *Node) SetAttr(name string, value object.Object) error {
 			t.List = val.Value
 			return nil
 		}
+	case "overprint":
+		// Overprint needs an ExtGState in the page resources, and the PDF
+		// writer builds these only from fonts, images and color spaces.
+		return object.ArgsErrorf("node.overprint is not implemented")
 	case "page_number":
 		if value.Type() != object.INT {
 			return object.ArgsErrorf("node.page_number expects an int value")
@@ -528,6 +576,9 @@ func (n *Node) SetAttr(name string, value object.Object) error {
 		case *node.Image:
 			t.Width = val.Value
 			return nil
+		case *node.Rule:
+			t.Width = val.Value
+			return nil
 		}
 
 	}
@@ -38,12 +38,19 @@ func (imgf *ImageFile) GetAttr(name string) (object.Object, bool) {
 	switch name {
 	case "close":
 		return object.NewBuiltin("pdf.imagefile.close", imgf.close), true
+	case "format":
+		return object.NewString(imgf.Value.Format), true
 	case "get_pdf_box_dimensions":
 		return object.NewBuiltin("pdf.imagefile.get_pdf_box_dimensions", imgf.getPDFBoxDimensions), true
 	case "internal_name":
 		return object.NewString(imgf.Value.InternalName()), true
 	case "page_number":
 		return object.NewInt(int64(imgf.Value.PageNumber)), true
+	case "pixel_height":
+		// 0 for PDF files
+		return object.NewInt(int64(imgf.Value.H)), true
+	case "pixel_width":
+		return object.NewInt(int64(imgf.Value.W)), true
 	}
 	return nil, false
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	rpdf "github.com/boxesandglue/baseline-pdf"
+	"github.com/boxesandglue/cli/risor/svg"
 	"github.com/risor-io/risor/object"
 	"github.com/risor-io/risor/op"
 )
@@ -186,6 +187,13 @@ func (pdf *PDF) pdfLoadImageFile(ctx context.Context, args ...object.Object) obj
 		}
 		pagenumber = int(args[2].(*object.Int).Value())
 	}
+	if svg.IsSVG(filename) {
+		pdfFilename, err := svg.ToPDF(filename, nil)
+		if err != nil {
+			return object.NewError(err)
+		}
+		filename = pdfFilename
+	}
 	imgfile, err := pdf.Value.LoadImageFileWithBox(filename, box, pagenumber)
 	if err != nil {
 		return object.NewError(err)
@@ -0,0 +1,393 @@
+// Package barcode creates QR codes, Data Matrix codes, Code 128 and EAN-13
+// barcodes and Swiss QR-bills as vector graphics. The barcodes are vlists
+// that contain the quiet zone and can be placed like any other box. The
+// linear barcodes have no human readable text.
+package barcode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// matrix is a two dimensional barcode, true is a dark module. The first row
+// is the top row.
+type matrix [][]bool
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make([]bool, cols)
+	}
+	return m
+}
+
+// symbol is a barcode as a set of dark rectangles. All values are in modules,
+// the origin is the lower left corner.
+type symbol struct {
+	width, height float64
+	rects         [][4]float64
+	// PDF code that is drawn after the rectangles, in module units
+	extra string
+}
+
+// num formats a number for the PDF code.
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10000)/10000+0, 'f', -1, 64)
+}
+
+// newMatrixSymbol returns the symbol of the matrix with the quiet zone around
+// it. Dark modules in a row are combined to one rectangle.
+func newMatrixSymbol(m matrix, quietZone int) *symbol {
+	rows, cols := len(m), len(m[0])
+	s := &symbol{width: float64(cols + 2*quietZone), height: float64(rows + 2*quietZone)}
+	for r, row := range m {
+		y := float64(rows - 1 - r + quietZone)
+		for c := 0; c < cols; {
+			if !row[c] {
+				c++
+				continue
+			}
+			start := c
+			for c < cols && row[c] {
+				c++
+			}
+			s.rects = append(s.rects, [4]float64{float64(start + quietZone), y, float64(c - start), 1})
+		}
+	}
+	return s
+}
+
+// newBarSymbol returns the symbol of a linear barcode. widths are the widths
+// of bars and spaces, starting with a bar.
+func newBarSymbol(widths []int, height float64, left, right int) *symbol {
+	s := &symbol{height: height}
+	x := left
+	for i, w := range widths {
+		if i%2 == 0 {
+			s.rects = append(s.rects, [4]float64{float64(x), 0, float64(w), height})
+		}
+		x += w
+	}
+	s.width = float64(x + right)
+	return s
+}
+
+// toNode returns a vlist with the symbol.
+func (s *symbol) toNode(module bag.ScaledPoint, col *color.Color) *node.VList {
+	wd := bag.ScaledPoint(math.Round(s.width * float64(module)))
+	ht := bag.ScaledPoint(math.Round(s.height * float64(module)))
+	var sb strings.Builder
+	// The rule starts at the top left corner of the box.
+	fmt.Fprintf(&sb, "q 1 0 0 1 0 %s cm ", -ht)
+	if col != nil {
+		sb.WriteString(col.PDFStringNonStroking())
+	} else {
+		sb.WriteString("0 g")
+	}
+	m := num(module.ToPT())
+	fmt.Fprintf(&sb, " %s 0 0 %s 0 0 cm", m, m)
+	for _, r := range s.rects {
+		fmt.Fprintf(&sb, " %s %s %s %s re", num(r[0]), num(r[1]), num(r[2]), num(r[3]))
+	}
+	if len(s.rects) > 0 {
+		sb.WriteString(" f")
+	}
+	if s.extra != "" {
+		sb.WriteString(" " + s.extra)
+	}
+	sb.WriteString(" Q")
+	r := node.NewRule()
+	r.Width = wd
+	r.Height = ht
+	r.Hide = true
+	r.Pre = sb.String()
+	r.Attributes = node.H{"origin": "barcode"}
+	vl := node.Vpack(r)
+	vl.Attributes = node.H{"origin": "barcode"}
+	return vl
+}
+
+// options are the options of the barcode functions. Lengths that are not set
+// are 0.
+type options struct {
+	// the width of a module or of the narrowest bar
+	module bag.ScaledPoint
+	// the width of a two dimensional symbol without the quiet zone
+	size bag.ScaledPoint
+	// the width and the height of the bars of a linear barcode
+	width, height bag.ScaledPoint
+	// in modules, -1 for the default
+	quietZone   int
+	level       string
+	rectangular bool
+	fnc1        bool
+	color       *color.Color
+}
+
+// toSP converts a length option.
+func toSP(obj object.Object) (bag.ScaledPoint, error) {
+	switch t := obj.(type) {
+	case *rbag.RSP:
+		return t.Value, nil
+	case *object.String:
+		return bag.SP(t.Value())
+	}
+	return 0, fmt.Errorf("expected a bag.scaledpoint or a string with a unit, got %s", obj.Type())
+}
+
+// parseOptions reads the options map of the function fn. allowed are the
+// option names the function accepts.
+func parseOptions(fn string, obj object.Object, allowed ...string) (*options, *object.Error) {
+	opts := &options{quietZone: -1}
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, errObj
+	}
+	for k, v := range m.Value() {
+		found := false
+		for _, a := range allowed {
+			if a == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, object.ArgsErrorf("%s(): unknown option %s", fn, k)
+		}
+		switch k {
+		case "module", "size", "width", "height":
+			sp, err := toSP(v)
+			if err != nil {
+				return nil, object.ArgsErrorf("%s(): %s: %s", fn, k, err)
+			}
+			if sp <= 0 {
+				return nil, object.ArgsErrorf("%s(): %s must be positive", fn, k)
+			}
+			switch k {
+			case "module":
+				opts.module = sp
+			case "size":
+				opts.size = sp
+			case "width":
+				opts.width = sp
+			case "height":
+				opts.height = sp
+			}
+		case "quiet_zone":
+			i, errObj := object.AsInt(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			if i < 0 {
+				return nil, object.ArgsErrorf("%s(): quiet_zone must not be negative", fn)
+			}
+			opts.quietZone = int(i)
+		case "level":
+			s, errObj := object.AsString(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			if _, ok := qrLevels[s]; !ok {
+				return nil, object.ArgsErrorf("%s(): level must be L, M, Q or H, got %s", fn, s)
+			}
+			opts.level = s
+		case "rectangular", "fnc1":
+			b, ok := v.(*object.Bool)
+			if !ok {
+				return nil, object.ArgsErrorf("%s(): %s expects a bool, got %s", fn, k, v.Type())
+			}
+			if k == "fnc1" {
+				opts.fnc1 = b.Value()
+			} else {
+				opts.rectangular = b.Value()
+			}
+		case "color":
+			col, ok := v.(*rcolor.RColor)
+			if !ok || col.Value == nil {
+				return nil, object.ArgsErrorf("%s(): color expects a backend.color (see frontend get_color and define_color)", fn)
+			}
+			opts.color = col.Value
+		}
+	}
+	return opts, nil
+}
+
+// textAndOptions reads the text argument and the optional options map.
+func textAndOptions(fn string, args []object.Object, allowed ...string) (string, *options, *object.Error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", nil, object.NewArgsRangeError(fn, 1, 2, len(args))
+	}
+	text, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return "", nil, errObj
+	}
+	opts := &options{quietZone: -1}
+	if len(args) == 2 {
+		if opts, errObj = parseOptions(fn, args[1], allowed...); errObj != nil {
+			return "", nil, errObj
+		}
+	}
+	return text, opts, nil
+}
+
+// matrixNode returns the node of a two dimensional code. The module size is
+// taken from the options size or module or the default module size.
+func matrixNode(m matrix, opts *options, defaultQuietZone int, defaultModule string) *rnode.Node {
+	qz := defaultQuietZone
+	if opts.quietZone >= 0 {
+		qz = opts.quietZone
+	}
+	module := opts.module
+	switch {
+	case opts.size > 0:
+		module = opts.size / bag.ScaledPoint(len(m[0]))
+	case module == 0:
+		module = bag.MustSP(defaultModule)
+	}
+	return &rnode.Node{Value: newMatrixSymbol(m, qz).toNode(module, opts.color)}
+}
+
+// barModule returns the module width of a linear barcode with the given
+// number of modules (without the quiet zone).
+func barModule(opts *options, modules int) bag.ScaledPoint {
+	switch {
+	case opts.width > 0:
+		return opts.width / bag.ScaledPoint(modules)
+	case opts.module > 0:
+		return opts.module
+	}
+	return bag.MustSP("0.33mm")
+}
+
+// qrcode implements barcode.qrcode(text[, {level, size, module, quiet_zone,
+// color}]). size is the width without the quiet zone, the quiet zone is
+// given in modules (default 4). The error correction level is L, M
+// (default), Q or H.
+func qrcode(ctx context.Context, args ...object.Object) object.Object {
+	text, opts, errObj := textAndOptions("barcode.qrcode", args, "level", "size", "module", "quiet_zone", "color")
+	if errObj != nil {
+		return errObj
+	}
+	lvl := qrLevelM
+	if opts.level != "" {
+		lvl = qrLevels[opts.level]
+	}
+	m, err := encodeQR(text, lvl)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return matrixNode(m, opts, 4, "0.5mm")
+}
+
+// datamatrix implements barcode.datamatrix(text[, {rectangular, size, module,
+// quiet_zone, color}]). The quiet zone defaults to one module.
+func datamatrix(ctx context.Context, args ...object.Object) object.Object {
+	text, opts, errObj := textAndOptions("barcode.datamatrix", args, "rectangular", "size", "module", "quiet_zone", "color")
+	if errObj != nil {
+		return errObj
+	}
+	m, err := encodeDataMatrix(text, opts.rectangular)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return matrixNode(m, opts, 1, "0.5mm")
+}
+
+// code128 implements barcode.code128(text[, {fnc1, width, module, height,
+// quiet_zone, color}]). width is the width of the bars without the quiet zone
+// (default ten modules on each side), the height defaults to 15mm.
+func code128(ctx context.Context, args ...object.Object) object.Object {
+	text, opts, errObj := textAndOptions("barcode.code128", args, "fnc1", "width", "module", "height", "quiet_zone", "color")
+	if errObj != nil {
+		return errObj
+	}
+	widths, err := encodeCode128(text, opts.fnc1)
+	if err != nil {
+		return object.NewError(err)
+	}
+	modules := 0
+	for _, w := range widths {
+		modules += w
+	}
+	module := barModule(opts, modules)
+	height := opts.height
+	if height == 0 {
+		height = bag.MustSP("15mm")
+	}
+	qz := 10
+	if opts.quietZone >= 0 {
+		qz = opts.quietZone
+	}
+	s := newBarSymbol(widths, float64(height)/float64(module), qz, qz)
+	return &rnode.Node{Value: s.toNode(module, opts.color)}
+}
+
+// ean13 implements barcode.ean13(digits[, {width, module, height, quiet_zone,
+// color}]). The check digit is added to twelve digits and verified for
+// thirteen digits. height is the height of the symbol including the guard
+// bars, which are five modules longer than the other bars. It defaults to
+// 22.85mm plus the guard extension, scaled with the module width. The quiet
+// zone is eleven modules on the left and seven on the right unless given.
+func ean13(ctx context.Context, args ...object.Object) object.Object {
+	text, opts, errObj := textAndOptions("barcode.ean13", args, "width", "module", "height", "quiet_zone", "color")
+	if errObj != nil {
+		return errObj
+	}
+	modules, guard, err := encodeEAN13(text)
+	if err != nil {
+		return object.NewError(err)
+	}
+	module := barModule(opts, len(modules))
+	// 22.85mm at the nominal module width of 0.33mm
+	height := 22.85 / 0.33
+	if opts.height > 0 {
+		height = float64(opts.height)/float64(module) - 5
+		if height <= 0 {
+			return object.ArgsErrorf("barcode.ean13(): the height must be larger than five modules")
+		}
+	}
+	left, right := 11, 7
+	if opts.quietZone >= 0 {
+		left, right = opts.quietZone, opts.quietZone
+	}
+	s := &symbol{width: float64(left + len(modules) + right), height: height + 5}
+	for i := 0; i < len(modules); {
+		if !modules[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(modules) && modules[i] && guard[i] == guard[start] {
+			i++
+		}
+		y, h := 5.0, height
+		if guard[start] {
+			y, h = 0, height+5
+		}
+		s.rects = append(s.rects, [4]float64{float64(left + start), y, float64(i - start), h})
+	}
+	return &rnode.Node{Value: s.toNode(module, opts.color)}
+}
+
+// Module returns the barcode module.
+func Module() *object.Module {
+	return object.NewBuiltinsModule("barcode", map[string]object.Object{
+		"code128":       object.NewBuiltin("barcode.code128", code128),
+		"datamatrix":    object.NewBuiltin("barcode.datamatrix", datamatrix),
+		"ean13":         object.NewBuiltin("barcode.ean13", ean13),
+		"qrcode":        object.NewBuiltin("barcode.qrcode", qrcode),
+		"swiss_qr":      object.NewBuiltin("barcode.swiss_qr", swissQR),
+		"swiss_qr_bill": object.NewBuiltin("barcode.swiss_qr_bill", swissQRBill),
+	})
+}
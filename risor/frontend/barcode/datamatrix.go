@@ -0,0 +1,266 @@
+package barcode
+
+import "fmt"
+
+// dmSize describes a Data Matrix ECC 200 symbol size.
+type dmSize struct {
+	rows, cols int
+	// the size of one data region and the number of regions
+	regionRows, regionCols int
+	regionsV, regionsH     int
+	data, ecc              int
+	blocks                 int
+}
+
+// dmSizes are the square symbols followed by the rectangular symbols, each
+// ordered by capacity.
+var dmSizes = []dmSize{
+	{10, 10, 8, 8, 1, 1, 3, 5, 1},
+	{12, 12, 10, 10, 1, 1, 5, 7, 1},
+	{14, 14, 12, 12, 1, 1, 8, 10, 1},
+	{16, 16, 14, 14, 1, 1, 12, 12, 1},
+	{18, 18, 16, 16, 1, 1, 18, 14, 1},
+	{20, 20, 18, 18, 1, 1, 22, 18, 1},
+	{22, 22, 20, 20, 1, 1, 30, 20, 1},
+	{24, 24, 22, 22, 1, 1, 36, 24, 1},
+	{26, 26, 24, 24, 1, 1, 44, 28, 1},
+	{32, 32, 14, 14, 2, 2, 62, 36, 1},
+	{36, 36, 16, 16, 2, 2, 86, 42, 1},
+	{40, 40, 18, 18, 2, 2, 114, 48, 1},
+	{44, 44, 20, 20, 2, 2, 144, 56, 1},
+	{48, 48, 22, 22, 2, 2, 174, 68, 1},
+	{52, 52, 24, 24, 2, 2, 204, 84, 2},
+	{64, 64, 14, 14, 4, 4, 280, 112, 2},
+	{72, 72, 16, 16, 4, 4, 368, 144, 4},
+	{80, 80, 18, 18, 4, 4, 456, 192, 4},
+	{88, 88, 20, 20, 4, 4, 576, 224, 4},
+	{96, 96, 22, 22, 4, 4, 696, 272, 4},
+	{104, 104, 24, 24, 4, 4, 816, 336, 6},
+	{120, 120, 18, 18, 6, 6, 1050, 408, 6},
+	{132, 132, 20, 20, 6, 6, 1304, 496, 8},
+	{144, 144, 22, 22, 6, 6, 1558, 620, 10},
+	{8, 18, 6, 16, 1, 1, 5, 7, 1},
+	{8, 32, 6, 14, 1, 2, 10, 11, 1},
+	{12, 26, 10, 24, 1, 1, 16, 14, 1},
+	{12, 36, 10, 16, 1, 2, 22, 18, 1},
+	{16, 36, 14, 16, 1, 2, 32, 24, 1},
+	{16, 48, 14, 22, 1, 2, 49, 28, 1},
+}
+
+var dmField = newGaloisField(0x12d)
+
+// dmEncodeASCII encodes the text in the ASCII encodation, pairs of digits
+// share a codeword. Characters up to U+00FF are encoded as ISO 8859-1.
+func dmEncodeASCII(text string) ([]byte, error) {
+	runes := []rune(text)
+	var ret []byte
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case isDigit(r) && i+1 < len(runes) && isDigit(runes[i+1]):
+			ret = append(ret, byte(130+(r-'0')*10+(runes[i+1]-'0')))
+			i++
+		case r < 128:
+			ret = append(ret, byte(r+1))
+		case r < 256:
+			// upper shift
+			ret = append(ret, 235, byte(r-128+1))
+		default:
+			return nil, fmt.Errorf("the character %q can't be encoded in a Data Matrix code", r)
+		}
+	}
+	return ret, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// encodeDataMatrix returns the modules of the smallest Data Matrix symbol that
+// holds the text. rectangular selects the rectangular symbols if the text fits.
+func encodeDataMatrix(text string, rectangular bool) (matrix, error) {
+	data, err := dmEncodeASCII(text)
+	if err != nil {
+		return nil, err
+	}
+	var sz *dmSize
+	for _, rect := range []bool{rectangular, false} {
+		for i := range dmSizes {
+			s := &dmSizes[i]
+			if (s.rows != s.cols) == rect && len(data) <= s.data {
+				sz = s
+				break
+			}
+		}
+		if sz != nil {
+			break
+		}
+	}
+	if sz == nil {
+		return nil, fmt.Errorf("the data is too long for a Data Matrix code")
+	}
+	// padding
+	for i := len(data); i < sz.data; i++ {
+		if i == len(data) {
+			data = append(data, 129)
+			continue
+		}
+		pad := 129 + (149*(i+1))%253 + 1
+		if pad > 254 {
+			pad -= 254
+		}
+		data = append(data, byte(pad))
+	}
+	codewords := dmAddECC(data, sz)
+
+	nrow, ncol := sz.regionRows*sz.regionsV, sz.regionCols*sz.regionsH
+	p := &dmPlacement{nrow: nrow, ncol: ncol, codewords: codewords}
+	p.bits = newMatrix(nrow, ncol)
+	p.used = newMatrix(nrow, ncol)
+	p.place()
+
+	m := newMatrix(sz.rows, sz.cols)
+	for rv := 0; rv < sz.regionsV; rv++ {
+		for rh := 0; rh < sz.regionsH; rh++ {
+			top, left := rv*(sz.regionRows+2), rh*(sz.regionCols+2)
+			bottom, right := top+sz.regionRows+1, left+sz.regionCols+1
+			// the finder pattern is solid on the left and at the bottom
+			// and alternating at the top and on the right
+			for r := top; r <= bottom; r++ {
+				m[r][left] = true
+				m[r][right] = (r-top)%2 == 1
+			}
+			for c := left; c <= right; c++ {
+				m[bottom][c] = true
+				m[top][c] = (c-left)%2 == 0
+			}
+			for r := 0; r < sz.regionRows; r++ {
+				for c := 0; c < sz.regionCols; c++ {
+					m[top+1+r][left+1+c] = p.bits[rv*sz.regionRows+r][rh*sz.regionCols+c]
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// dmAddECC appends the interleaved error correction codewords.
+func dmAddECC(data []byte, sz *dmSize) []byte {
+	eccLen := sz.ecc / sz.blocks
+	gen := dmField.generator(eccLen, 1)
+	ret := make([]byte, len(data)+sz.ecc)
+	copy(ret, data)
+	for b := 0; b < sz.blocks; b++ {
+		var block []byte
+		for i := b; i < len(data); i += sz.blocks {
+			block = append(block, data[i])
+		}
+		for i, c := range dmField.remainder(block, gen) {
+			ret[len(data)+b+i*sz.blocks] = c
+		}
+	}
+	return ret
+}
+
+// dmPlacement places the codewords in the mapping matrix of a Data Matrix
+// symbol (ISO/IEC 16022 annex F).
+type dmPlacement struct {
+	nrow, ncol int
+	codewords  []byte
+	bits       matrix
+	used       matrix
+}
+
+// module sets the bit (1 is the most significant bit) of the codeword at the
+// position. Positions outside of the matrix wrap around.
+func (p *dmPlacement) module(row, col, cw, bit int) {
+	if row < 0 {
+		row += p.nrow
+		col += 4 - (p.nrow+4)%8
+	}
+	if col < 0 {
+		col += p.ncol
+		row += 4 - (p.ncol+4)%8
+	}
+	p.used[row][col] = true
+	if cw < len(p.codewords) {
+		p.bits[row][col] = (p.codewords[cw]>>(8-bit))&1 != 0
+	}
+}
+
+// utah places the eight bits of a codeword in the standard shape.
+func (p *dmPlacement) utah(row, col, cw int) {
+	p.module(row-2, col-2, cw, 1)
+	p.module(row-2, col-1, cw, 2)
+	p.module(row-1, col-2, cw, 3)
+	p.module(row-1, col-1, cw, 4)
+	p.module(row-1, col, cw, 5)
+	p.module(row, col-2, cw, 6)
+	p.module(row, col-1, cw, 7)
+	p.module(row, col, cw, 8)
+}
+
+// corner places a codeword in one of the special corner shapes.
+func (p *dmPlacement) corner(positions [8][2]int, cw int) {
+	for i, pos := range positions {
+		p.module(pos[0], pos[1], cw, i+1)
+	}
+}
+
+func (p *dmPlacement) place() {
+	nrow, ncol := p.nrow, p.ncol
+	cw := 0
+	row, col := 4, 0
+	for {
+		switch {
+		case row == nrow && col == 0:
+			p.corner([8][2]int{{nrow - 1, 0}, {nrow - 1, 1}, {nrow - 1, 2}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}}, cw)
+			cw++
+		case row == nrow-2 && col == 0 && ncol%4 != 0:
+			p.corner([8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 4}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}}, cw)
+			cw++
+		case row == nrow-2 && col == 0 && ncol%8 == 4:
+			p.corner([8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}}, cw)
+			cw++
+		case row == nrow+4 && col == 2 && ncol%8 == 0:
+			p.corner([8][2]int{{nrow - 1, 0}, {nrow - 1, ncol - 1}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 3}, {1, ncol - 2}, {1, ncol - 1}}, cw)
+			cw++
+		}
+		// upward diagonal
+		for {
+			if row < nrow && col >= 0 && !p.used[row][col] {
+				p.utah(row, col, cw)
+				cw++
+			}
+			row -= 2
+			col += 2
+			if row < 0 || col >= ncol {
+				break
+			}
+		}
+		row++
+		col += 3
+		// downward diagonal
+		for {
+			if row >= 0 && col < ncol && !p.used[row][col] {
+				p.utah(row, col, cw)
+				cw++
+			}
+			row += 2
+			col -= 2
+			if row >= nrow || col < 0 {
+				break
+			}
+		}
+		row += 3
+		col++
+		if row >= nrow && col >= ncol {
+			break
+		}
+	}
+	// the unused lower right corner has a fixed pattern
+	if !p.used[nrow-1][ncol-1] {
+		p.bits[nrow-1][ncol-1] = true
+		p.bits[nrow-2][ncol-2] = true
+	}
+}
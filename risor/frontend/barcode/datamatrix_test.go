@@ -0,0 +1,69 @@
+package barcode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDMEncodeASCII(t *testing.T) {
+	testdata := []struct {
+		text string
+		want []byte
+	}{
+		{"123456", []byte{142, 164, 186}},
+		{"A1", []byte{66, 50}},
+		{"ä", []byte{235, 101}},
+	}
+	for _, td := range testdata {
+		got, err := dmEncodeASCII(td.text)
+		if err != nil {
+			t.Errorf("%q: %s", td.text, err)
+			continue
+		}
+		if !bytes.Equal(got, td.want) {
+			t.Errorf("dmEncodeASCII(%q) = %v, want %v", td.text, got, td.want)
+		}
+	}
+	if _, err := dmEncodeASCII("€"); err == nil {
+		t.Error("expected an error for €")
+	}
+}
+
+func TestEncodeDataMatrix(t *testing.T) {
+	testdata := []struct {
+		text        string
+		rectangular bool
+		want        []string
+	}{
+		{"123456", false, []string{
+			"#.#.#.#.#.",
+			"##..#.##.#",
+			"##.....#..",
+			"##...###.#",
+			"##....#...",
+			"#.....####",
+			"###.##....",
+			"####.##..#",
+			"#..###.#..",
+			"##########",
+		}},
+		{"Hi", true, []string{
+			"#.#.#.#.#.#.#.#.#.",
+			"#.#..#...##.###.##",
+			"##.##...#.####.#..",
+			"#.#......#.#..#.##",
+			"####..#.##.####...",
+			"####.#.###.##....#",
+			"#.#.#...#.##.#.##.",
+			"##################",
+		}},
+	}
+	for _, td := range testdata {
+		m, err := encodeDataMatrix(td.text, td.rectangular)
+		if err != nil {
+			t.Errorf("%q: %s", td.text, err)
+			continue
+		}
+		compareMatrix(t, td.text, m, td.want)
+	}
+}
@@ -0,0 +1,217 @@
+package barcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// code128Patterns are the widths of the bars and spaces of the Code 128
+// symbols 0 to 106 (the start symbols A, B, C and the stop symbol).
+var code128Patterns = []string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128CodeA  = 101
+	code128FNC1   = 102
+	code128StartA = 103
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// digitRun returns the number of digits at the start of s.
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// encodeCode128 returns the bar widths (bar, space, bar, ...) of the text in
+// modules. Runs of four or more digits use code set C, control characters
+// code set A, everything else code set B. With fnc1 the symbol starts with
+// FNC1 (GS1-128) and the group separator (ASCII 29) is encoded as FNC1.
+func encodeCode128(text string, fnc1 bool) ([]int, error) {
+	if text == "" {
+		return nil, fmt.Errorf("a Code 128 barcode needs at least one character")
+	}
+	for _, r := range text {
+		if r > 127 {
+			return nil, fmt.Errorf("the character %q can't be encoded in a Code 128 barcode", r)
+		}
+	}
+	// controlFirst reports whether a control character comes before the next
+	// lower case letter, code set A is better then.
+	controlFirst := func(s string) bool {
+		for i := 0; i < len(s); i++ {
+			if s[i] < 32 && !(fnc1 && s[i] == 29) {
+				return true
+			}
+			if s[i] >= 96 {
+				return false
+			}
+		}
+		return false
+	}
+	var values []int
+	var set int
+	switch n := digitRun(text); {
+	case n >= 4 || (n == len(text) && n >= 2 && n%2 == 0):
+		set = code128CodeC
+		values = append(values, code128StartC)
+	case controlFirst(text):
+		set = code128CodeA
+		values = append(values, code128StartA)
+	default:
+		set = code128CodeB
+		values = append(values, code128StartB)
+	}
+	if fnc1 {
+		values = append(values, code128FNC1)
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		if fnc1 && c == 29 {
+			values = append(values, code128FNC1)
+			i++
+			continue
+		}
+		if set == code128CodeC {
+			if digitRun(text[i:]) >= 2 {
+				values = append(values, int(c-'0')*10+int(text[i+1]-'0'))
+				i += 2
+				continue
+			}
+			set = code128CodeB
+			if controlFirst(text[i:]) {
+				set = code128CodeA
+			}
+			values = append(values, set)
+			continue
+		}
+		if n := digitRun(text[i:]); n >= 4 {
+			// an odd digit stays in the current code set
+			if n%2 == 1 {
+				values = append(values, code128Value(set, c))
+				i++
+			}
+			set = code128CodeC
+			values = append(values, set)
+			continue
+		}
+		switch {
+		case set == code128CodeB && c < 32:
+			set = code128CodeA
+			values = append(values, set)
+		case set == code128CodeA && c >= 96:
+			set = code128CodeB
+			values = append(values, set)
+		}
+		values = append(values, code128Value(set, c))
+		i++
+	}
+	sum := values[0]
+	for i, v := range values[1:] {
+		sum += (i + 1) * v
+	}
+	values = append(values, sum%103, code128Stop)
+
+	var widths []int
+	for _, v := range values {
+		for _, w := range code128Patterns[v] {
+			widths = append(widths, int(w-'0'))
+		}
+	}
+	return widths, nil
+}
+
+// code128Value returns the value of the character in code set A or B.
+func code128Value(set int, c byte) int {
+	if set == code128CodeA && c < 32 {
+		return int(c) + 64
+	}
+	return int(c) - 32
+}
+
+var (
+	eanL = []string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	eanG = []string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	eanR = []string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+	// eanParity selects the L or G code of the left digits by the first digit
+	eanParity = []string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// eanChecksum returns the check digit for the first twelve digits.
+func eanChecksum(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// encodeEAN13 returns the 95 modules of an EAN-13 barcode and the modules
+// that belong to the guard bars. The text has twelve digits (the check digit
+// is added) or thirteen digits with a valid check digit.
+func encodeEAN13(text string) (modules []bool, guard []bool, err error) {
+	text = strings.ReplaceAll(text, " ", "")
+	if digitRun(text) != len(text) || (len(text) != 12 && len(text) != 13) {
+		return nil, nil, fmt.Errorf("an EAN-13 barcode needs 12 or 13 digits, got %q", text)
+	}
+	check := eanChecksum(text)
+	if len(text) == 13 && text[12] != check {
+		return nil, nil, fmt.Errorf("the check digit of %s is wrong, expected %c", text, check)
+	}
+	text = text[:12] + string(check)
+	var sb strings.Builder
+	var gb strings.Builder
+	add := func(pattern string, isGuard bool) {
+		sb.WriteString(pattern)
+		g := "0"
+		if isGuard {
+			g = "1"
+		}
+		gb.WriteString(strings.Repeat(g, len(pattern)))
+	}
+	add("101", true)
+	parity := eanParity[text[0]-'0']
+	for i := 1; i <= 6; i++ {
+		d := text[i] - '0'
+		if parity[i-1] == 'L' {
+			add(eanL[d], false)
+		} else {
+			add(eanG[d], false)
+		}
+	}
+	add("01010", true)
+	for i := 7; i <= 12; i++ {
+		add(eanR[text[i]-'0'], false)
+	}
+	add("101", true)
+	pattern, guardPattern := sb.String(), gb.String()
+	modules = make([]bool, len(pattern))
+	guard = make([]bool, len(pattern))
+	for i := range pattern {
+		modules[i] = pattern[i] == '1'
+		guard[i] = guardPattern[i] == '1'
+	}
+	return modules, guard, nil
+}
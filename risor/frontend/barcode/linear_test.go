@@ -0,0 +1,100 @@
+package barcode
+
+import (
+	"slices"
+	"testing"
+)
+
+// code128Values returns the symbol values of the bar widths.
+func code128Values(t *testing.T, widths []int) []int {
+	t.Helper()
+	var values []int
+	for i := 0; i < len(widths); i += 6 {
+		var pattern []byte
+		for _, w := range widths[i:min(i+6, len(widths))] {
+			pattern = append(pattern, byte('0'+w))
+		}
+		// the stop symbol has seven elements
+		if len(widths)-i == 7 {
+			pattern = append(pattern, byte('0'+widths[i+6]))
+			i++
+		}
+		v := slices.Index(code128Patterns, string(pattern))
+		if v < 0 {
+			t.Fatalf("unknown pattern %s", pattern)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestEncodeCode128(t *testing.T) {
+	testdata := []struct {
+		text string
+		fnc1 bool
+		want []int
+	}{
+		{"PJJ123C", false, []int{104, 48, 42, 42, 17, 18, 19, 35, 55, 106}},
+		{"123456", false, []int{105, 12, 34, 56, 44, 106}},
+		{"AB1234", false, []int{104, 33, 34, 99, 12, 34, 102, 106}},
+		{"\tA", false, []int{103, 73, 33, 36, 106}},
+		{"0112345678901231", true, []int{105, 102, 1, 12, 34, 56, 78, 90, 12, 31, 74, 106}},
+	}
+	for _, td := range testdata {
+		widths, err := encodeCode128(td.text, td.fnc1)
+		if err != nil {
+			t.Errorf("%q: %s", td.text, err)
+			continue
+		}
+		if got := code128Values(t, widths); !slices.Equal(got, td.want) {
+			t.Errorf("encodeCode128(%q) = %v, want %v", td.text, got, td.want)
+		}
+	}
+	for _, text := range []string{"", "ä"} {
+		if _, err := encodeCode128(text, false); err == nil {
+			t.Errorf("encodeCode128(%q): expected an error", text)
+		}
+	}
+}
+
+func TestEncodeEAN13(t *testing.T) {
+	testdata := []struct {
+		text string
+		ok   bool
+	}{
+		{"400638133393", true},
+		{"4006381333931", true},
+		{"4006381333932", false},
+		{"40063813339", false},
+		{"40063813339a", false},
+	}
+	for _, td := range testdata {
+		modules, guard, err := encodeEAN13(td.text)
+		if (err == nil) != td.ok {
+			t.Errorf("encodeEAN13(%q): error %v", td.text, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(modules) != 95 || len(guard) != 95 {
+			t.Errorf("encodeEAN13(%q): got %d modules, want 95", td.text, len(modules))
+		}
+	}
+	// 4006381333931: first digit 4 selects LGLLGG for 006381
+	modules, _, _ := encodeEAN13("4006381333931")
+	var got []byte
+	for _, m := range modules[3:10] {
+		if m {
+			got = append(got, '1')
+		} else {
+			got = append(got, '0')
+		}
+	}
+	if string(got) != eanL[0] {
+		t.Errorf("first digit after the guard = %s, want %s", got, eanL[0])
+	}
+	if c := eanChecksum("590123412345"); c != '7' {
+		t.Errorf("eanChecksum(590123412345) = %c, want 7", c)
+	}
+}
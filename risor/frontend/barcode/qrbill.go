@@ -0,0 +1,428 @@
+package barcode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// qrBillLabels are the headings of the QR-bill by language.
+var qrBillLabels = map[string]map[string]string{
+	"en": {
+		"receipt":          "Receipt",
+		"payment_part":     "Payment part",
+		"account":          "Account / Payable to",
+		"reference":        "Reference",
+		"information":      "Additional information",
+		"payable_by":       "Payable by",
+		"payable_by_blank": "Payable by (name/address)",
+		"currency":         "Currency",
+		"amount":           "Amount",
+		"acceptance":       "Acceptance point",
+	},
+	"de": {
+		"receipt":          "Empfangsschein",
+		"payment_part":     "Zahlteil",
+		"account":          "Konto / Zahlbar an",
+		"reference":        "Referenz",
+		"information":      "Zusätzliche Informationen",
+		"payable_by":       "Zahlbar durch",
+		"payable_by_blank": "Zahlbar durch (Name/Adresse)",
+		"currency":         "Währung",
+		"amount":           "Betrag",
+		"acceptance":       "Annahmestelle",
+	},
+	"fr": {
+		"receipt":          "Récépissé",
+		"payment_part":     "Section paiement",
+		"account":          "Compte / Payable à",
+		"reference":        "Référence",
+		"information":      "Informations supplémentaires",
+		"payable_by":       "Payable par",
+		"payable_by_blank": "Payable par (nom/adresse)",
+		"currency":         "Monnaie",
+		"amount":           "Montant",
+		"acceptance":       "Point de dépôt",
+	},
+	"it": {
+		"receipt":          "Ricevuta",
+		"payment_part":     "Sezione pagamento",
+		"account":          "Conto / Pagabile a",
+		"reference":        "Riferimento",
+		"information":      "Informazioni supplementari",
+		"payable_by":       "Pagabile da",
+		"payable_by_blank": "Pagabile da (nome/indirizzo)",
+		"currency":         "Valuta",
+		"amount":           "Importo",
+		"acceptance":       "Punto di accettazione",
+	},
+}
+
+// group inserts a space after every n characters, the first group has first
+// characters.
+func group(s string, first, n int) string {
+	var sb strings.Builder
+	for i, c := range s {
+		if i > 0 && (i == first || (i > first && (i-first)%n == 0)) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// formatAmount returns the amount with a space as the thousands separator.
+func formatAmount(amount string) string {
+	intPart, frac, _ := strings.Cut(amount, ".")
+	l := len(intPart)
+	return group(intPart, (l-1)%3+1, 3) + "." + frac
+}
+
+// printLines returns the lines of the address as printed on the bill.
+func (a *swissAddress) printLines() []string {
+	lines := []string{a.name}
+	if street := strings.TrimSpace(a.street + " " + a.buildingNumber); street != "" {
+		lines = append(lines, street)
+	}
+	town := a.postalCode + " " + a.town
+	if a.country != "CH" && a.country != "LI" {
+		town = a.country + "-" + town
+	}
+	return append(lines, town)
+}
+
+// qrBillColumn is a stack of text lines.
+type qrBillColumn struct {
+	fe     *frontend.Document
+	family *frontend.FontFamily
+	width  bag.ScaledPoint
+	// font sizes of the headings and the values and the distance of the
+	// baselines
+	headingSize, valueSize, leading bag.ScaledPoint
+	head, cur                       node.Node
+	err                             error
+}
+
+func (col *qrBillColumn) add(n node.Node) {
+	col.head = node.InsertAfter(col.head, col.cur, n)
+	col.cur = n
+}
+
+// line adds a single line of text.
+func (col *qrBillColumn) line(str string, size bag.ScaledPoint, bold bool, align frontend.HorizontalAlignment) {
+	if col.err != nil {
+		return
+	}
+	te := frontend.NewText()
+	te.Settings[frontend.SettingFontFamily] = col.family
+	te.Settings[frontend.SettingSize] = size
+	if bold {
+		te.Settings[frontend.SettingFontWeight] = frontend.FontWeight700
+	}
+	te.Items = append(te.Items, str)
+	vl, _, err := col.fe.FormatParagraph(te, col.width,
+		frontend.Leading(col.leading),
+		frontend.FontSize(size),
+		frontend.Family(col.family),
+		frontend.HorizontalAlign(align))
+	if err != nil {
+		col.err = err
+		return
+	}
+	// the baselines have the distance of the leading
+	vl.Height = col.leading - vl.Depth
+	col.add(vl)
+}
+
+func (col *qrBillColumn) heading(str string) {
+	col.line(str, col.headingSize, true, frontend.HAlignLeft)
+}
+
+func (col *qrBillColumn) values(lines ...string) {
+	for _, l := range lines {
+		col.line(l, col.valueSize, false, frontend.HAlignLeft)
+	}
+}
+
+// skip adds vertical space.
+func (col *qrBillColumn) skip(wd bag.ScaledPoint) {
+	g := node.NewGlue()
+	g.Width = wd
+	col.add(g)
+}
+
+// qrBillCanvas places boxes at absolute positions on the bill.
+type qrBillCanvas struct {
+	head, cur node.Node
+}
+
+func (c *qrBillCanvas) add(n node.Node) {
+	c.head = node.InsertAfter(c.head, c.cur, n)
+	c.cur = n
+}
+
+// place puts n with its top left corner at x, y measured from the top left
+// corner of the bill.
+func (c *qrBillCanvas) place(n node.Node, x, y bag.ScaledPoint) {
+	if n == nil {
+		return
+	}
+	g := node.NewGlue()
+	g.Width = y
+	wrapper := node.Vpack(node.InsertAfter(g, g, n))
+	before := node.NewGlue()
+	before.Width = x
+	after := node.NewGlue()
+	after.Width = -x - wrapper.Width
+	c.add(before)
+	c.add(wrapper)
+	c.add(after)
+}
+
+// cornerMarks returns the PDF path of the corner marks of the field at x, y
+// (top left corner, measured from the top left corner of the bill).
+func cornerMarks(x, y, wd, ht bag.ScaledPoint) string {
+	billHeight := bag.MustSP("105mm")
+	l := bag.MustSP("3mm")
+	x1, y1 := x, billHeight-y-ht
+	x2, y2 := x+wd, billHeight-y
+	var sb strings.Builder
+	for _, c := range [][6]bag.ScaledPoint{
+		{x1, y2 - l, x1, y2, x1 + l, y2},
+		{x2 - l, y2, x2, y2, x2, y2 - l},
+		{x1, y1 + l, x1, y1, x1 + l, y1},
+		{x2 - l, y1, x2, y1, x2, y1 + l},
+	} {
+		fmt.Fprintf(&sb, "%s %s m %s %s l %s %s l ", c[0], c[1], c[2], c[3], c[4], c[5])
+	}
+	return sb.String()
+}
+
+// swissQRBill implements barcode.swiss_qr_bill(doc, data[, {family, language,
+// lines}]). It returns the QR-bill (receipt and payment part) as a vlist of
+// 210mm × 105mm for the bottom of an A4 page. The data is the same as for
+// barcode.swiss_qr. The font family defaults to the family "text", the
+// language (en, de, fr or it) to en. With lines set to false the separating
+// lines are left out, for example for perforated paper.
+func swissQRBill(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 2 || len(args) > 3 {
+		return object.NewArgsRangeError("barcode.swiss_qr_bill", 2, 3, len(args))
+	}
+	fe, ok := args[0].Interface().(*frontend.Document)
+	if !ok {
+		return object.ArgsErrorf("barcode.swiss_qr_bill(): the first argument must be a frontend.document, got %s", args[0].Type())
+	}
+	sp, err := parseSwissPayment(args[1])
+	if err != nil {
+		return object.Errorf("barcode.swiss_qr_bill(): %s", err)
+	}
+	family := fe.FindFontFamily("text")
+	language := "en"
+	lines := true
+	if len(args) == 3 {
+		m, errObj := object.AsMap(args[2])
+		if errObj != nil {
+			return errObj
+		}
+		for k, v := range m.Value() {
+			switch k {
+			case "family":
+				ff, ok := v.Interface().(*frontend.FontFamily)
+				if !ok {
+					return object.ArgsErrorf("barcode.swiss_qr_bill(): family expects a frontend.fontfamily, got %s", v.Type())
+				}
+				family = ff
+			case "language":
+				if language, errObj = object.AsString(v); errObj != nil {
+					return errObj
+				}
+				if _, ok := qrBillLabels[language]; !ok {
+					return object.ArgsErrorf("barcode.swiss_qr_bill(): language must be en, de, fr or it, got %s", language)
+				}
+			case "lines":
+				if lines, errObj = object.AsBool(v); errObj != nil {
+					return errObj
+				}
+			default:
+				return object.ArgsErrorf("barcode.swiss_qr_bill(): unknown option %s", k)
+			}
+		}
+	}
+	if family == nil {
+		return object.Errorf("barcode.swiss_qr_bill(): no font family, define the font family text or use the option family")
+	}
+	vl, err := qrBillNode(fe, family, qrBillLabels[language], sp, lines)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return &rnode.Node{Value: vl}
+}
+
+// qrBillNode lays out the receipt and the payment part.
+func qrBillNode(fe *frontend.Document, family *frontend.FontFamily, labels map[string]string, sp *swissPayment, lines bool) (*node.VList, error) {
+	mm := func(f float64) bag.ScaledPoint { return bag.ScaledPoint(f * float64(bag.MustSP("1mm"))) }
+	var reference string
+	switch sp.refType {
+	case "QRR":
+		reference = group(sp.reference, 2, 5)
+	case "SCOR":
+		reference = group(sp.reference, 4, 4)
+	}
+	iban := group(sp.iban, 4, 4)
+	newColumn := func(width, headingSize, valueSize, leading bag.ScaledPoint) *qrBillColumn {
+		return &qrBillColumn{fe: fe, family: family, width: width, headingSize: headingSize, valueSize: valueSize, leading: leading}
+	}
+	var marks []string
+	canvas := &qrBillCanvas{}
+
+	// receipt
+	title := newColumn(mm(52), 0, 0, bag.MustSP("13pt"))
+	title.line(labels["receipt"], bag.MustSP("11pt"), true, frontend.HAlignLeft)
+	canvas.place(title.head, mm(5), mm(5))
+
+	info := newColumn(mm(52), bag.MustSP("6pt"), bag.MustSP("8pt"), bag.MustSP("9pt"))
+	info.heading(labels["account"])
+	info.values(iban)
+	info.values(sp.creditor.printLines()...)
+	if reference != "" {
+		info.skip(info.leading)
+		info.heading(labels["reference"])
+		info.values(reference)
+	}
+	info.skip(info.leading)
+	if sp.debtor != nil {
+		info.heading(labels["payable_by"])
+		info.values(sp.debtor.printLines()...)
+		canvas.place(info.head, mm(5), mm(12))
+	} else {
+		info.heading(labels["payable_by_blank"])
+		vl := node.Vpack(info.head)
+		canvas.place(vl, mm(5), mm(12))
+		marks = append(marks, cornerMarks(mm(5), mm(12)+vl.Height+vl.Depth+mm(1), mm(52), mm(20)))
+	}
+	if info.err != nil {
+		return nil, info.err
+	}
+
+	amountColumns := func(x, y, amountX, headingSize, valueSize, leading bag.ScaledPoint, boxWidth, boxHeight bag.ScaledPoint, boxX bag.ScaledPoint) error {
+		cur := newColumn(amountX-x, headingSize, valueSize, leading)
+		cur.heading(labels["currency"])
+		cur.values(sp.currency)
+		canvas.place(cur.head, x, y)
+		amt := newColumn(mm(40), headingSize, valueSize, leading)
+		amt.heading(labels["amount"])
+		if sp.amount != "" {
+			amt.values(formatAmount(sp.amount))
+		} else {
+			marks = append(marks, cornerMarks(boxX, y+leading, boxWidth, boxHeight))
+		}
+		canvas.place(amt.head, amountX, y)
+		if cur.err != nil {
+			return cur.err
+		}
+		return amt.err
+	}
+	if err := amountColumns(mm(5), mm(68), mm(17), bag.MustSP("6pt"), bag.MustSP("8pt"), bag.MustSP("9pt"), mm(30), mm(10), mm(27)); err != nil {
+		return nil, err
+	}
+
+	acceptance := newColumn(mm(52), 0, 0, bag.MustSP("9pt"))
+	acceptance.line(labels["acceptance"], bag.MustSP("6pt"), true, frontend.HAlignRight)
+	if acceptance.err != nil {
+		return nil, acceptance.err
+	}
+	canvas.place(acceptance.head, mm(5), mm(82))
+
+	// payment part
+	title = newColumn(mm(51), 0, 0, bag.MustSP("13pt"))
+	title.line(labels["payment_part"], bag.MustSP("11pt"), true, frontend.HAlignLeft)
+	if title.err != nil {
+		return nil, title.err
+	}
+	canvas.place(title.head, mm(67), mm(5))
+
+	qr, err := swissQRNode(sp, mm(46), 0)
+	if err != nil {
+		return nil, err
+	}
+	canvas.place(qr.Value, mm(67), mm(17))
+
+	if err := amountColumns(mm(67), mm(68), mm(81), bag.MustSP("8pt"), bag.MustSP("10pt"), bag.MustSP("11pt"), mm(40), mm(15), mm(78)); err != nil {
+		return nil, err
+	}
+
+	info = newColumn(mm(87), bag.MustSP("8pt"), bag.MustSP("10pt"), bag.MustSP("11pt"))
+	info.heading(labels["account"])
+	info.values(iban)
+	info.values(sp.creditor.printLines()...)
+	if reference != "" {
+		info.skip(info.leading)
+		info.heading(labels["reference"])
+		info.values(reference)
+	}
+	if sp.message != "" || sp.billInformation != "" {
+		info.skip(info.leading)
+		info.heading(labels["information"])
+		for _, s := range []string{sp.message, sp.billInformation} {
+			if s != "" {
+				info.values(s)
+			}
+		}
+	}
+	info.skip(info.leading)
+	if sp.debtor != nil {
+		info.heading(labels["payable_by"])
+		info.values(sp.debtor.printLines()...)
+		canvas.place(info.head, mm(118), mm(5))
+	} else {
+		info.heading(labels["payable_by_blank"])
+		vl := node.Vpack(info.head)
+		canvas.place(vl, mm(118), mm(5))
+		marks = append(marks, cornerMarks(mm(118), mm(5)+vl.Height+vl.Depth+mm(1), mm(65), mm(25)))
+	}
+	if info.err != nil {
+		return nil, info.err
+	}
+
+	if len(sp.altSchemes) > 0 {
+		alt := newColumn(mm(138), 0, 0, bag.MustSP("8pt"))
+		for _, s := range sp.altSchemes {
+			alt.line(s, bag.MustSP("7pt"), false, frontend.HAlignLeft)
+		}
+		if alt.err != nil {
+			return nil, alt.err
+		}
+		canvas.place(alt.head, mm(67), mm(90))
+	}
+
+	// The separating lines and the corner marks are drawn by a rule at the
+	// lower left corner of the bill.
+	var pre strings.Builder
+	pre.WriteString("q 0 G 0 J")
+	if lines {
+		fmt.Fprintf(&pre, " 0.2 w 0 %s m %s %s l %s 0 m %s %s l S", mm(105), mm(210), mm(105), mm(62), mm(62), mm(105))
+	}
+	if len(marks) > 0 {
+		fmt.Fprintf(&pre, " 0.75 w %sS", strings.Join(marks, ""))
+	}
+	pre.WriteString(" Q")
+	r := node.NewRule()
+	r.Hide = true
+	r.Pre = pre.String()
+	r.Attributes = node.H{"origin": "qrbill"}
+	head := node.InsertAfter(r, r, canvas.head)
+
+	hl := node.Hpack(head)
+	hl.Width = mm(210)
+	hl.Height = mm(105)
+	hl.Depth = 0
+	vl := node.Vpack(hl)
+	vl.Attributes = node.H{"origin": "qrbill"}
+	return vl, nil
+}
@@ -0,0 +1,477 @@
+package barcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// qrLevel is the error correction level of a QR code.
+type qrLevel int
+
+const (
+	qrLevelL qrLevel = iota
+	qrLevelM
+	qrLevelQ
+	qrLevelH
+)
+
+var qrLevels = map[string]qrLevel{"L": qrLevelL, "M": qrLevelM, "Q": qrLevelQ, "H": qrLevelH}
+
+// qrFormatBits are the bits of the error correction levels in the format
+// information.
+var qrFormatBits = [4]int{1, 0, 3, 2}
+
+// qrECCPerBlock is the number of error correction codewords per block by level
+// and version.
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrNumBlocks is the number of error correction blocks by level and version.
+var qrNumBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+var qrField = newGaloisField(0x11d)
+
+// qrRawModules returns the number of modules of a QR code of the version that
+// hold data and error correction codewords.
+func qrRawModules(ver int) int {
+	result := (16*ver+128)*ver + 64
+	if ver >= 2 {
+		numAlign := ver/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if ver >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords returns the number of data codewords of the version and
+// level.
+func qrDataCodewords(ver int, lvl qrLevel) int {
+	return qrRawModules(ver)/8 - qrECCPerBlock[lvl][ver]*qrNumBlocks[lvl][ver]
+}
+
+// bitBuffer is a sequence of bits.
+type bitBuffer []bool
+
+// append adds the n lowest bits of val, the highest bit first.
+func (bb *bitBuffer) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (val>>i)&1 != 0)
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	ret := make([]byte, (len(bb)+7)/8)
+	for i, b := range bb {
+		if b {
+			ret[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return ret
+}
+
+// qrSegment is the data of a QR code in a single mode.
+type qrSegment struct {
+	// the mode indicator: numeric, alphanumeric or byte
+	mode  int
+	count int
+	data  bitBuffer
+}
+
+const (
+	qrModeNumeric      = 1
+	qrModeAlphanumeric = 2
+	qrModeByte         = 4
+)
+
+// newQRSegment encodes the text in the most compact of the numeric,
+// alphanumeric and byte modes. Text in byte mode is UTF-8.
+func newQRSegment(text string) qrSegment {
+	numeric, alnum := true, true
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			numeric = false
+		}
+		if !strings.ContainsRune(qrAlphanumeric, r) {
+			alnum = false
+		}
+	}
+	seg := qrSegment{count: len(text)}
+	switch {
+	case numeric && text != "":
+		seg.mode = qrModeNumeric
+		for i := 0; i < len(text); i += 3 {
+			group := text[i:min(i+3, len(text))]
+			val := 0
+			for _, c := range group {
+				val = val*10 + int(c-'0')
+			}
+			seg.data.append(val, len(group)*3+1)
+		}
+	case alnum && text != "":
+		seg.mode = qrModeAlphanumeric
+		for i := 0; i < len(text); i += 2 {
+			val := strings.IndexByte(qrAlphanumeric, text[i])
+			if i+1 < len(text) {
+				seg.data.append(val*45+strings.IndexByte(qrAlphanumeric, text[i+1]), 11)
+			} else {
+				seg.data.append(val, 6)
+			}
+		}
+	default:
+		seg.mode = qrModeByte
+		for i := 0; i < len(text); i++ {
+			seg.data.append(int(text[i]), 8)
+		}
+	}
+	return seg
+}
+
+// countBits returns the length of the character count indicator.
+func (seg qrSegment) countBits(ver int) int {
+	idx := 0
+	if ver >= 27 {
+		idx = 2
+	} else if ver >= 10 {
+		idx = 1
+	}
+	switch seg.mode {
+	case qrModeNumeric:
+		return []int{10, 12, 14}[idx]
+	case qrModeAlphanumeric:
+		return []int{9, 11, 13}[idx]
+	}
+	return []int{8, 16, 16}[idx]
+}
+
+// qrSymbol is a QR code under construction.
+type qrSymbol struct {
+	ver      int
+	size     int
+	modules  matrix
+	function matrix
+}
+
+// encodeQR returns the modules of the smallest QR code with the error
+// correction level that holds the text.
+func encodeQR(text string, lvl qrLevel) (matrix, error) {
+	seg := newQRSegment(text)
+	ver := 1
+	for ; ver <= 40; ver++ {
+		if 4+seg.countBits(ver)+len(seg.data) <= qrDataCodewords(ver, lvl)*8 {
+			break
+		}
+	}
+	if ver > 40 {
+		return nil, fmt.Errorf("the data is too long for a QR code")
+	}
+	capacity := qrDataCodewords(ver, lvl) * 8
+	var bb bitBuffer
+	bb.append(seg.mode, 4)
+	bb.append(seg.count, seg.countBits(ver))
+	bb = append(bb, seg.data...)
+	// terminator, fill to a byte boundary, alternating pad bytes
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xec; len(bb) < capacity; pad ^= 0xec ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	q := &qrSymbol{ver: ver, size: ver*4 + 17}
+	q.modules = newMatrix(q.size, q.size)
+	q.function = newMatrix(q.size, q.size)
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addECC(bb.bytes(), lvl))
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(lvl, mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		// masking twice restores the modules
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormatBits(lvl, best)
+	return q.modules, nil
+}
+
+// set sets a function module.
+func (q *qrSymbol) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrSymbol) alignmentPositions() []int {
+	if q.ver == 1 {
+		return nil
+	}
+	n := q.ver/7 + 2
+	step := (q.ver*4 + n*2 + 1) / (n*2 - 2) * 2
+	if q.ver == 32 {
+		step = 26
+	}
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, q.size-7; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+func (q *qrSymbol) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		// finder pattern with separator
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				q.set(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+	pos := q.alignmentPositions()
+	n := len(pos)
+	for i := range pos {
+		for j := range pos {
+			// the corners with finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(pos[i]+dx, pos[j]+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// reserve the format areas
+	q.drawFormatBits(0, 0)
+	if q.ver >= 7 {
+		rem := q.ver
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+		}
+		bits := q.ver<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+func (q *qrSymbol) drawFormatBits(lvl qrLevel, mask int) {
+	data := qrFormatBits[lvl]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// addECC splits the data into blocks, adds the error correction codewords and
+// interleaves the blocks.
+func (q *qrSymbol) addECC(data []byte, lvl qrLevel) []byte {
+	numBlocks := qrNumBlocks[lvl][q.ver]
+	eccLen := qrECCPerBlock[lvl][q.ver]
+	raw := qrRawModules(q.ver) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	gen := qrField.generator(eccLen, 0)
+	dataBlocks := make([][]byte, numBlocks)
+	eccBlocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range numBlocks {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		dataBlocks[i] = data[k : k+n]
+		eccBlocks[i] = qrField.remainder(dataBlocks[i], gen)
+		k += n
+	}
+	ret := make([]byte, 0, raw)
+	for i := 0; i <= shortLen-eccLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				ret = append(ret, block[i])
+			}
+		}
+	}
+	for i := range eccLen {
+		for _, block := range eccBlocks {
+			ret = append(ret, block[i])
+		}
+	}
+	return ret
+}
+
+// drawCodewords places the codewords in the zigzag pattern.
+func (q *qrSymbol) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrSymbol) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// qrFinderLike is the 1:1:3:1:1 pattern of the finder patterns.
+var qrFinderLike = []bool{true, false, true, true, true, false, true}
+
+// penalty rates the modules, masks with a lower penalty are easier to read.
+func (q *qrSymbol) penalty() int {
+	size := q.size
+	p := 0
+	line := make([]bool, size)
+	light := func(from, to int) bool {
+		for i := from; i < to; i++ {
+			if i >= 0 && i < size && line[i] {
+				return false
+			}
+		}
+		return true
+	}
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < size; i++ {
+			for j := 0; j < size; j++ {
+				if pass == 0 {
+					line[j] = q.modules[i][j]
+				} else {
+					line[j] = q.modules[j][i]
+				}
+			}
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= size; j++ {
+				if j < size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += run - 2
+				}
+				run = 1
+			}
+			// patterns that look like finder patterns
+			for j := 0; j+7 <= size; j++ {
+				match := true
+				for k, dark := range qrFinderLike {
+					if line[j+k] != dark {
+						match = false
+						break
+					}
+				}
+				if match && (light(j-4, j) || light(j+7, j+11)) {
+					p += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x < size-1 && y < size-1 {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					p += 3
+				}
+			}
+		}
+	}
+	total := size * size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return p + k*10
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,99 @@
+package barcode
+
+import (
+	"strings"
+	"testing"
+)
+
+// matrixString returns the rows of m with # for dark and . for light modules.
+func matrixString(m matrix) []string {
+	rows := make([]string, len(m))
+	for i, r := range m {
+		var sb strings.Builder
+		for _, dark := range r {
+			if dark {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		rows[i] = sb.String()
+	}
+	return rows
+}
+
+func compareMatrix(t *testing.T, name string, got matrix, want []string) {
+	t.Helper()
+	rows := matrixString(got)
+	if len(rows) != len(want) {
+		t.Fatalf("%s: got %d rows, want %d", name, len(rows), len(want))
+	}
+	for i := range rows {
+		if rows[i] != want[i] {
+			t.Errorf("%s: row %d = %s, want %s", name, i, rows[i], want[i])
+		}
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	m, err := encodeQR("HELLO WORLD", qrLevelQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareMatrix(t, "HELLO WORLD", m, []string{
+		"#######.##....#######",
+		"#.....#.#..#..#.....#",
+		"#.###.#.#..##.#.###.#",
+		"#.###.#.#.....#.###.#",
+		"#.###.#.#.#...#.###.#",
+		"#.....#...#...#.....#",
+		"#######.#.#.#.#######",
+		"........#............",
+		".##.#.##....#.#.#####",
+		".#......####....#...#",
+		"..##.###.##...#.##...",
+		".##.##.#..##.#.#.###.",
+		"#...#.#.#.###.###.#.#",
+		"........##.#..#...#.#",
+		"#######.#.#....#.##..",
+		"#.....#..#.##.##.#...",
+		"#.###.#.#.#...#######",
+		"#.###.#..#.#.#.#...#.",
+		"#.###.#.#..#.###.#..#",
+		"#.....#.#.####...#.##",
+		"#######....#.###....#",
+	})
+}
+
+func TestQRVersion(t *testing.T) {
+	testdata := []struct {
+		text string
+		lvl  qrLevel
+		size int
+	}{
+		// the capacity of version 1-M is 34 digits, of 1-H 10 alphanumeric
+		// characters, of 2-M 26 bytes and of 10-L 271 bytes
+		{"1", qrLevelL, 21},
+		{strings.Repeat("1", 34), qrLevelM, 21},
+		{strings.Repeat("1", 35), qrLevelM, 25},
+		{"HELLO", qrLevelH, 21},
+		{"HELLO WORLD", qrLevelH, 25},
+		{"https://www.example.com/", qrLevelM, 25},
+		{strings.Repeat("a", 271), qrLevelL, 57},
+		{strings.Repeat("a", 272), qrLevelL, 61},
+		{strings.Repeat("ä", 100), qrLevelM, 57},
+	}
+	for _, td := range testdata {
+		m, err := encodeQR(td.text, td.lvl)
+		if err != nil {
+			t.Errorf("%q: %s", td.text, err)
+			continue
+		}
+		if len(m) != td.size {
+			t.Errorf("%q: size = %d, want %d", td.text, len(m), td.size)
+		}
+	}
+	if _, err := encodeQR(strings.Repeat("a", 3000), qrLevelH); err == nil {
+		t.Error("expected an error for data that is too long")
+	}
+}
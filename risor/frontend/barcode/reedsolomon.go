@@ -0,0 +1,65 @@
+package barcode
+
+// galoisField is GF(256) with the given primitive polynomial. QR codes use
+// 0x11d, Data Matrix uses 0x12d.
+type galoisField struct {
+	exp [512]byte
+	log [256]int
+}
+
+func newGaloisField(poly int) *galoisField {
+	gf := &galoisField{}
+	x := 1
+	for i := 0; i < 255; i++ {
+		gf.exp[i] = byte(x)
+		gf.log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= poly
+		}
+	}
+	// the doubled table saves the modulo in mul
+	for i := 255; i < 512; i++ {
+		gf.exp[i] = gf.exp[i-255]
+	}
+	return gf
+}
+
+func (gf *galoisField) mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf.exp[gf.log[a]+gf.log[b]]
+}
+
+// generator returns the coefficients of the generator polynomial
+// (x - a^first)(x - a^(first+1))...(x - a^(first+n-1)) without the leading 1,
+// highest degree first.
+func (gf *galoisField) generator(n, first int) []byte {
+	gen := []byte{1}
+	for i := 0; i < n; i++ {
+		root := gf.exp[(first+i)%255]
+		next := make([]byte, len(gen)+1)
+		for j, c := range gen {
+			next[j] ^= c
+			next[j+1] ^= gf.mul(c, root)
+		}
+		gen = next
+	}
+	return gen[1:]
+}
+
+// remainder returns the error correction codewords for data, the remainder
+// of the division of the data polynomial by the generator.
+func (gf *galoisField) remainder(data []byte, gen []byte) []byte {
+	rem := make([]byte, len(gen))
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[len(rem)-1] = 0
+		for i, c := range gen {
+			rem[i] ^= gf.mul(c, factor)
+		}
+	}
+	return rem
+}
@@ -0,0 +1,31 @@
+package barcode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRemainder(t *testing.T) {
+	testdata := []struct {
+		name  string
+		gf    *galoisField
+		first int
+		data  []byte
+		ecc   []byte
+	}{
+		// QR code HELLO WORLD, version 1-Q
+		{"qr", qrField, 0,
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236},
+			[]byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16}},
+		// Data Matrix 123456 (ISO/IEC 16022 annex O)
+		{"datamatrix", dmField, 1,
+			[]byte{142, 164, 186},
+			[]byte{114, 25, 5, 88, 102}},
+	}
+	for _, td := range testdata {
+		gen := td.gf.generator(len(td.ecc), td.first)
+		if got := td.gf.remainder(td.data, gen); !bytes.Equal(got, td.ecc) {
+			t.Errorf("%s: remainder() = %v, want %v", td.name, got, td.ecc)
+		}
+	}
+}
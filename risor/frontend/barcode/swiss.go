@@ -0,0 +1,354 @@
+package barcode
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// swissAddress is a structured address (address type S) of the Swiss QR code.
+type swissAddress struct {
+	name, street, buildingNumber, postalCode, town, country string
+}
+
+// swissPayment is the content of a Swiss QR code according to the Swiss
+// Implementation Guidelines for the QR-bill (version 2.x).
+type swissPayment struct {
+	iban     string
+	creditor swissAddress
+	debtor   *swissAddress
+	// amount with two decimals or empty
+	amount   string
+	currency string
+	// QRR, SCOR or NON
+	refType         string
+	reference       string
+	message         string
+	billInformation string
+	altSchemes      []string
+}
+
+// lines returns the address fields of the payload. A missing address has
+// seven empty fields.
+func (a *swissAddress) lines() []string {
+	if a == nil {
+		return make([]string, 7)
+	}
+	return []string{"S", a.name, a.street, a.buildingNumber, a.postalCode, a.town, a.country}
+}
+
+// payload returns the text of the Swiss QR code.
+func (sp *swissPayment) payload() string {
+	lines := []string{"SPC", "0200", "1", sp.iban}
+	lines = append(lines, sp.creditor.lines()...)
+	// the ultimate creditor is reserved for future use
+	lines = append(lines, make([]string, 7)...)
+	lines = append(lines, sp.amount, sp.currency)
+	lines = append(lines, sp.debtor.lines()...)
+	lines = append(lines, sp.refType, sp.reference, sp.message, "EPD")
+	if sp.billInformation != "" || len(sp.altSchemes) > 0 {
+		lines = append(lines, sp.billInformation)
+		lines = append(lines, sp.altSchemes...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isQRIBAN reports whether the IBAN is a QR-IBAN, the institution ID is
+// between 30000 and 31999.
+func isQRIBAN(iban string) bool {
+	iid, err := strconv.Atoi(iban[4:9])
+	return err == nil && iid >= 30000 && iid <= 31999
+}
+
+// mod97 returns the remainder of the ISO 7064 check of s where letters count
+// as 10 to 35. s must be alphanumeric.
+func mod97(s string) int {
+	var sb strings.Builder
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			sb.WriteString(strconv.Itoa(int(c-'A') + 10))
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(sb.String(), 10)
+	return int(new(big.Int).Mod(n, big.NewInt(97)).Int64())
+}
+
+func isAlnum(s string) bool {
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z') && !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkIBAN normalizes and validates a Swiss or Liechtenstein IBAN.
+func checkIBAN(iban string) (string, error) {
+	iban = strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(iban) != 21 || !(strings.HasPrefix(iban, "CH") || strings.HasPrefix(iban, "LI")) || !isAlnum(iban) {
+		return "", fmt.Errorf("the IBAN %s is not a Swiss or Liechtenstein IBAN", iban)
+	}
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return "", fmt.Errorf("the check digits of the IBAN %s are wrong", iban)
+	}
+	return iban, nil
+}
+
+// mod10 returns the check digit (modulo 10, recursive) of the QR reference
+// digits.
+func mod10(digits string) byte {
+	table := []int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+	carry := 0
+	for _, c := range digits {
+		carry = table[(carry+int(c-'0'))%10]
+	}
+	return byte('0' + (10-carry)%10)
+}
+
+// checkReference validates the reference and returns the reference type.
+func checkReference(ref string, qrIBAN bool) (string, string, error) {
+	ref = strings.ToUpper(strings.ReplaceAll(ref, " ", ""))
+	switch {
+	case qrIBAN:
+		if len(ref) != 27 || digitRun(ref) != 27 {
+			return "", "", fmt.Errorf("a QR-IBAN needs a QR reference with 27 digits")
+		}
+		if mod10(ref[:26]) != ref[26] {
+			return "", "", fmt.Errorf("the check digit of the QR reference %s is wrong", ref)
+		}
+		return "QRR", ref, nil
+	case ref == "":
+		return "NON", "", nil
+	case strings.HasPrefix(ref, "RF"):
+		if len(ref) < 5 || len(ref) > 25 || !isAlnum(ref) || mod97(ref[4:]+ref[:4]) != 1 {
+			return "", "", fmt.Errorf("the creditor reference %s is not valid", ref)
+		}
+		return "SCOR", ref, nil
+	}
+	return "", "", fmt.Errorf("the reference %s needs a QR-IBAN or must be a creditor reference (RF...)", ref)
+}
+
+// swissString reads an optional string field and checks its length.
+func swissString(m *object.Map, key string, maxLen int, required bool) (string, error) {
+	v := m.Get(key)
+	if v == object.Nil {
+		if required {
+			return "", fmt.Errorf("%s is required", key)
+		}
+		return "", nil
+	}
+	s, errObj := object.AsString(v)
+	if errObj != nil {
+		return "", fmt.Errorf("%s: %s", key, errObj.Message().Value())
+	}
+	s = strings.TrimSpace(s)
+	if required && s == "" {
+		return "", fmt.Errorf("%s is required", key)
+	}
+	if utf8.RuneCountInString(s) > maxLen {
+		return "", fmt.Errorf("%s is longer than %d characters", key, maxLen)
+	}
+	return s, nil
+}
+
+// parseSwissAddress reads the address map.
+func parseSwissAddress(field string, obj object.Object) (*swissAddress, error) {
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, fmt.Errorf("%s: %s", field, errObj.Message().Value())
+	}
+	for _, k := range m.SortedKeys() {
+		switch k {
+		case "name", "street", "building_number", "postal_code", "town", "country":
+		default:
+			return nil, fmt.Errorf("%s: unknown field %s", field, k)
+		}
+	}
+	a := &swissAddress{}
+	var err error
+	for _, f := range []struct {
+		key      string
+		dest     *string
+		maxLen   int
+		required bool
+	}{
+		{"name", &a.name, 70, true},
+		{"street", &a.street, 70, false},
+		{"building_number", &a.buildingNumber, 16, false},
+		{"postal_code", &a.postalCode, 16, true},
+		{"town", &a.town, 35, true},
+		{"country", &a.country, 2, true},
+	} {
+		if *f.dest, err = swissString(m, f.key, f.maxLen, f.required); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	a.country = strings.ToUpper(a.country)
+	if len(a.country) != 2 {
+		return nil, fmt.Errorf("%s: country must be a two letter country code", field)
+	}
+	return a, nil
+}
+
+// parseSwissPayment reads and validates the payment data map.
+func parseSwissPayment(obj object.Object) (*swissPayment, error) {
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, fmt.Errorf("%s", errObj.Message().Value())
+	}
+	for _, k := range m.SortedKeys() {
+		switch k {
+		case "iban", "creditor", "debtor", "amount", "currency", "reference", "message", "bill_information", "alternative_schemes":
+		default:
+			return nil, fmt.Errorf("unknown field %s", k)
+		}
+	}
+	sp := &swissPayment{}
+	iban, err := swissString(m, "iban", 34, true)
+	if err != nil {
+		return nil, err
+	}
+	if sp.iban, err = checkIBAN(iban); err != nil {
+		return nil, err
+	}
+	if m.Get("creditor") == object.Nil {
+		return nil, fmt.Errorf("creditor is required")
+	}
+	creditor, err := parseSwissAddress("creditor", m.Get("creditor"))
+	if err != nil {
+		return nil, err
+	}
+	sp.creditor = *creditor
+	if d := m.Get("debtor"); d != object.Nil {
+		if sp.debtor, err = parseSwissAddress("debtor", d); err != nil {
+			return nil, err
+		}
+	}
+	switch a := m.Get("amount").(type) {
+	case *object.NilType:
+	case *object.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(a.Value()), 64)
+		if err != nil {
+			return nil, fmt.Errorf("the amount %q is not a number", a.Value())
+		}
+		sp.amount = strconv.FormatFloat(f, 'f', 2, 64)
+	case *object.Int, *object.Float:
+		f, _ := object.AsFloat(a)
+		sp.amount = strconv.FormatFloat(f, 'f', 2, 64)
+	default:
+		return nil, fmt.Errorf("amount expects a number, got %s", a.Type())
+	}
+	if sp.amount != "" {
+		if f, _ := strconv.ParseFloat(sp.amount, 64); f < 0.01 || f > 999999999.99 {
+			return nil, fmt.Errorf("the amount must be between 0.01 and 999999999.99")
+		}
+	}
+	if sp.currency, err = swissString(m, "currency", 3, false); err != nil {
+		return nil, err
+	}
+	switch sp.currency = strings.ToUpper(sp.currency); sp.currency {
+	case "":
+		sp.currency = "CHF"
+	case "CHF", "EUR":
+	default:
+		return nil, fmt.Errorf("the currency must be CHF or EUR, got %s", sp.currency)
+	}
+	ref, err := swissString(m, "reference", 35, false)
+	if err != nil {
+		return nil, err
+	}
+	if sp.refType, sp.reference, err = checkReference(ref, isQRIBAN(sp.iban)); err != nil {
+		return nil, err
+	}
+	if sp.message, err = swissString(m, "message", 140, false); err != nil {
+		return nil, err
+	}
+	if sp.billInformation, err = swissString(m, "bill_information", 140, false); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(sp.message)+utf8.RuneCountInString(sp.billInformation) > 140 {
+		return nil, fmt.Errorf("message and bill_information together are longer than 140 characters")
+	}
+	if alt := m.Get("alternative_schemes"); alt != object.Nil {
+		if sp.altSchemes, errObj = object.AsStringSlice(alt); errObj != nil {
+			return nil, fmt.Errorf("alternative_schemes: %s", errObj.Message().Value())
+		}
+		if len(sp.altSchemes) > 2 {
+			return nil, fmt.Errorf("at most two alternative_schemes are allowed")
+		}
+		for _, s := range sp.altSchemes {
+			if utf8.RuneCountInString(s) > 100 {
+				return nil, fmt.Errorf("an alternative scheme is longer than 100 characters")
+			}
+		}
+	}
+	return sp, nil
+}
+
+// swissQRNode returns the Swiss QR code of the payment with the Swiss cross
+// in the center. size is the width without the quiet zone.
+func swissQRNode(sp *swissPayment, size bag.ScaledPoint, quietZone int) (*rnode.Node, error) {
+	m, err := encodeQR(sp.payload(), qrLevelM)
+	if err != nil {
+		return nil, err
+	}
+	// version 25 has 117 modules
+	if len(m) > 117 {
+		return nil, fmt.Errorf("the data is too long for a Swiss QR code")
+	}
+	s := newMatrixSymbol(m, quietZone)
+	// The cross is 7mm wide on a 46mm symbol. In the units of the
+	// cross (19.8 units) the black square has a white border of 0.7
+	// units and the arms of the white cross are 3.3 units wide and 11
+	// units long.
+	n := float64(len(m))
+	unit := 7.0 / 46.0 * n / 19.8
+	offset := float64(quietZone) + n/2 - 9.9*unit
+	s.extra = fmt.Sprintf("1 0 0 1 %s %s cm %s 0 0 %s 0 0 cm 1 g 0 0 19.8 19.8 re f 0 g 0.7 0.7 18.4 18.4 re f 1 g 8.25 4.4 3.3 11 re 4.4 8.25 11 3.3 re f",
+		num(offset), num(offset), num(unit), num(unit))
+	return &rnode.Node{Value: s.toNode(size/bag.ScaledPoint(len(m)), nil)}, nil
+}
+
+// swissQR implements barcode.swiss_qr(data[, {size, quiet_zone}]). The data
+// map has the fields iban, creditor, debtor, amount, currency, reference,
+// message, bill_information and alternative_schemes. The addresses are maps
+// with name, street, building_number, postal_code, town and country. size
+// defaults to 46mm, the quiet zone to four modules.
+func swissQR(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("barcode.swiss_qr", 1, 2, len(args))
+	}
+	opts := &options{quietZone: -1}
+	if len(args) == 2 {
+		var errObj *object.Error
+		if opts, errObj = parseOptions("barcode.swiss_qr", args[1], "size", "quiet_zone"); errObj != nil {
+			return errObj
+		}
+	}
+	sp, err := parseSwissPayment(args[0])
+	if err != nil {
+		return object.Errorf("barcode.swiss_qr(): %s", err)
+	}
+	size := opts.size
+	if size == 0 {
+		size = bag.MustSP("46mm")
+	}
+	qz := 4
+	if opts.quietZone >= 0 {
+		qz = opts.quietZone
+	}
+	n, err := swissQRNode(sp, size, qz)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+package barcode
+
+import "testing"
+
+func TestCheckIBAN(t *testing.T) {
+	testdata := []struct {
+		iban string
+		want string
+		ok   bool
+	}{
+		{"CH44 3199 9123 0008 8901 2", "CH4431999123000889012", true},
+		{"ch5800791123000889012", "CH5800791123000889012", true},
+		{"CH4431999123000889013", "", false},
+		{"DE89370400440532013000", "", false},
+	}
+	for _, td := range testdata {
+		got, err := checkIBAN(td.iban)
+		if (err == nil) != td.ok || got != td.want {
+			t.Errorf("checkIBAN(%q) = %q, %v", td.iban, got, err)
+		}
+	}
+}
+
+func TestCheckReference(t *testing.T) {
+	testdata := []struct {
+		ref     string
+		qrIBAN  bool
+		refType string
+		ok      bool
+	}{
+		{"21 00000 00003 13947 14300 09017", true, "QRR", true},
+		{"210000000003139471430009018", true, "", false},
+		{"", true, "", false},
+		{"RF18 5390 0754 7034", false, "SCOR", true},
+		{"RF19539007547034", false, "", false},
+		{"", false, "NON", true},
+		{"210000000003139471430009017", false, "", false},
+	}
+	for _, td := range testdata {
+		refType, _, err := checkReference(td.ref, td.qrIBAN)
+		if (err == nil) != td.ok || refType != td.refType {
+			t.Errorf("checkReference(%q, %t) = %q, %v", td.ref, td.qrIBAN, refType, err)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	testdata := []struct{ amount, want string }{
+		{"1.50", "1.50"},
+		{"949.75", "949.75"},
+		{"1949.75", "1 949.75"},
+		{"1234567.00", "1 234 567.00"},
+	}
+	for _, td := range testdata {
+		if got := formatAmount(td.amount); got != td.want {
+			t.Errorf("formatAmount(%q) = %q, want %q", td.amount, got, td.want)
+		}
+	}
+}
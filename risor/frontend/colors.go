@@ -0,0 +1,297 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	pdf "github.com/boxesandglue/baseline-pdf"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	"github.com/risor-io/risor/object"
+)
+
+// Spot colors are written as Separation color spaces with the alternate color
+// as the color of the full tint. Spot colors with a tint below 1 get an Indexed
+// color space on top of the separation, because the PDF code of a spot color
+// always selects the color value 1.
+
+// spotColorIDOffset is added to the IDs of the spot color spaces, so they
+// don't collide with the spot colors of the predefined color table.
+const spotColorIDOffset = 1000
+
+// spotColor holds the information about a spot color that the color itself
+// does not store.
+type spotColor struct {
+	tint      float64
+	alternate *color.Color
+}
+
+// colorComponents reads n color values between 0 and 1 from a list (or a
+// single number if n is 1).
+func colorComponents(obj object.Object, n int) ([]float64, error) {
+	items := []object.Object{obj}
+	if lst, ok := obj.(*object.List); ok {
+		items = lst.Value()
+	}
+	if len(items) != n {
+		return nil, fmt.Errorf("expected %d color values, got %d", n, len(items))
+	}
+	values := make([]float64, n)
+	for i, item := range items {
+		f, err := toFloat(item)
+		if err != nil {
+			return nil, err
+		}
+		if f < 0 || f > 1 {
+			return nil, fmt.Errorf("color value %g is not between 0 and 1", f)
+		}
+		values[i] = f
+	}
+	return values, nil
+}
+
+// parseColorSpec returns the color of a color specification. A specification
+// is a color, a color name or HTML color (#rgb, #rrggbb, rgb(...)) or a map
+// with one of the keys rgb ([r, g, b] or [r, g, b, a]), cmyk ([c, m, y, k]),
+// gray (a number) or spot (the name of the spot color) with the keys alternate
+// (the color of the full tint in a process color space) and tint. The color
+// values are between 0 and 1. spot is nil for process colors.
+func (fd *frontendDocument) parseColorSpec(obj object.Object) (col *color.Color, spot *spotColor, err error) {
+	switch t := obj.(type) {
+	case *rcolor.RColor:
+		return t.Value, fd.spotColors[t.Value], nil
+	case *object.String:
+		if col = fd.value.GetColor(t.Value()); col == nil {
+			return nil, nil, fmt.Errorf("unknown color %q", t.Value())
+		}
+		return col, fd.spotColors[col], nil
+	case *object.Map:
+		m := t.Value()
+		col = &color.Color{A: 1}
+		var spotName string
+		for _, k := range t.SortedKeys() {
+			v := m[k]
+			var values []float64
+			switch k {
+			case "rgb":
+				n := 3
+				if lst, ok := v.(*object.List); ok && lst.Len().Value() == 4 {
+					n = 4
+				}
+				if values, err = colorComponents(v, n); err != nil {
+					return nil, nil, fmt.Errorf("rgb: %w", err)
+				}
+				if n == 4 {
+					col.A = values[3]
+				}
+				col.Space = color.ColorRGB
+				col.R, col.G, col.B = values[0], values[1], values[2]
+			case "cmyk":
+				if values, err = colorComponents(v, 4); err != nil {
+					return nil, nil, fmt.Errorf("cmyk: %w", err)
+				}
+				col.Space = color.ColorCMYK
+				col.C, col.M, col.Y, col.K = values[0], values[1], values[2], values[3]
+			case "gray":
+				if values, err = colorComponents(v, 1); err != nil {
+					return nil, nil, fmt.Errorf("gray: %w", err)
+				}
+				col.Space = color.ColorGray
+				col.G = values[0]
+			case "spot":
+				s, errObj := object.AsString(v)
+				if errObj != nil {
+					return nil, nil, fmt.Errorf("spot: %w", errObj.Value())
+				}
+				if s == "" {
+					return nil, nil, fmt.Errorf("spot: empty name")
+				}
+				spotName = s
+			case "alternate", "tint":
+				// read with spot
+			default:
+				return nil, nil, fmt.Errorf("unknown color key %s", k)
+			}
+		}
+		if spotName == "" {
+			if _, ok := m["alternate"]; ok {
+				return nil, nil, fmt.Errorf("alternate is only allowed for spot colors")
+			}
+			if _, ok := m["tint"]; ok {
+				return nil, nil, fmt.Errorf("tint is only allowed for spot colors")
+			}
+			if col.Space == color.ColorNone || len(m) != 1 {
+				return nil, nil, fmt.Errorf("expected exactly one of rgb, cmyk, gray or spot")
+			}
+			return col, nil, nil
+		}
+		if len(m) > 3 || col.Space != color.ColorNone {
+			return nil, nil, fmt.Errorf("spot colors have the keys spot, alternate and tint")
+		}
+		spot = &spotColor{tint: 1}
+		altObj, ok := m["alternate"]
+		if !ok {
+			return nil, nil, fmt.Errorf("spot color %s needs an alternate color", spotName)
+		}
+		alt, altSpot, err := fd.parseColorSpec(altObj)
+		if err != nil {
+			return nil, nil, fmt.Errorf("alternate: %w", err)
+		}
+		if altSpot != nil || alt.Space == color.ColorNone || alt.Space == color.ColorSpotcolor {
+			return nil, nil, fmt.Errorf("alternate: expected an rgb, cmyk or gray color")
+		}
+		spot.alternate = alt
+		if tint, ok := m["tint"]; ok {
+			values, err := colorComponents(tint, 1)
+			if err != nil {
+				return nil, nil, fmt.Errorf("tint: %w", err)
+			}
+			if values[0] == 0 {
+				return nil, nil, fmt.Errorf("tint must be greater than 0")
+			}
+			spot.tint = values[0]
+		}
+		col = &color.Color{
+			Space:     color.ColorSpotcolor,
+			Basecolor: spotName,
+			C:         alt.C, M: alt.M, Y: alt.Y, K: alt.K,
+			R: alt.R, G: alt.G, B: alt.B,
+			A: 1,
+		}
+		if err = fd.addSpotColor(col, spot); err != nil {
+			return nil, nil, err
+		}
+		return col, spot, nil
+	}
+	return nil, nil, fmt.Errorf("expected a color, a color name or a map, got %s", obj.Type())
+}
+
+// pdfName returns s as a PDF name with the delimiters and the characters
+// outside of the printable ASCII range escaped.
+func pdfName(s string) string {
+	var b strings.Builder
+	b.WriteString("/")
+	for _, c := range []byte(s) {
+		if c < '!' || c > '~' || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// separation is the color space of a spot color ink.
+type separation struct {
+	obj       pdf.Objectnumber
+	alternate color.Color
+}
+
+// separationSpace returns the Separation color space of the spot color name. The
+// color space is written when it is first requested. Spot colors with the
+// same name share one separation, so they are printed on the same plate.
+func (fd *frontendDocument) separationSpace(name string, alt *color.Color) (*separation, error) {
+	if sep, ok := fd.separations[name]; ok {
+		if sep.alternate != *alt {
+			return nil, fmt.Errorf("spot color %s is already defined with a different alternate color", name)
+		}
+		return sep, nil
+	}
+	var space string
+	var c0, c1 pdf.Array
+	switch alt.Space {
+	case color.ColorRGB:
+		space, c0, c1 = "/DeviceRGB", pdf.Array{1, 1, 1}, pdf.Array{alt.R, alt.G, alt.B}
+	case color.ColorCMYK:
+		space, c0, c1 = "/DeviceCMYK", pdf.Array{0, 0, 0, 0}, pdf.Array{alt.C, alt.M, alt.Y, alt.K}
+	case color.ColorGray:
+		space, c0, c1 = "/DeviceGray", pdf.Array{1}, pdf.Array{alt.G}
+	}
+	obj := fd.value.Doc.PDFWriter.NewObject()
+	obj.Array = []any{
+		"/Separation",
+		pdfName(name),
+		space,
+		pdf.Dict{
+			"C0":           pdf.Serialize(c0),
+			"C1":           pdf.Serialize(c1),
+			"Domain":       "[ 0 1 ]",
+			"FunctionType": "2",
+			"N":            "1",
+		},
+	}
+	if err := obj.Save(); err != nil {
+		return nil, err
+	}
+	sep := &separation{obj: obj.ObjectNumber, alternate: *alt}
+	if fd.separations == nil {
+		fd.separations = map[string]*separation{}
+	}
+	fd.separations[name] = sep
+	return sep, nil
+}
+
+// addSpotColor writes the color space of the spot color and sets the ID of the
+// color space in col.
+func (fd *frontendDocument) addSpotColor(col *color.Color, spot *spotColor) error {
+	sep, err := fd.separationSpace(col.Basecolor, spot.alternate)
+	if err != nil {
+		return err
+	}
+	pw := fd.value.Doc.PDFWriter
+	onum := sep.obj
+	if spot.tint < 1 {
+		obj := pw.NewObject()
+		obj.Array = []any{"/Indexed", sep.obj, 1, fmt.Sprintf("<00%02X>", int(math.Round(spot.tint*255)))}
+		if err := obj.Save(); err != nil {
+			return err
+		}
+		onum = obj.ObjectNumber
+	}
+	col.SpotcolorID = spotColorIDOffset + len(pw.Colorspaces) + 1
+	pw.Colorspaces = append(pw.Colorspaces, &pdf.Separation{
+		Obj:  onum,
+		ID:   fmt.Sprintf("/CS%d", col.SpotcolorID),
+		Name: col.Basecolor,
+	})
+	if fd.spotColors == nil {
+		fd.spotColors = map[*color.Color]*spotColor{}
+	}
+	fd.spotColors[col] = spot
+	return nil
+}
+
+// toRColor returns the color object of col including the spot color
+// information.
+func (fd *frontendDocument) toRColor(col *color.Color) *rcolor.RColor {
+	rc := &rcolor.RColor{Value: col}
+	if spot, ok := fd.spotColors[col]; ok {
+		rc.Tint = spot.tint
+		rc.Alternate = spot.alternate
+	}
+	return rc
+}
+
+// defineColor implements f.define_color(name, spec). See parseColorSpec for
+// the color specification. The color can be used by name in text settings,
+// table cells and the other places that accept a color name.
+func (fd *frontendDocument) defineColor(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgsError("frontend.define_color", 2, len(args))
+	}
+	name, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	if name == "" {
+		return object.ArgsErrorf("frontend.define_color(): empty color name")
+	}
+	col, _, err := fd.parseColorSpec(args[1])
+	if err != nil {
+		return object.ArgsErrorf("frontend.define_color(): %s", err)
+	}
+	fd.value.DefineColor(name, col)
+	return fd.toRColor(col)
+}
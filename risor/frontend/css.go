@@ -0,0 +1,360 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/risor-io/risor/object"
+	"github.com/risor-io/risor/op"
+	"golang.org/x/net/html"
+)
+
+// FrontendCSSType is the type name of a parsed style sheet.
+const FrontendCSSType = "frontend.css"
+
+// cssSelectorPart is a compound selector such as p.intro or #main.
+type cssSelectorPart struct {
+	element string
+	id      string
+	classes []string
+}
+
+// cssRule is a single selector with its declarations. A rule with a selector
+// list (h1, h2 {...}) is split into several rules.
+type cssRule struct {
+	// The compound selectors from left to right, separated by descendant
+	// combinators.
+	parts        []cssSelectorPart
+	specificity  int
+	order        int
+	declarations [][2]string
+}
+
+// stylesheet is a list of CSS rules.
+type stylesheet struct {
+	rules []cssRule
+}
+
+// parseCSS parses the style sheet. At-rules are ignored.
+func parseCSS(str string) (*stylesheet, error) {
+	ss := &stylesheet{}
+	if err := ss.add(str); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// add appends the rules of str to the style sheet. Later rules win over
+// earlier rules with the same specificity.
+func (ss *stylesheet) add(str string) error {
+	str = stripCSSComments(str)
+	for {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			return nil
+		}
+		open := strings.IndexByte(str, '{')
+		if open == -1 {
+			return fmt.Errorf("css: missing { in %q", str)
+		}
+		closing := matchingBrace(str, open)
+		if closing == -1 {
+			return fmt.Errorf("css: missing } in %q", str)
+		}
+		selectors := strings.TrimSpace(str[:open])
+		body := str[open+1 : closing]
+		str = str[closing+1:]
+		if strings.HasPrefix(selectors, "@") {
+			continue
+		}
+		decls := parseCSSDeclarations(body)
+		for _, sel := range strings.Split(selectors, ",") {
+			rule, err := parseCSSSelector(strings.TrimSpace(sel))
+			if err != nil {
+				return err
+			}
+			rule.order = len(ss.rules)
+			rule.declarations = decls
+			ss.rules = append(ss.rules, *rule)
+		}
+	}
+}
+
+func stripCSSComments(str string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(str, "/*")
+		if start == -1 {
+			b.WriteString(str)
+			return b.String()
+		}
+		b.WriteString(str[:start])
+		end := strings.Index(str[start+2:], "*/")
+		if end == -1 {
+			return b.String()
+		}
+		str = str[start+2+end+2:]
+	}
+}
+
+func matchingBrace(str string, open int) int {
+	level := 0
+	for i := open; i < len(str); i++ {
+		switch str[i] {
+		case '{':
+			level++
+		case '}':
+			level--
+			if level == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseCSSDeclarations parses the declarations of a rule or a style
+// attribute. The property names are returned in lower case. Important values
+// keep the suffix " !important", see cascade.
+func parseCSSDeclarations(str string) [][2]string {
+	var decls [][2]string
+	for _, decl := range strings.Split(str, ";") {
+		prop, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.ToLower(strings.TrimSpace(prop))
+		val, important := splitImportant(val)
+		if prop != "" && val != "" {
+			if important {
+				val += " !important"
+			}
+			decls = append(decls, [2]string{prop, val})
+		}
+	}
+	return decls
+}
+
+// splitImportant returns the value without the !important annotation and
+// true if the annotation is present.
+func splitImportant(val string) (string, bool) {
+	val = strings.TrimSpace(val)
+	if len(val) < len("important") || !strings.EqualFold(val[len(val)-len("important"):], "important") {
+		return val, false
+	}
+	rest := strings.TrimSpace(val[:len(val)-len("important")])
+	if !strings.HasSuffix(rest, "!") {
+		return val, false
+	}
+	return strings.TrimSpace(strings.TrimSuffix(rest, "!")), true
+}
+
+// cascade takes the declarations in the order of ascending precedence and
+// moves the important declarations behind the normal ones, so they win over
+// all normal declarations. The !important annotation is removed.
+func cascade(decls [][2]string) [][2]string {
+	ret := make([][2]string, 0, len(decls))
+	var important [][2]string
+	for _, decl := range decls {
+		if val, ok := splitImportant(decl[1]); ok {
+			important = append(important, [2]string{decl[0], val})
+		} else {
+			ret = append(ret, decl)
+		}
+	}
+	return append(ret, important...)
+}
+
+func parseCSSSelector(sel string) (*cssRule, error) {
+	if sel == "" {
+		return nil, fmt.Errorf("css: empty selector")
+	}
+	rule := &cssRule{}
+	for _, compound := range strings.Fields(sel) {
+		if strings.ContainsAny(compound, ">+~[:") {
+			return nil, fmt.Errorf("css: unsupported selector %q", sel)
+		}
+		part := cssSelectorPart{}
+		rest := compound
+		for rest != "" {
+			end := strings.IndexAny(rest[1:], ".#") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			tok := rest[:end]
+			rest = rest[end:]
+			switch tok[0] {
+			case '.':
+				part.classes = append(part.classes, tok[1:])
+				rule.specificity += 10
+			case '#':
+				part.id = tok[1:]
+				rule.specificity += 100
+			default:
+				if tok != "*" {
+					part.element = strings.ToLower(tok)
+					rule.specificity++
+				}
+			}
+		}
+		rule.parts = append(rule.parts, part)
+	}
+	return rule, nil
+}
+
+func (part cssSelectorPart) matches(n *html.Node) bool {
+	if part.element != "" && part.element != n.Data {
+		return false
+	}
+	if part.id != "" && htmlAttribute(n, "id") != part.id {
+		return false
+	}
+	if len(part.classes) > 0 {
+		classes := strings.Fields(htmlAttribute(n, "class"))
+		for _, c := range part.classes {
+			found := false
+			for _, nc := range classes {
+				if nc == c {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches returns true if the element n is selected by the rule.
+func (rule *cssRule) matches(n *html.Node) bool {
+	i := len(rule.parts) - 1
+	if !rule.parts[i].matches(n) {
+		return false
+	}
+	i--
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if p.Type == html.ElementNode && rule.parts[i].matches(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+// declarations returns the declarations for the element n in the order of
+// ascending precedence.
+func (ss *stylesheet) declarations(n *html.Node) [][2]string {
+	var matching []*cssRule
+	for i := range ss.rules {
+		if ss.rules[i].matches(n) {
+			matching = append(matching, &ss.rules[i])
+		}
+	}
+	sort.SliceStable(matching, func(a, b int) bool {
+		if matching[a].specificity != matching[b].specificity {
+			return matching[a].specificity < matching[b].specificity
+		}
+		return matching[a].order < matching[b].order
+	})
+	var decls [][2]string
+	for _, r := range matching {
+		decls = append(decls, r.declarations...)
+	}
+	return decls
+}
+
+func htmlAttribute(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func frontendLoadCSS(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.ArgsErrorf("frontend.load_css() takes exactly one argument")
+	}
+	filename, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return object.NewError(err)
+	}
+	ss, err := parseCSS(string(data))
+	if err != nil {
+		return object.NewError(err)
+	}
+	return ss
+}
+
+// Type of the object.
+func (ss *stylesheet) Type() object.Type {
+	return FrontendCSSType
+}
+
+// Inspect returns a string representation of the given object.
+func (ss *stylesheet) Inspect() string {
+	return fmt.Sprintf("css (%d rules)", len(ss.rules))
+}
+
+// Interface converts the given object to a native Go value.
+func (ss *stylesheet) Interface() interface{} {
+	return ss
+}
+
+// Equals returns True if the given object is equal to this object.
+func (ss *stylesheet) Equals(other object.Object) object.Object {
+	return object.NewBool(ss == other)
+}
+
+// GetAttr returns the attribute with the given name from this object.
+func (ss *stylesheet) GetAttr(name string) (object.Object, bool) {
+	switch name {
+	case "add":
+		return object.NewBuiltin("frontend.css.add", func(ctx context.Context, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.ArgsErrorf("frontend.css.add() takes exactly one argument")
+			}
+			str, errObj := object.AsString(args[0])
+			if errObj != nil {
+				return errObj
+			}
+			if err := ss.add(str); err != nil {
+				return object.NewError(err)
+			}
+			return ss
+		}), true
+	case "rules":
+		return object.NewInt(int64(len(ss.rules))), true
+	}
+	return nil, false
+}
+
+// SetAttr sets the attribute with the given name on this object.
+func (ss *stylesheet) SetAttr(name string, value object.Object) error {
+	return object.Errorf("cannot set attribute %s on css", name)
+}
+
+// IsTruthy returns true if the object is considered "truthy".
+func (ss *stylesheet) IsTruthy() bool {
+	return true
+}
+
+// RunOperation runs an operation on this object with the given
+// right-hand side object.
+func (ss *stylesheet) RunOperation(opType op.BinaryOpType, right object.Object) object.Object {
+	return object.Errorf("operation %s not supported on css", opType)
+}
+
+// Cost returns the incremental processing cost of this object.
+func (ss *stylesheet) Cost() int {
+	return 0
+}
@@ -0,0 +1,72 @@
+package frontend
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	rpdfdraw "github.com/boxesandglue/cli/risor/frontend/pdfdraw"
+)
+
+// Drawings with transparency or gradients need resources that the pages can't
+// have. The draw module writes them to PDF files and puts invisible rules into
+// the node lists which are replaced by image nodes of these files before the
+// page is shipped out.
+
+// placeDrawings is called before each page shipout and replaces the rules of
+// the drawings on the page by images.
+func (fd *frontendDocument) placeDrawings(page *document.Page) {
+	for _, objects := range [][]document.Object{page.Background, page.Objects} {
+		for _, obj := range objects {
+			fd.replaceDrawings(obj.Vlist)
+		}
+	}
+}
+
+// replaceDrawings replaces the drawing rules in the vlists of n and its sub
+// lists. An image in a vlist is placed at the top of the vlist, which is where
+// the rules are.
+func (fd *frontendDocument) replaceDrawings(n node.Node) {
+	switch t := n.(type) {
+	case *node.HList:
+		for e := t.List; e != nil; e = e.Next() {
+			fd.replaceDrawings(e)
+		}
+	case *node.VList:
+		for e := t.List; e != nil; e = e.Next() {
+			r, ok := e.(*node.Rule)
+			if !ok {
+				fd.replaceDrawings(e)
+				continue
+			}
+			img, ok := r.Attributes[rpdfdraw.ImageAttribute].(*rpdfdraw.Image)
+			if !ok {
+				continue
+			}
+			imgNode, err := fd.drawingImage(img)
+			if err != nil {
+				bag.Logger.Error("Cannot place drawing", "filename", img.Filename, "error", err)
+				continue
+			}
+			t.List = node.InsertBefore(t.List, r, imgNode)
+			t.List = node.DeleteFromList(t.List, r)
+			e = imgNode
+		}
+	}
+}
+
+// drawingImage returns an image node for the drawing file.
+func (fd *frontendDocument) drawingImage(img *rpdfdraw.Image) (*node.Image, error) {
+	imgf, err := fd.value.Doc.LoadImageFile(img.Filename)
+	if err != nil {
+		return nil, err
+	}
+	imgNode := fd.value.Doc.CreateImageNodeFromImagefile(imgf, 1, "/MediaBox")
+	if imgNode == nil {
+		return nil, fmt.Errorf("cannot get the size of the drawing")
+	}
+	imgNode.Width = img.Width
+	imgNode.Height = img.Height
+	return imgNode, nil
+}
@@ -0,0 +1,691 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rdocument "github.com/boxesandglue/cli/risor/backend/document"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// flowItem is an element of the vertical material that gets distributed over
+// the pages.
+type flowItem struct {
+	// n is nil for an implicit breakpoint between two boxes.
+	n node.Node
+	// breakable is true if a page break is allowed at this item.
+	breakable bool
+	penalty   int
+	// The notes of the footnote marks and margin note marks in n.
+	footnotes   []*flowFootnote
+	marginNotes []*flowMarginNote
+	// table is set for the body rows of a table and the breakpoints
+	// between them.
+	table *tableInfo
+}
+
+// flowFootnote is a footnote formatted with the column width.
+type flowFootnote struct {
+	items  []flowItem
+	height bag.ScaledPoint
+}
+
+// flowMarginNote is a margin note formatted with the margin width.
+type flowMarginNote struct {
+	vl   *node.VList
+	side string
+}
+
+var (
+	// The space between the text and the footnote rule.
+	footnoteSkip = bag.MustSP("6pt")
+	// The space between the footnote rule and the footnotes.
+	footnoteRuleSkip  = bag.MustSP("3pt")
+	footnoteRuleWidth = bag.MustSP("0.4pt")
+	// The distance between a margin note and the text area and the page
+	// edge.
+	marginNoteGap = bag.MustSP("6pt")
+)
+
+func footnoteSeparatorHeight() bag.ScaledPoint {
+	return footnoteSkip + footnoteRuleWidth + footnoteRuleSkip
+}
+
+// footnoteSeparator returns the space and the rule above the footnotes.
+func footnoteSeparator(width bag.ScaledPoint) node.Node {
+	var head node.Node
+	g := node.NewGlue()
+	g.Width = footnoteSkip
+	head = g
+	r := node.NewRule()
+	r.Width = width / 3
+	r.Height = footnoteRuleWidth
+	r.Attributes = node.H{"origin": "footnote rule"}
+	head = node.InsertAfter(head, g, r)
+	g2 := node.NewGlue()
+	g2.Width = footnoteRuleSkip
+	node.InsertAfter(head, r, g2)
+	return head
+}
+
+// itemsHeight returns the height of the items with a footnote separator.
+func itemsHeight(items []flowItem) bag.ScaledPoint {
+	if len(items) == 0 {
+		return 0
+	}
+	h := footnoteSeparatorHeight()
+	for _, it := range items {
+		h += it.height()
+	}
+	return h
+}
+
+func (fi flowItem) discardable() bool {
+	switch fi.n.(type) {
+	case nil, *node.Glue, *node.Kern, *node.Penalty:
+		return true
+	}
+	return false
+}
+
+// headerHeight returns the height of the table header that is repeated when
+// a page or column starts with the item.
+func (fi flowItem) headerHeight() bag.ScaledPoint {
+	if fi.table != nil && fi.n != nil {
+		return fi.table.headerHeight
+	}
+	return 0
+}
+
+// footerHeight returns the height of the table footer that is repeated when
+// the page or column is broken at the item.
+func (fi flowItem) footerHeight() bag.ScaledPoint {
+	if fi.table != nil && fi.n == nil {
+		return fi.table.footerHeight
+	}
+	return 0
+}
+
+func (fi flowItem) height() bag.ScaledPoint {
+	switch t := fi.n.(type) {
+	case *node.Glue:
+		return t.Width
+	case *node.Kern:
+		return t.Kern
+	case *node.HList:
+		return t.Height + t.Depth
+	case *node.VList:
+		return t.Height + t.Depth
+	case *node.Image:
+		return t.Height
+	case *node.Rule:
+		return t.Height + t.Depth
+	}
+	return 0
+}
+
+// flowFlattener breaks vlists into their lines and adds the breakpoints.
+type flowFlattener struct {
+	fd      *frontendDocument
+	items   []flowItem
+	widows  int
+	orphans int
+	// The width of the footnotes and the margin notes.
+	footnoteWidth bag.ScaledPoint
+	marginWidth   map[string]bag.ScaledPoint
+	err           error
+}
+
+// addNotes formats the notes in n and attaches them to the item.
+func (ff *flowFlattener) addNotes(fi *flowItem) {
+	if ff.fd == nil {
+		return
+	}
+	fns, mns := collectNotes(fi.n)
+	for _, fn := range fns {
+		vl, err := ff.fd.formatNote(fn.body, ff.footnoteWidth)
+		if err != nil {
+			ff.err = err
+			return
+		}
+		inner := &flowFlattener{widows: 1, orphans: 1}
+		inner.add(vl)
+		fi.footnotes = append(fi.footnotes, &flowFootnote{items: inner.items, height: vl.Height + vl.Depth})
+	}
+	for _, mn := range mns {
+		width := ff.marginWidth[mn.side]
+		if width <= 0 {
+			ff.err = fmt.Errorf("frontend.flow(): the %s margin is too narrow for margin notes", mn.side)
+			return
+		}
+		vl, err := ff.fd.formatNote(mn.body, width)
+		if err != nil {
+			ff.err = err
+			return
+		}
+		fi.marginNotes = append(fi.marginNotes, &flowMarginNote{vl: vl, side: mn.side})
+	}
+}
+
+func (ff *flowFlattener) afterBox() bool {
+	return len(ff.items) > 0 && !ff.items[len(ff.items)-1].discardable()
+}
+
+// add appends n. The contents of vlists are added instead of the vlist, so a
+// page break can occur inside the vlist. Breaks between the lines of a
+// paragraph are not allowed if they leave less than orphans lines at the
+// bottom or less than widows lines at the top of a page.
+func (ff *flowFlattener) add(n node.Node) {
+	switch t := n.(type) {
+	case *node.Glue:
+		ff.items = append(ff.items, flowItem{n: t, breakable: ff.afterBox()})
+		return
+	case *node.Penalty:
+		ff.items = append(ff.items, flowItem{n: t, breakable: true, penalty: t.Penalty})
+		return
+	case *node.Kern:
+		ff.items = append(ff.items, flowItem{n: t})
+		return
+	}
+	vl, ok := n.(*node.VList)
+	if !ok || vl.ShiftX != 0 {
+		if ff.afterBox() {
+			ff.items = append(ff.items, flowItem{breakable: true})
+		}
+		fi := flowItem{n: n}
+		ff.addNotes(&fi)
+		ff.items = append(ff.items, fi)
+		return
+	}
+	if ti, ok := vl.Attributes[tableInfoAttribute].(*tableInfo); ok {
+		ff.addTable(vl, ti)
+		return
+	}
+	lines := 0
+	for e := vl.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*node.HList); ok && hl.Attributes["origin"] == "line" {
+			lines++
+		}
+	}
+	seen := 0
+	for e := vl.List; e != nil; {
+		next := e.Next()
+		switch t := e.(type) {
+		case *node.Glue:
+			fi := flowItem{n: t, breakable: ff.afterBox()}
+			if seen > 0 && seen < lines && (seen < ff.orphans || lines-seen < ff.widows) {
+				fi.penalty = 10000
+			}
+			ff.items = append(ff.items, fi)
+		case *node.HList:
+			if t.Attributes["origin"] == "line" {
+				seen++
+			}
+			ff.add(t)
+		default:
+			ff.add(t)
+		}
+		e = next
+	}
+}
+
+// flowBadness rates a page with slack unused space of avail.
+func flowBadness(slack, avail bag.ScaledPoint) int {
+	if avail <= 0 {
+		return 10000
+	}
+	r := float64(slack) / float64(avail)
+	return min(int(10000*r*r*r), 10000)
+}
+
+// nextBreak returns the index of the best page break for the items starting
+// at start. carry is the height of the footnotes that are already on the
+// page. The footnotes of the items must fit on the page, only the last
+// footnote may be split. The repeated table header and footer rows must fit,
+// too. ok is false if the items up to the first legal breakpoint do not fit
+// into avail.
+func nextBreak(items []flowItem, start int, avail, carry bag.ScaledPoint) (idx int, ok bool) {
+	best, bestCost := -1, 0
+	var h bag.ScaledPoint
+	if start < len(items) {
+		h = items[start].headerHeight()
+	}
+	fh := carry
+	for i := start; i < len(items); i++ {
+		it := items[i]
+		if it.breakable && i > start && h+fh+it.footerHeight() <= avail && it.penalty < 10000 {
+			if it.penalty <= -10000 {
+				return i, true
+			}
+			if cost := flowBadness(avail-h-fh-it.footerHeight(), avail) + it.penalty; best == -1 || cost <= bestCost {
+				best, bestCost = i, cost
+			}
+		}
+		h += it.height()
+		for _, fn := range it.footnotes {
+			need := fn.height
+			if fh == 0 {
+				need += footnoteSeparatorHeight()
+			}
+			if h+fh+need > avail && len(fn.items) > 0 {
+				// split the footnote if the first line fits
+				if first := need - fn.height + fn.items[0].height(); h+fh+first <= avail {
+					if j, ok := breakAfter(items, i, avail-h-fh-first); ok {
+						return j, true
+					}
+				}
+			}
+			fh += need
+		}
+		if h+fh > avail && best != -1 {
+			return best, true
+		}
+	}
+	if h+fh <= avail {
+		return len(items), true
+	}
+	// Overfull page: break at the first legal breakpoint.
+	for i := start + 1; i < len(items); i++ {
+		if items[i].breakable && items[i].penalty < 10000 {
+			return i, false
+		}
+	}
+	return len(items), false
+}
+
+// breakAfter returns the first breakpoint after item i if it is allowed and
+// the items up to the breakpoint fit into room.
+func breakAfter(items []flowItem, i int, room bag.ScaledPoint) (int, bool) {
+	for j := i + 1; j < len(items); j++ {
+		if items[j].breakable {
+			return j, items[j].penalty < 10000 && items[j].footerHeight() <= room
+		}
+		if room -= items[j].height(); room < 0 {
+			return 0, false
+		}
+	}
+	return len(items), true
+}
+
+// skipDiscardable returns the index of the first item at or after start that
+// is not discarded at the top of a page or column.
+func skipDiscardable(items []flowItem, start int) int {
+	for start < len(items) && items[start].discardable() {
+		start++
+	}
+	return start
+}
+
+// fitsColumns returns true if all items starting at start fit into columns
+// columns of the height avail. carry is the height of the footnotes in the
+// first column.
+func fitsColumns(items []flowItem, start, columns int, avail, carry bag.ScaledPoint) bool {
+	for c := 0; c < columns; c++ {
+		if start = skipDiscardable(items, start); start >= len(items) {
+			return true
+		}
+		end, ok := nextBreak(items, start, avail, carry)
+		if !ok {
+			return false
+		}
+		start = end
+		carry = 0
+	}
+	return skipDiscardable(items, start) >= len(items)
+}
+
+// balancedHeight returns the smallest column height that lets the items
+// starting at start fit into the columns.
+func balancedHeight(items []flowItem, start, columns int, avail, carry bag.ScaledPoint) bag.ScaledPoint {
+	lo, hi := bag.ScaledPoint(0), avail
+	for hi-lo > bag.Factor/10 {
+		mid := (lo + hi) / 2
+		if fitsColumns(items, start, columns, mid, carry) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+// packItems returns a vlist with the items between start and end. The
+// discardable items at the end are dropped. If the items start or end inside
+// of a table, copies of the header or footer rows are added.
+func packItems(items []flowItem, start, end int) *node.VList {
+	var head, tail node.Node
+	add := func(n node.Node) {
+		n.SetPrev(nil)
+		n.SetNext(nil)
+		head = node.InsertAfter(head, tail, n)
+		tail = n
+	}
+	if start < end && items[start].headerHeight() > 0 {
+		for _, hl := range items[start].table.header {
+			add(copyNode(hl))
+		}
+	}
+	brk := end
+	for end > start && items[end-1].discardable() {
+		end--
+	}
+	for _, it := range items[start:end] {
+		if it.n != nil {
+			add(it.n)
+		}
+	}
+	if brk < len(items) && items[brk].footerHeight() > 0 {
+		for _, hl := range items[brk].table.footer {
+			add(copyNode(hl))
+		}
+	}
+	return node.Vpack(head)
+}
+
+// flowOptions are the options of flow and column_width.
+type flowOptions struct {
+	master    *pageMaster
+	area      string
+	onNewPage object.Callable
+	widows    int
+	orphans   int
+	columns   int
+	columnGap bag.ScaledPoint
+	// The width of the rule between the columns, 0 for no rule.
+	ruleWidth bag.ScaledPoint
+	ruleColor *color.Color
+	// balance makes the columns of the last page equally high.
+	balance bool
+}
+
+func (fd *frontendDocument) parseFlowOptions(fn string, args []object.Object) (*flowOptions, *object.Error) {
+	fo := &flowOptions{
+		master:    fd.defaultPageMaster(),
+		area:      "text",
+		widows:    2,
+		orphans:   2,
+		columns:   1,
+		columnGap: 12 * bag.Factor,
+	}
+	if len(args) == 0 {
+		return fo, nil
+	}
+	opts, errObj := object.AsMap(args[0])
+	if errObj != nil {
+		return nil, errObj
+	}
+	for k, v := range opts.Value() {
+		switch k {
+		case "page_master":
+			var err error
+			if fo.master, err = fd.getPageMaster(v); err != nil {
+				return nil, object.ArgsErrorf("%s(): page_master: %s", fn, err)
+			}
+		case "area":
+			if fo.area, errObj = object.AsString(v); errObj != nil {
+				return nil, errObj
+			}
+		case "on_new_page":
+			cb, ok := v.(object.Callable)
+			if !ok {
+				return nil, object.ArgsErrorf("%s() expects a function (on_new_page)", fn)
+			}
+			fo.onNewPage = cb
+		case "widows", "orphans", "columns":
+			i, errObj := object.AsInt(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			switch k {
+			case "widows":
+				fo.widows = int(i)
+			case "orphans":
+				fo.orphans = int(i)
+			default:
+				if i < 1 {
+					return nil, object.ArgsErrorf("%s(): columns must be at least 1", fn)
+				}
+				fo.columns = int(i)
+			}
+		case "column_gap":
+			sp, err := convertSP(v)
+			if err != nil {
+				return nil, object.ArgsErrorf("%s(): column_gap: %s", fn, err)
+			}
+			fo.columnGap = sp.(bag.ScaledPoint)
+		case "column_rule":
+			// a width or a map with width and color
+			if m, ok := v.(*object.Map); ok {
+				fo.ruleWidth = bag.MustSP("0.5pt")
+				for rk, rv := range m.Value() {
+					switch rk {
+					case "width":
+						sp, err := convertSP(rv)
+						if err != nil {
+							return nil, object.ArgsErrorf("%s(): column_rule: %s", fn, err)
+						}
+						fo.ruleWidth = sp.(bag.ScaledPoint)
+					case "color":
+						col, err := convertColor(rv)
+						if err != nil {
+							return nil, object.ArgsErrorf("%s(): column_rule: %s", fn, err)
+						}
+						if str, ok := col.(string); ok {
+							if col = fd.value.GetColor(str); col.(*color.Color) == nil {
+								return nil, object.ArgsErrorf("%s(): column_rule: unknown color %s", fn, str)
+							}
+						}
+						fo.ruleColor = col.(*color.Color)
+					default:
+						return nil, object.ArgsErrorf("%s(): column_rule: unknown key %s", fn, rk)
+					}
+				}
+			} else {
+				sp, err := convertSP(v)
+				if err != nil {
+					return nil, object.ArgsErrorf("%s(): column_rule: %s", fn, err)
+				}
+				fo.ruleWidth = sp.(bag.ScaledPoint)
+			}
+		case "balance":
+			b, errObj := object.AsBool(v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			fo.balance = b
+		default:
+			return nil, object.ArgsErrorf("%s(): unknown option %s", fn, k)
+		}
+	}
+	return fo, nil
+}
+
+func (fo *flowOptions) columnWidth(area *pageArea) bag.ScaledPoint {
+	return (area.width - bag.ScaledPoint(fo.columns-1)*fo.columnGap) / bag.ScaledPoint(fo.columns)
+}
+
+// columnWidth implements f.column_width({page_master, area, columns,
+// column_gap}) which returns the width of a column, so the contents can be
+// formatted for flow.
+func (fd *frontendDocument) columnWidth(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return object.NewArgsRangeError("frontend.column_width", 0, 1, len(args))
+	}
+	fo, errObj := fd.parseFlowOptions("frontend.column_width", args)
+	if errObj != nil {
+		return errObj
+	}
+	area, err := fo.master.area(fo.area)
+	if err != nil {
+		return object.ArgsErrorf("frontend.column_width(): %s", err)
+	}
+	return &rbag.RSP{Value: fo.columnWidth(area)}
+}
+
+// flow implements f.flow(vlists, {page_master, area, on_new_page, widows,
+// orphans, columns, column_gap, column_rule, balance}). The vlists are
+// distributed over as many pages as needed. The page master is the name of a
+// defined page master or a map with the page master settings, area defaults
+// to "text". With more than one column the contents should be formatted with
+// the width returned by column_width. flow returns the list of pages.
+func (fd *frontendDocument) flow(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("frontend.flow", 1, 2, len(args))
+	}
+	var nodes []node.Node
+	switch t := args[0].(type) {
+	case *rnode.Node:
+		nodes = append(nodes, t.Value)
+	case *object.List:
+		for _, itm := range t.Value() {
+			n, ok := itm.(*rnode.Node)
+			if !ok {
+				return object.ArgsErrorf("frontend.flow() expects a list of nodes, got %s", itm.Type())
+			}
+			nodes = append(nodes, n.Value)
+		}
+	default:
+		return object.ArgsErrorf("frontend.flow() expects a node or a list of nodes")
+	}
+	fo, errObj := fd.parseFlowOptions("frontend.flow", args[1:])
+	if errObj != nil {
+		return errObj
+	}
+	pm := fo.master
+	area, err := pm.area(fo.area)
+	if err != nil {
+		return object.ArgsErrorf("frontend.flow(): %s", err)
+	}
+	colWidth := fo.columnWidth(area)
+	ff := &flowFlattener{
+		fd:            fd,
+		widows:        fo.widows,
+		orphans:       fo.orphans,
+		footnoteWidth: colWidth,
+		marginWidth: map[string]bag.ScaledPoint{
+			"left":  area.x - 2*marginNoteGap,
+			"right": pm.width - area.x - area.width - 2*marginNoteGap,
+		},
+	}
+	for _, n := range nodes {
+		ff.add(n)
+	}
+	if ff.err != nil {
+		return object.NewError(ff.err)
+	}
+	items := ff.items
+	pages := object.NewList(nil)
+	// the footnote lines that did not fit into the previous column
+	var carry []flowItem
+	start := skipDiscardable(items, 0)
+	for start < len(items) || len(carry) > 0 {
+		page := fd.newMasterPage(pm)
+		rp := &rdocument.Page{Value: page}
+		if fo.onNewPage != nil {
+			if ret := fo.onNewPage.Call(ctx, rp, object.NewInt(int64(len(fd.value.Doc.Pages)))); ret != nil {
+				if errObj, ok := ret.(*object.Error); ok {
+					return errObj
+				}
+			}
+		}
+		avail := area.height
+		if fo.balance && fo.columns > 1 && fitsColumns(items, start, fo.columns, avail, itemsHeight(carry)) {
+			avail = balancedHeight(items, start, fo.columns, avail, itemsHeight(carry))
+		}
+		var colHeight bag.ScaledPoint
+		used := 0
+		for c := 0; c < fo.columns; c++ {
+			if start = skipDiscardable(items, start); start >= len(items) && len(carry) == 0 {
+				break
+			}
+			end := start
+			if start < len(items) {
+				var ok bool
+				if end, ok = nextBreak(items, start, avail, itemsHeight(carry)); !ok {
+					bag.Logger.Warn("flow: content does not fit on the page")
+				}
+			}
+			x := area.x + bag.ScaledPoint(c)*(colWidth+fo.columnGap)
+			top := pm.height - area.y
+			// margin notes next to their lines
+			var y bag.ScaledPoint
+			if start < end {
+				y = items[start].headerHeight()
+			}
+			for _, it := range items[start:end] {
+				for _, mn := range it.marginNotes {
+					mx := area.x + area.width + marginNoteGap
+					if mn.side == "left" {
+						mx = area.x - marginNoteGap - mn.vl.Width
+					}
+					page.OutputAt(mx, top-y, mn.vl)
+				}
+				y += it.height()
+			}
+			// footnotes of this column
+			fnItems := carry
+			for _, it := range items[start:end] {
+				for _, fn := range it.footnotes {
+					fnItems = append(fnItems, fn.items...)
+				}
+			}
+			var contentHeight bag.ScaledPoint
+			if end > start {
+				vl := packItems(items, start, end)
+				vl.Width = colWidth
+				vl.Attributes = node.H{"origin": "flow"}
+				page.OutputAt(x, top, vl)
+				contentHeight = vl.Height + vl.Depth
+			}
+			carry = nil
+			if len(fnItems) > 0 {
+				room := avail - contentHeight - footnoteSeparatorHeight()
+				fnEnd, ok := nextBreak(fnItems, 0, room, 0)
+				if !ok && end > start {
+					// try again in the next column
+					fnEnd = 0
+				}
+				if fnEnd > 0 {
+					fvl := packItems(fnItems, 0, fnEnd)
+					sep := footnoteSeparator(colWidth)
+					node.InsertAfter(sep, node.Tail(sep), fvl)
+					fnvl := node.Vpack(sep)
+					fnvl.Width = colWidth
+					fnvl.Attributes = node.H{"origin": "footnotes"}
+					page.OutputAt(x, top-avail+fnvl.Height+fnvl.Depth, fnvl)
+					contentHeight = avail
+				}
+				carry = fnItems[skipDiscardable(fnItems, fnEnd):]
+			}
+			colHeight = max(colHeight, contentHeight)
+			used++
+			start = end
+		}
+		for c := 1; c < used && fo.ruleWidth > 0; c++ {
+			r := node.NewRule()
+			r.Width = fo.ruleWidth
+			r.Height = colHeight
+			if fo.ruleColor != nil {
+				r.Pre = pdfdraw.New().Save().ColorNonstroking(*fo.ruleColor).String()
+				r.Post = pdfdraw.New().Restore().String()
+			}
+			r.Attributes = node.H{"origin": "column rule"}
+			x := area.x + bag.ScaledPoint(c)*(colWidth+fo.columnGap) - (fo.columnGap+fo.ruleWidth)/2
+			page.OutputAt(x, pm.height-area.y, node.Vpack(r))
+		}
+		// pages with header or footer are shipped out when the document is
+		// finished
+		if pm.header == nil && pm.footer == nil {
+			page.Shipout()
+		}
+		pages.Append(rp)
+		start = skipDiscardable(items, start)
+	}
+	return pages
+}
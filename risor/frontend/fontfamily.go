@@ -1,13 +1,76 @@
 package frontend
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/boxesandglue/textlayout/fonts/truetype"
 	"github.com/risor-io/risor/object"
 	"github.com/risor-io/risor/op"
 )
 
+// svgFonts provides the font families of the document for the text in SVG
+// images.
+type svgFonts struct {
+	doc *frontend.Document
+	// the fonts are loaded once per font source
+	fonts map[*frontend.FontSource]*truetype.Font
+}
+
+// Font returns the font of the font family.
+func (sf *svgFonts) Font(family string, weight int, italic bool) (*truetype.Font, bool) {
+	fs, ok := sf.fontSource(family, weight, italic)
+	if !ok {
+		return nil, false
+	}
+	if font, ok := sf.fonts[fs]; ok {
+		return font, font != nil
+	}
+	if sf.fonts == nil {
+		sf.fonts = make(map[*frontend.FontSource]*truetype.Font)
+	}
+	data := fs.Data
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(fs.Location); err != nil {
+			sf.fonts[fs] = nil
+			return nil, false
+		}
+	}
+	var font *truetype.Font
+	if faces, err := truetype.Load(bytes.NewReader(data)); err == nil && fs.Index < len(faces) {
+		font, _ = faces[fs.Index].(*truetype.Font)
+	}
+	sf.fonts[fs] = font
+	return font, font != nil
+}
+
+// ID returns the name, the file name and the index of the font source of the
+// font family, "" if there is none.
+func (sf *svgFonts) ID(family string, weight int, italic bool) string {
+	fs, ok := sf.fontSource(family, weight, italic)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%q %q %d", fs.Name, fs.Location, fs.Index)
+}
+
+func (sf *svgFonts) fontSource(family string, weight int, italic bool) (*frontend.FontSource, bool) {
+	ff := sf.doc.FindFontFamily(family)
+	if ff == nil {
+		return nil, false
+	}
+	style := frontend.FontStyleNormal
+	if italic {
+		style = frontend.FontStyleItalic
+	}
+	fs, err := ff.GetFontSource(frontend.FontWeight(weight), style)
+	return fs, err == nil && fs != nil
+}
+
 type FontFamily struct {
 	Value *frontend.FontFamily
 }
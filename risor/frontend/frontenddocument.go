@@ -2,9 +2,9 @@ package frontend
 
 import (
 	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
 	"github.com/boxesandglue/boxesandglue/frontend"
-	rbag "github.com/boxesandglue/cli/risor/backend/bag"
-	rcolor "github.com/boxesandglue/cli/risor/backend/color"
 	rdocument "github.com/boxesandglue/cli/risor/backend/document"
 	rnode "github.com/boxesandglue/cli/risor/backend/node"
 
@@ -19,33 +19,134 @@ type frontendDocument struct {
 	value *frontend.Document
 	// The document object
 	doc *rdocument.Document
+	// The run of the script that created the document
+	run *Run
+	// The named text styles
+	styles map[string]*textStyle
+	// The page masters defined with define_page_master
+	pageMasters map[string]*pageMaster
+	// Pages with header or footer that are shipped out on finish
+	pendingPages []*pendingPage
+	// The number of the last footnote
+	footnoteNumber int
+	// The marks of this run in the order of the pages
+	marks []*mark
+	// The marks from the aux file of the previous run
+	previousMarks map[string]*mark
+	previousToc   []*mark
+	// The spot colors defined with define_color
+	spotColors map[*color.Color]*spotColor
+	// The separation color spaces by spot color name
+	separations map[string]*separation
+	// The fonts for the text in SVG images
+	svgFonts *svgFonts
 }
 
+// buildTable implements f.build_table(table[, {height, first_height}]). With
+// a height the table is broken into vlists of at most this height (the first
+// one of at most first_height) and the header and footer rows are repeated.
 func (fd *frontendDocument) buildTable(ctx context.Context, args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return object.ArgsErrorf("document.build_table() takes exactly one argument")
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("frontend.build_table", 1, 2, len(args))
 	}
 	if args[0].Type() != FrontendTableType {
 		return object.ArgsErrorf("document.build_table() expects a list argument (table)")
 	}
 
-	tbl := args[0].(*Table).Value
+	t := args[0].(*Table)
+	tbl := t.Value
 	if tbl == nil {
 		return object.ArgsErrorf("document.build_table() expects a table argument")
 	}
 	if fd.value == nil {
 		return object.ArgsErrorf("document.build_table() expects a document argument")
 	}
-	vls, err := fd.value.BuildTable(tbl)
+	var height, firstHeight bag.ScaledPoint
+	if len(args) == 2 {
+		opts, errObj := object.AsMap(args[1])
+		if errObj != nil {
+			return errObj
+		}
+		for k, v := range opts.Value() {
+			sp, err := convertSP(v)
+			if err != nil {
+				return object.ArgsErrorf("frontend.build_table(): %s: %s", k, err)
+			}
+			switch k {
+			case "height":
+				height = sp.(bag.ScaledPoint)
+			case "first_height":
+				firstHeight = sp.(bag.ScaledPoint)
+			default:
+				return object.ArgsErrorf("frontend.build_table(): unknown option %s", k)
+			}
+		}
+		if firstHeight == 0 {
+			firstHeight = height
+		}
+		if height == 0 {
+			return object.ArgsErrorf("frontend.build_table(): height is required")
+		}
+	}
+	vls, err := fd.buildTableNodes(t)
 	if err != nil {
 		return object.NewError(err)
 	}
 	vlists := object.NewList(nil)
 	for _, v := range vls {
-		vlists.Append(&rnode.Node{Value: v})
+		if height == 0 {
+			vlists.Append(&rnode.Node{Value: v})
+			continue
+		}
+		ti := v.Attributes[tableInfoAttribute].(*tableInfo)
+		for _, chunk := range splitTable(v, ti, firstHeight, height) {
+			vlists.Append(&rnode.Node{Value: chunk})
+		}
 	}
 	return vlists
 }
+
+// buildTableNodes builds the table and returns the vlists with the table
+// information for page breaking.
+func (fd *frontendDocument) buildTableNodes(t *Table) ([]*node.VList, error) {
+	tbl := t.Value
+	unstyle, err := fd.styleCells(t)
+	if err != nil {
+		return nil, err
+	}
+	defer unstyle()
+	decorations, err := fd.applyTableSettings(t)
+	if err != nil {
+		return nil, err
+	}
+	if t.columns != nil {
+		maxWidth := tbl.MaxWidth
+		wd, err := setColumnSpecs(tbl, t.columns)
+		if err != nil {
+			return nil, err
+		}
+		tbl.MaxWidth = wd
+		defer func() { tbl.MaxWidth = maxWidth }()
+	}
+	restore := fd.prepareCellContents(tbl)
+	defer restore()
+	vls, err := fd.value.BuildTable(tbl)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vls {
+		if err := decorateTable(v, tbl, decorations); err != nil {
+			return nil, err
+		}
+		ti, err := newTableInfo(v, tbl, t.headerRows, t.footerRows)
+		if err != nil {
+			return nil, err
+		}
+		v.Attributes[tableInfoAttribute] = ti
+	}
+	return vls, nil
+}
+
 func (fd *frontendDocument) getColor(ctx context.Context, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return object.ArgsErrorf("frontend.get_color() takes exactly one argument")
@@ -55,8 +156,10 @@ func (fd *frontendDocument) getColor(ctx context.Context, args ...object.Object)
 	}
 	colorName := args[0].(*object.String).Value()
 	col := fd.value.GetColor(colorName)
-	backendCol := rcolor.RColor{Value: col}
-	return &backendCol
+	if col == nil {
+		return object.Errorf("frontend.get_color(): unknown color %s", colorName)
+	}
+	return fd.toRColor(col)
 }
 
 func (fd *frontendDocument) newFontFamily(ctx context.Context, args ...object.Object) object.Object {
@@ -71,62 +174,40 @@ func (fd *frontendDocument) newFontFamily(ctx context.Context, args ...object.Ob
 }
 
 func (fd *frontendDocument) formatParagraph(ctx context.Context, args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return object.ArgsErrorf("frontend.format_paragraph() takes exactly one argument")
-	}
-	firstArg := args[0]
-	if firstArg.Type() != object.MAP {
-		return object.ArgsErrorf("frontend.format_paragraph() expects a map argument (formatting options)")
-	}
-	lst := firstArg.(*object.Map).Value()
-	var opts = make([]frontend.TypesettingOption, 0)
-	var wd bag.ScaledPoint
-	var ftext *frontend.Text
-	for k, v := range lst {
-		switch k {
-		case "width":
-			if v.Type() == "bag.scaledpoint" {
-				wd = v.(*rbag.RSP).Value
-			} else {
-				return object.ArgsErrorf("frontend.format_paragraph() expects a bag.scaledpoint argument (width)")
-			}
-		case "text":
-			if v.Type() == "frontend.text" {
-				ftext = v.(*text).Value
-			} else {
-				return object.ArgsErrorf("frontend.format_paragraph() expects a frontend.text argument (text)")
-			}
-		case "leading":
-			if v.Type() == "bag.scaledpoint" {
-				opts = append(opts, frontend.Leading(v.(*rbag.RSP).Value))
-			} else {
-				return object.ArgsErrorf("frontend.format_paragraph() expects a bag.scaledpoint argument (leading)")
-			}
-		case "font_size":
-			if v.Type() == "bag.scaledpoint" {
-				opts = append(opts, frontend.FontSize(v.(*rbag.RSP).Value))
-			} else {
-				return object.ArgsErrorf("frontend.format_paragraph() expects a bag.scaledpoint argument (font_size)")
-			}
-		case "family":
-			if v.Type() == "frontend.fontfamily" {
-				ff := v.(*FontFamily)
-				opts = append(opts, frontend.Family(ff.Value))
-			} else {
-				return object.ArgsErrorf("frontend.format_paragraph() expects a frontend.fontfamily argument (font family)")
-			}
-		default:
-			// fmt.Println(`~~> k,v`, k, v)
-		}
+	po, errObj := parseParagraphOptions(ctx, "frontend.format_paragraph", args)
+	if errObj != nil {
+		return errObj
+	}
+	var err error
+	if po.text, err = fd.styledText(po.text); err != nil {
+		return object.NewError(err)
 	}
-	vlist, _, err := fd.value.FormatParagraph(ftext, wd, opts...)
+	info, err := formatParagraph(fd.value, po)
 	if err != nil {
 		return object.NewError(err)
 	}
-	vl := &rnode.Node{Value: vlist}
+	vl := &rnode.Node{Value: info.vlist}
 	return vl
 }
 
+// formatParagraphInfo formats the paragraph like formatParagraph and returns
+// the vlist together with the metrics of the paragraph.
+func (fd *frontendDocument) formatParagraphInfo(ctx context.Context, args ...object.Object) object.Object {
+	po, errObj := parseParagraphOptions(ctx, "frontend.format_paragraph_info", args)
+	if errObj != nil {
+		return errObj
+	}
+	var err error
+	if po.text, err = fd.styledText(po.text); err != nil {
+		return object.NewError(err)
+	}
+	info, err := formatParagraph(fd.value, po)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return info
+}
+
 // Type of the object.
 func (fd *frontendDocument) Type() object.Type {
 	return "frontend.document"
@@ -152,14 +233,44 @@ func (fd *frontendDocument) GetAttr(name string) (object.Object, bool) {
 	switch name {
 	case "build_table":
 		return object.NewBuiltin("frontend.build_table", fd.buildTable), true
+	case "column_width":
+		return object.NewBuiltin("frontend.column_width", fd.columnWidth), true
+	case "define_color":
+		return object.NewBuiltin("frontend.define_color", fd.defineColor), true
+	case "define_page_master":
+		return object.NewBuiltin("frontend.define_page_master", fd.definePageMaster), true
+	case "define_style":
+		return object.NewBuiltin("frontend.define_style", fd.defineStyle), true
 	case "doc":
 		return fd.doc, true
 	case "get_color":
 		return object.NewBuiltin("frontend.get_color", fd.getColor), true
+	case "new_page":
+		return object.NewBuiltin("frontend.new_page", fd.newPage), true
+	case "parse_html":
+		return object.NewBuiltin("frontend.parse_html", fd.parseHTML), true
+	case "mark":
+		return object.NewBuiltin("frontend.mark", fd.setMark), true
+	case "margin_note":
+		return object.NewBuiltin("frontend.margin_note", fd.marginNote), true
 	case "new_fontfamily":
 		return object.NewBuiltin("frontend.new_fontfamily", fd.newFontFamily), true
+	case "flow":
+		return object.NewBuiltin("frontend.flow", fd.flow), true
+	case "footnote":
+		return object.NewBuiltin("frontend.footnote", fd.footnote), true
+	case "format_html":
+		return object.NewBuiltin("frontend.format_html", fd.formatHTML), true
+	case "format_markdown":
+		return object.NewBuiltin("frontend.format_markdown", fd.formatMarkdown), true
 	case "format_paragraph":
 		return object.NewBuiltin("frontend.format_paragraph", fd.formatParagraph), true
+	case "format_paragraph_info":
+		return object.NewBuiltin("frontend.format_paragraph_info", fd.formatParagraphInfo), true
+	case "ref":
+		return object.NewBuiltin("frontend.ref", fd.ref), true
+	case "toc":
+		return object.NewBuiltin("frontend.toc", fd.toc), true
 	}
 	return nil, false
 }
@@ -0,0 +1,610 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+	"golang.org/x/net/html"
+)
+
+// The user agent style sheet. Sizes and margins follow the defaults of the
+// web browsers.
+const htmlDefaultCSS = `
+h1 { font-size: 2em; font-weight: bold; margin-top: 0.67em; margin-bottom: 0.67em }
+h2 { font-size: 1.5em; font-weight: bold; margin-top: 0.83em; margin-bottom: 0.83em }
+h3 { font-size: 1.17em; font-weight: bold; margin-top: 1em; margin-bottom: 1em }
+h4 { font-weight: bold; margin-top: 1.33em; margin-bottom: 1.33em }
+h5 { font-size: 0.83em; font-weight: bold; margin-top: 1.67em; margin-bottom: 1.67em }
+h6 { font-size: 0.67em; font-weight: bold; margin-top: 2.33em; margin-bottom: 2.33em }
+p { margin-top: 1em; margin-bottom: 1em }
+ul, ol { margin-top: 1em; margin-bottom: 1em; padding-left: 40px }
+blockquote { margin-top: 1em; margin-bottom: 1em; margin-left: 40px; margin-right: 40px }
+pre { white-space: pre; font-family: monospace; margin-top: 1em; margin-bottom: 1em }
+b, strong { font-weight: bold }
+i, em, cite, var { font-style: italic }
+u, ins { text-decoration: underline }
+s, del, strike { text-decoration: line-through }
+code, kbd, samp, tt { font-family: monospace }
+`
+
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true,
+	"div": true, "figure": true, "footer": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "html": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"ul": true,
+}
+
+var htmlIgnoredElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true,
+}
+
+var htmlDefaultStylesheet = func() *stylesheet {
+	ss, err := parseCSS(htmlDefaultCSS)
+	if err != nil {
+		panic(err)
+	}
+	return ss
+}()
+
+// htmlContext holds the computed values of an element.
+type htmlContext struct {
+	// The inherited text settings.
+	settings frontend.TypesettingSettings
+	fontSize bag.ScaledPoint
+	// The sum of the left and right margins and paddings of the surrounding
+	// blocks.
+	indentLeft  bag.ScaledPoint
+	indentRight bag.ScaledPoint
+	// The list marker which is put in front of the first paragraph of a list
+	// item.
+	marker *string
+	// list is "ul" or "ol" within a list, counter is the current item number.
+	list    string
+	counter *int
+}
+
+// htmlConverter turns HTML into a list of paragraphs (texts). The margins of
+// the paragraphs are stored in the margin settings of the texts.
+type htmlConverter struct {
+	fe       *frontend.Document
+	css      *stylesheet
+	rootSize bag.ScaledPoint
+	blocks   []*frontend.Text
+	// The inline elements of the current paragraph. The first entry is the
+	// paragraph.
+	inline     []*frontend.Text
+	pendingTop bag.ScaledPoint
+}
+
+// parseHTML converts the HTML fragment to paragraphs. css and family can be
+// nil.
+func parseHTML(fe *frontend.Document, str string, css *stylesheet, fontSize bag.ScaledPoint, family *frontend.FontFamily) ([]*frontend.Text, error) {
+	doc, err := html.Parse(strings.NewReader(str))
+	if err != nil {
+		return nil, err
+	}
+	if fontSize == 0 {
+		fontSize = 12 * bag.Factor
+	}
+	c := &htmlConverter{fe: fe, css: css, rootSize: fontSize}
+	ctx := &htmlContext{
+		settings: frontend.TypesettingSettings{frontend.SettingSize: fontSize},
+		fontSize: fontSize,
+	}
+	if family != nil {
+		ctx.settings[frontend.SettingFontFamily] = family
+	}
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if err = c.walk(n, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return c.blocks, nil
+}
+
+func (c *htmlConverter) walk(n *html.Node, ctx *htmlContext) error {
+	switch n.Type {
+	case html.TextNode:
+		return c.text(n, ctx)
+	case html.ElementNode:
+		if htmlIgnoredElements[n.Data] {
+			return nil
+		}
+		return c.element(n, ctx)
+	case html.DocumentNode:
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if err := c.walk(child, ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *htmlConverter) text(n *html.Node, ctx *htmlContext) error {
+	str := n.Data
+	if pre, _ := ctx.settings[frontend.SettingPreserveWhitespace].(bool); !pre {
+		// collapse white space like a web browser
+		collapsed := strings.Join(strings.Fields(str), " ")
+		if collapsed == "" {
+			if len(c.inline) == 0 {
+				return nil
+			}
+			collapsed = " "
+		} else {
+			if len(c.inline) > 0 && strings.TrimLeftFunc(str, unicode.IsSpace) != str {
+				collapsed = " " + collapsed
+			}
+			if strings.TrimRightFunc(str, unicode.IsSpace) != str {
+				collapsed += " "
+			}
+		}
+		str = collapsed
+	}
+	parent := c.currentInline(ctx)
+	parent.Items = append(parent.Items, str)
+	return nil
+}
+
+// currentInline returns the text for the inline content. A new paragraph is
+// started if necessary.
+func (c *htmlConverter) currentInline(ctx *htmlContext) *frontend.Text {
+	if len(c.inline) == 0 {
+		te := frontend.NewText()
+		for k, v := range ctx.settings {
+			te.Settings[k] = v
+		}
+		te.Settings[frontend.SettingMarginTop] = c.pendingTop
+		te.Settings[frontend.SettingMarginBottom] = bag.ScaledPoint(0)
+		te.Settings[frontend.SettingMarginLeft] = ctx.indentLeft
+		te.Settings[frontend.SettingMarginRight] = ctx.indentRight
+		c.pendingTop = 0
+		if ctx.marker != nil && *ctx.marker != "" {
+			te.Items = append(te.Items, *ctx.marker)
+			*ctx.marker = ""
+		}
+		c.blocks = append(c.blocks, te)
+		c.inline = []*frontend.Text{te}
+	}
+	return c.inline[len(c.inline)-1]
+}
+
+// closeParagraph ends the current paragraph.
+func (c *htmlConverter) closeParagraph() {
+	c.inline = nil
+}
+
+// addMarginBottom adds the bottom margin to the last paragraph. Adjoining
+// margins collapse to the larger value.
+func (c *htmlConverter) addMarginBottom(mb bag.ScaledPoint) {
+	if len(c.blocks) == 0 {
+		return
+	}
+	last := c.blocks[len(c.blocks)-1]
+	if cur, _ := last.Settings[frontend.SettingMarginBottom].(bag.ScaledPoint); mb > cur {
+		last.Settings[frontend.SettingMarginBottom] = mb
+	}
+}
+
+func (c *htmlConverter) element(n *html.Node, parentCtx *htmlContext) error {
+	decls := htmlDefaultStylesheet.declarations(n)
+	if c.css != nil {
+		decls = append(decls, c.css.declarations(n)...)
+	}
+	if style := htmlAttribute(n, "style"); style != "" {
+		decls = append(decls, parseCSSDeclarations(style)...)
+	}
+	decls = cascade(decls)
+	ctx := &htmlContext{
+		settings:    make(frontend.TypesettingSettings, len(parentCtx.settings)),
+		fontSize:    parentCtx.fontSize,
+		indentLeft:  parentCtx.indentLeft,
+		indentRight: parentCtx.indentRight,
+		marker:      parentCtx.marker,
+		list:        parentCtx.list,
+		counter:     parentCtx.counter,
+	}
+	for k, v := range parentCtx.settings {
+		ctx.settings[k] = v
+	}
+	box := map[string]bag.ScaledPoint{}
+	block := htmlBlockElements[n.Data]
+	// font-size first, the other lengths depend on it
+	for _, decl := range decls {
+		if decl[0] == "font-size" {
+			size, err := c.fontSize(decl[1], parentCtx.fontSize)
+			if err != nil {
+				return err
+			}
+			ctx.fontSize = size
+			ctx.settings[frontend.SettingSize] = size
+		}
+	}
+	for _, decl := range decls {
+		prop, val := decl[0], decl[1]
+		switch prop {
+		case "font-size":
+			// already done
+		case "display":
+			switch val {
+			case "none":
+				return nil
+			case "block", "list-item":
+				block = true
+			case "inline":
+				block = false
+			}
+		case "margin", "padding":
+			values, err := c.boxValues(val, ctx.fontSize)
+			if err != nil {
+				return err
+			}
+			for i, side := range []string{"top", "right", "bottom", "left"} {
+				box[prop+"-"+side] = values[i]
+			}
+		case "margin-top", "margin-right", "margin-bottom", "margin-left",
+			"padding-top", "padding-right", "padding-bottom", "padding-left":
+			l, err := c.length(val, ctx.fontSize)
+			if err != nil {
+				return err
+			}
+			box[prop] = l
+		default:
+			if err := c.textProperty(ctx, prop, val); err != nil {
+				return err
+			}
+		}
+	}
+	if n.Data == "a" {
+		if href := htmlAttribute(n, "href"); href != "" {
+			ctx.settings[frontend.SettingHyperlink] = convertHyperlinkString(href)
+		}
+	}
+	if n.Data == "br" {
+		parent := c.currentInline(ctx)
+		parent.Items = append(parent.Items, "\n")
+		return nil
+	}
+	if !block {
+		return c.inlineElement(n, ctx)
+	}
+
+	c.closeParagraph()
+	c.pendingTop = max(c.pendingTop, box["margin-top"]+box["padding-top"])
+	ctx.indentLeft += box["margin-left"] + box["padding-left"]
+	ctx.indentRight += box["margin-right"] + box["padding-right"]
+	switch n.Data {
+	case "ul", "ol":
+		ctx.list = n.Data
+		counter := 0
+		ctx.counter = &counter
+		ctx.marker = nil
+	case "li":
+		marker := "• "
+		if ctx.list == "ol" && ctx.counter != nil {
+			*ctx.counter++
+			marker = strconv.Itoa(*ctx.counter) + ". "
+		}
+		ctx.marker = &marker
+	default:
+		ctx.marker = nil
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if err := c.walk(child, ctx); err != nil {
+			return err
+		}
+	}
+	c.closeParagraph()
+	c.addMarginBottom(box["margin-bottom"] + box["padding-bottom"])
+	return nil
+}
+
+func (c *htmlConverter) inlineElement(n *html.Node, ctx *htmlContext) error {
+	parent := c.currentInline(ctx)
+	te := frontend.NewText()
+	for k, v := range ctx.settings {
+		te.Settings[k] = v
+	}
+	parent.Items = append(parent.Items, te)
+	c.inline = append(c.inline, te)
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if err := c.walk(child, ctx); err != nil {
+			return err
+		}
+	}
+	if l := len(c.inline); l > 0 && c.inline[l-1] == te {
+		c.inline = c.inline[:l-1]
+	}
+	return nil
+}
+
+// textProperty sets the text setting for the CSS property. Unknown properties
+// are ignored.
+func (c *htmlConverter) textProperty(ctx *htmlContext, prop, val string) error {
+	set := func(name string, value object.Object) error {
+		st, v, err := convertSetting(name, value)
+		if err != nil {
+			return fmt.Errorf("css %s: %w", prop, err)
+		}
+		ctx.settings[st] = v
+		return nil
+	}
+	switch prop {
+	case "color":
+		return set("color", object.NewString(val))
+	case "font-family":
+		for _, name := range strings.Split(val, ",") {
+			name = strings.Trim(strings.TrimSpace(name), `"'`)
+			if c.fe == nil {
+				break
+			}
+			if ff := c.fe.FindFontFamily(name); ff != nil {
+				ctx.settings[frontend.SettingFontFamily] = ff
+				break
+			}
+		}
+	case "font-weight":
+		switch val {
+		case "bolder":
+			val = "bold"
+		case "lighter":
+			val = "normal"
+		}
+		return set("fontweight", object.NewString(val))
+	case "font-style":
+		return set("style", object.NewString(val))
+	case "text-decoration", "text-decoration-line":
+		return set("textdecorationline", object.NewString(strings.Fields(val)[0]))
+	case "text-align":
+		return set("halign", object.NewString(val))
+	case "white-space":
+		ctx.settings[frontend.SettingPreserveWhitespace] = strings.HasPrefix(val, "pre")
+	case "line-height":
+		if val == "normal" {
+			delete(ctx.settings, frontend.SettingLeading)
+			return nil
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			ctx.settings[frontend.SettingLeading] = bag.MultiplyFloat(ctx.fontSize, f)
+			return nil
+		}
+		l, err := c.length(val, ctx.fontSize)
+		if err != nil {
+			return err
+		}
+		ctx.settings[frontend.SettingLeading] = l
+	case "background-color":
+		return set("backgroundcolor", object.NewString(val))
+	}
+	return nil
+}
+
+var cssFontSizeKeywords = map[string]float64{
+	"xx-small": 0.5625, "x-small": 0.625, "small": 0.8125, "medium": 1,
+	"large": 1.125, "x-large": 1.5, "xx-large": 2,
+}
+
+func (c *htmlConverter) fontSize(val string, parentSize bag.ScaledPoint) (bag.ScaledPoint, error) {
+	if f, ok := cssFontSizeKeywords[val]; ok {
+		return bag.MultiplyFloat(c.rootSize, f), nil
+	}
+	switch val {
+	case "smaller":
+		return bag.MultiplyFloat(parentSize, 0.8333), nil
+	case "larger":
+		return bag.MultiplyFloat(parentSize, 1.2), nil
+	}
+	return c.length(val, parentSize)
+}
+
+// length converts a CSS length. em and % are relative to fontSize.
+func (c *htmlConverter) length(val string, fontSize bag.ScaledPoint) (bag.ScaledPoint, error) {
+	val = strings.TrimSpace(val)
+	var rel bag.ScaledPoint
+	var num string
+	switch {
+	case val == "0" || val == "auto":
+		return 0, nil
+	case strings.HasSuffix(val, "rem"):
+		rel, num = c.rootSize, strings.TrimSuffix(val, "rem")
+	case strings.HasSuffix(val, "em"):
+		rel, num = fontSize, strings.TrimSuffix(val, "em")
+	case strings.HasSuffix(val, "%"):
+		rel, num = fontSize/100, strings.TrimSuffix(val, "%")
+	default:
+		l, err := bag.SP(val)
+		if err != nil {
+			return 0, fmt.Errorf("css: invalid length %q", val)
+		}
+		return l, nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("css: invalid length %q", val)
+	}
+	return bag.MultiplyFloat(rel, f), nil
+}
+
+// boxValues expands the shorthand notation of margin and padding to top,
+// right, bottom and left.
+func (c *htmlConverter) boxValues(val string, fontSize bag.ScaledPoint) ([4]bag.ScaledPoint, error) {
+	var ret [4]bag.ScaledPoint
+	fields := strings.Fields(val)
+	values := make([]bag.ScaledPoint, len(fields))
+	for i, f := range fields {
+		l, err := c.length(f, fontSize)
+		if err != nil {
+			return ret, err
+		}
+		values[i] = l
+	}
+	switch len(values) {
+	case 1:
+		ret = [4]bag.ScaledPoint{values[0], values[0], values[0], values[0]}
+	case 2:
+		ret = [4]bag.ScaledPoint{values[0], values[1], values[0], values[1]}
+	case 3:
+		ret = [4]bag.ScaledPoint{values[0], values[1], values[2], values[1]}
+	case 4:
+		ret = [4]bag.ScaledPoint{values[0], values[1], values[2], values[3]}
+	default:
+		return ret, fmt.Errorf("css: invalid box value %q", val)
+	}
+	return ret, nil
+}
+
+func convertHyperlinkString(href string) any {
+	v, _ := convertHyperlink(object.NewString(href))
+	return v
+}
+
+// htmlOptions holds the options of parse_html and format_html.
+type htmlOptions struct {
+	css      *stylesheet
+	width    bag.ScaledPoint
+	fontSize bag.ScaledPoint
+	family   *frontend.FontFamily
+}
+
+func parseHTMLOptions(fn string, args []object.Object) (string, *htmlOptions, *object.Error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", nil, object.NewArgsRangeError(fn, 1, 2, len(args))
+	}
+	str, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return "", nil, errObj
+	}
+	ho := &htmlOptions{}
+	if len(args) == 1 {
+		return str, ho, nil
+	}
+	m, errObj := object.AsMap(args[1])
+	if errObj != nil {
+		return "", nil, errObj
+	}
+	for k, v := range m.Value() {
+		switch k {
+		case "css":
+			switch t := v.(type) {
+			case *stylesheet:
+				ho.css = t
+			case *object.String:
+				ss, err := parseCSS(t.Value())
+				if err != nil {
+					return "", nil, object.NewError(err)
+				}
+				ho.css = ss
+			default:
+				return "", nil, object.ArgsErrorf("%s() expects a css or a string argument (css)", fn)
+			}
+		case "width":
+			sp, ok := v.(*rbag.RSP)
+			if !ok {
+				return "", nil, object.ArgsErrorf("%s() expects a bag.scaledpoint argument (width)", fn)
+			}
+			ho.width = sp.Value
+		case "font_size":
+			sp, ok := v.(*rbag.RSP)
+			if !ok {
+				return "", nil, object.ArgsErrorf("%s() expects a bag.scaledpoint argument (font_size)", fn)
+			}
+			ho.fontSize = sp.Value
+		case "family":
+			ff, ok := v.(*FontFamily)
+			if !ok {
+				return "", nil, object.ArgsErrorf("%s() expects a frontend.fontfamily argument (family)", fn)
+			}
+			ho.family = ff.Value
+		default:
+			return "", nil, object.ArgsErrorf("%s(): unknown option %s", fn, k)
+		}
+	}
+	return str, ho, nil
+}
+
+// formatBlocks formats the paragraphs and stacks them with their margins.
+func (fd *frontendDocument) formatBlocks(blocks []*frontend.Text, width bag.ScaledPoint) (*node.VList, error) {
+	var head, tail node.Node
+	var prevBottom bag.ScaledPoint
+	for i, te := range blocks {
+		mt, _ := te.Settings[frontend.SettingMarginTop].(bag.ScaledPoint)
+		mb, _ := te.Settings[frontend.SettingMarginBottom].(bag.ScaledPoint)
+		ml, _ := te.Settings[frontend.SettingMarginLeft].(bag.ScaledPoint)
+		mr, _ := te.Settings[frontend.SettingMarginRight].(bag.ScaledPoint)
+		po := &paragraphOptions{
+			text:  te,
+			shape: listShape([]parshapeLine{{indent: ml, width: width - ml - mr}}),
+		}
+		info, err := formatParagraph(fd.value, po)
+		if err != nil {
+			return nil, err
+		}
+		vl := info.vlist
+		if i > 0 {
+			g := node.NewGlue()
+			g.Width = max(prevBottom, mt)
+			g.Attributes = node.H{"origin": "html margin"}
+			head = node.InsertAfter(head, tail, g)
+			tail = g
+		}
+		head = node.InsertAfter(head, tail, vl)
+		tail = vl
+		prevBottom = mb
+	}
+	if head == nil {
+		return node.NewVList(), nil
+	}
+	vl := node.Vpack(head)
+	vl.Width = width
+	vl.Attributes = node.H{"origin": "format_html"}
+	return vl, nil
+}
+
+// parseHTML implements f.parse_html(html[, {css, font_size, family}]) which
+// returns a list of paragraphs.
+func (fd *frontendDocument) parseHTML(ctx context.Context, args ...object.Object) object.Object {
+	str, ho, errObj := parseHTMLOptions("frontend.parse_html", args)
+	if errObj != nil {
+		return errObj
+	}
+	blocks, err := parseHTML(fd.value, str, ho.css, ho.fontSize, ho.family)
+	if err != nil {
+		return object.NewError(err)
+	}
+	lst := object.NewList(nil)
+	for _, te := range blocks {
+		lst.Append(&text{Value: te})
+	}
+	return lst
+}
+
+// formatHTML implements f.format_html(html, {css, width, font_size, family})
+// which returns a vlist.
+func (fd *frontendDocument) formatHTML(ctx context.Context, args ...object.Object) object.Object {
+	str, ho, errObj := parseHTMLOptions("frontend.format_html", args)
+	if errObj != nil {
+		return errObj
+	}
+	if ho.width == 0 {
+		return object.ArgsErrorf("frontend.format_html() expects a width")
+	}
+	blocks, err := parseHTML(fd.value, str, ho.css, ho.fontSize, ho.family)
+	if err != nil {
+		return object.NewError(err)
+	}
+	vl, err := fd.formatBlocks(blocks, ho.width)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return &rnode.Node{Value: vl}
+}
@@ -0,0 +1,375 @@
+package frontend
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+)
+
+// lineShape returns the indentation and the width of the line with the given
+// number. Lines are counted from 1.
+type lineShape func(line int) (parshapeLine, error)
+
+// listShape returns a line shape for the list of lines ps. The last entry is
+// used for all remaining lines.
+func listShape(ps []parshapeLine) lineShape {
+	return func(line int) (parshapeLine, error) {
+		return ps[min(line, len(ps))-1], nil
+	}
+}
+
+// rectangleShape returns a line shape where all lines have the width wd.
+func rectangleShape(wd bag.ScaledPoint) lineShape {
+	return listShape([]parshapeLine{{width: wd}})
+}
+
+// paragraphBreaker breaks a paragraph into lines of different widths. The
+// line breaker of boxesandglue accepts only one change of the line width
+// (with the indentation of the first or the last lines), so the paragraph is
+// broken in parts: each part ends before the line width changes a second
+// time and the rest of the paragraph is broken again with the following
+// widths.
+type paragraphBreaker struct {
+	settings *node.LinebreakSettings
+	shape    lineShape
+	lines    []lineInfo
+}
+
+// breakParagraph formats the text te like frontend.FormatParagraph, but the
+// indentation and the width of each line are taken from shape and the metrics
+// of the line breaker are kept. Empty texts and tables are formatted by
+// FormatParagraph and have no line information.
+func breakParagraph(fe *frontend.Document, te *frontend.Text, shape lineShape, opts []frontend.TypesettingOption) (*paragraphInfo, error) {
+	first, err := shape(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(te.Items) == 0 {
+		vl, _, err := fe.FormatParagraph(te, first.width, opts...)
+		return &paragraphInfo{vlist: vl}, err
+	}
+	if _, ok := te.Items[0].(*frontend.Table); ok {
+		vl, _, err := fe.FormatParagraph(te, first.width, opts...)
+		return &paragraphInfo{vlist: vl}, err
+	}
+	p := &frontend.Options{Language: fe.Doc.DefaultLanguage}
+	if ha, ok := te.Settings[frontend.SettingHAlign].(frontend.HorizontalAlignment); ok {
+		p.Alignment = ha
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.Fontsize != 0 {
+		te.Settings[frontend.SettingSize] = p.Fontsize
+	}
+	if p.Fontfamily != nil {
+		te.Settings[frontend.SettingFontFamily] = p.Fontfamily
+	}
+	hlist, tail, err := fe.Mknodes(te)
+	if err != nil {
+		return nil, err
+	}
+	if hlist == nil {
+		return &paragraphInfo{vlist: node.NewVList()}, nil
+	}
+	// A single start stop node (like a PDF dest)
+	if _, ok := hlist.(*node.StartStop); ok && hlist.Next() == nil {
+		return &paragraphInfo{vlist: node.Vpack(hlist)}, nil
+	}
+	frontend.Hyphenate(hlist, p.Language)
+	node.AppendLineEndAfter(hlist, tail)
+
+	pb := &paragraphBreaker{settings: linebreakSettings(te, p), shape: shape}
+	vl, err := pb.breakLines(hlist)
+	if err != nil {
+		return nil, err
+	}
+	callbacks, err := postLinebreakCallbacks(fe)
+	if err != nil {
+		return nil, err
+	}
+	for _, cb := range callbacks {
+		if vl = cb(vl); vl == nil {
+			// the callback discards the lines
+			return &paragraphInfo{vlist: node.NewVList()}, nil
+		}
+	}
+	return &paragraphInfo{vlist: setParagraphHeight(te, vl), lines: pb.lines}, nil
+}
+
+// postLinebreakCallbacks returns the post line break callbacks of fe, such as
+// the underline callback every document has. frontend.FormatParagraph runs
+// them on the lines, but boxesandglue keeps them in an unexported field, so
+// the field is read directly. The tests check that the field is found.
+func postLinebreakCallbacks(fe *frontend.Document) ([]frontend.PostLinebreakCallbackFunc, error) {
+	f := reflect.ValueOf(fe).Elem().FieldByName("postLinebreakCallback")
+	if !f.IsValid() || f.Type() != reflect.TypeOf([]frontend.PostLinebreakCallbackFunc(nil)) {
+		return nil, fmt.Errorf("format_paragraph: the post line break callbacks of the document are not found")
+	}
+	return *(*[]frontend.PostLinebreakCallbackFunc)(unsafe.Pointer(f.UnsafeAddr())), nil
+}
+
+// linebreakSettings returns the line breaker settings for the text te, the
+// same settings frontend.FormatParagraph uses. The line width is set for each
+// part of the paragraph.
+func linebreakSettings(te *frontend.Text, p *frontend.Options) *node.LinebreakSettings {
+	ls := node.NewLinebreakSettings()
+	ls.Tolerance = 4
+	if hps, ok := te.Settings[frontend.SettingHangingPunctuation].(frontend.HangingPunctuation); ok {
+		ls.HangingPunctuationEnd = hps&frontend.HangingPunctuationAllowEnd == 1
+	}
+	if fef, ok := te.Settings[frontend.SettingFontExpansion].(float64); ok {
+		ls.FontExpansion = fef
+	}
+	switch {
+	case p.Leading != 0:
+		ls.LineHeight = p.Leading
+	case te.Settings[frontend.SettingLeading] != nil:
+		ls.LineHeight, _ = te.Settings[frontend.SettingLeading].(bag.ScaledPoint)
+	case p.Fontsize != 0:
+		ls.LineHeight = p.Fontsize * 120 / 100
+	default:
+		// Without a font size option the line breaker has no line height, so
+		// take it from the size of the text (for example set by a style).
+		size, _ := te.Settings[frontend.SettingSize].(bag.ScaledPoint)
+		ls.LineHeight = size * 120 / 100
+	}
+	if p.Alignment == frontend.HAlignLeft || p.Alignment == frontend.HAlignCenter {
+		lg := node.NewGlue()
+		lg.Attributes = node.H{"origin": "glue line end"}
+		lg.Stretch = bag.Factor
+		lg.StretchOrder = 3
+		lg.Subtype = node.GlueLineEnd
+		ls.LineEndGlue = lg
+	}
+	if p.Alignment == frontend.HAlignRight || p.Alignment == frontend.HAlignCenter {
+		lg := node.NewGlue()
+		lg.Attributes = node.H{"origin": "glue line start"}
+		lg.Stretch = bag.Factor
+		lg.StretchOrder = 3
+		lg.Subtype = node.GlueLineStart
+		ls.LineStartGlue = lg
+	}
+	return ls
+}
+
+// breakLines breaks the node list hlist into lines and returns the lines and
+// the line skips in a vertical list.
+func (pb *paragraphBreaker) breakLines(hlist node.Node) (*node.VList, error) {
+	var head, tail node.Node
+	var maxWidth bag.ScaledPoint
+	line := 1
+	for hlist != nil {
+		cur, err := pb.shape(line)
+		if err != nil {
+			return nil, err
+		}
+		st := saveList(hlist)
+		vl, bps := pb.linebreak(hlist, cur.width, cur.width, 0)
+		// The number of lines with the width of the current line.
+		k := 1
+		for ; k < len(bps); k++ {
+			next, err := pb.shape(line + k)
+			if err != nil {
+				return nil, err
+			}
+			if next.width != cur.width {
+				// Break again with the knowledge of the next width, the
+				// lines after the change are broken in the next part.
+				st.restore(0)
+				vl, bps = pb.linebreak(hlist, cur.width, next.width, k)
+				break
+			}
+		}
+		accept := min(k, len(bps))
+		hlist = nil
+		if accept < len(bps) {
+			hlist = st.restore(st.index[bps[accept-1].Position] + 1)
+		}
+		var prevDemerits int
+		count := 0
+		for e := vl.List; e != nil && count <= accept; {
+			next := e.Next()
+			if hl, ok := e.(*node.HList); ok && hl.Attributes["origin"] == "line" {
+				if count == accept {
+					break
+				}
+				bp := bps[count]
+				psl, err := pb.shape(line + count)
+				if err != nil {
+					return nil, err
+				}
+				setLineIndent(hl, psl.indent-breakerIndent(pb.settings, count))
+				li := newLineInfo(hl)
+				li.demerits = bp.Demerits - prevDemerits
+				prevDemerits = bp.Demerits
+				pb.lines = append(pb.lines, li)
+				maxWidth = max(maxWidth, hl.Width)
+				count++
+			}
+			e.SetPrev(nil)
+			e.SetNext(nil)
+			head = node.InsertAfter(head, tail, e)
+			tail = e
+			e = next
+		}
+		line += accept
+	}
+	vl := node.Vpack(head)
+	vl.Width = maxWidth
+	vl.Attributes = node.H{"origin": "format_paragraph"}
+	return vl, nil
+}
+
+// linebreak breaks the node list hlist. The first rows lines have the width
+// w0, the other lines the width w1.
+func (pb *paragraphBreaker) linebreak(hlist node.Node, w0, w1 bag.ScaledPoint, rows int) (*node.VList, []*node.Breakpoint) {
+	ls := pb.settings
+	ls.HSize, ls.Indent, ls.IndentRows = w0, 0, 0
+	if w1 > w0 {
+		ls.HSize, ls.Indent, ls.IndentRows = w1, w1-w0, rows
+	} else if w1 < w0 {
+		ls.Indent, ls.IndentRows = w0-w1, -rows
+	}
+	return node.Linebreak(hlist, ls)
+}
+
+// listState records the links and the widths of a node list. The line breaker
+// cuts the list into lines, inserts the pre-break material of discretionary
+// hyphens and sets the glue, so the list must be restored before it is
+// broken again. Copies of the nodes would lose their attributes.
+type listState struct {
+	nodes  []node.Node
+	widths []bag.ScaledPoint
+	index  map[node.Node]int
+	// the pre-break material of the discretionary hyphens
+	pre map[*node.Disc]listLinks
+}
+
+// listLinks holds the neighbours and the width of a node.
+type listLinks struct {
+	prev, next node.Node
+	width      bag.ScaledPoint
+}
+
+func saveList(head node.Node) *listState {
+	st := &listState{index: map[node.Node]int{}, pre: map[*node.Disc]listLinks{}}
+	for e := head; e != nil; e = e.Next() {
+		st.index[e] = len(st.nodes)
+		st.nodes = append(st.nodes, e)
+		st.widths = append(st.widths, nodeWidth(e))
+		if d, ok := e.(*node.Disc); ok && d.Pre != nil {
+			st.pre[d] = listLinks{prev: d.Pre.Prev(), next: d.Pre.Next(), width: nodeWidth(d.Pre)}
+		}
+	}
+	return st
+}
+
+// restore links the nodes from the index from on again and resets their
+// widths. It returns the first node.
+func (st *listState) restore(from int) node.Node {
+	nodes := st.nodes[from:]
+	for i, n := range nodes {
+		var prev, next node.Node
+		if i > 0 {
+			prev = nodes[i-1]
+		}
+		if i < len(nodes)-1 {
+			next = nodes[i+1]
+		}
+		n.SetPrev(prev)
+		n.SetNext(next)
+		setNodeWidth(n, st.widths[from+i])
+		if d, ok := n.(*node.Disc); ok && d.Pre != nil {
+			l := st.pre[d]
+			d.Pre.SetPrev(l.prev)
+			d.Pre.SetNext(l.next)
+			setNodeWidth(d.Pre, l.width)
+		}
+	}
+	return nodes[0]
+}
+
+// nodeWidth returns the width of glue and glyph nodes, the nodes the line
+// breaker changes.
+func nodeWidth(n node.Node) bag.ScaledPoint {
+	switch t := n.(type) {
+	case *node.Glue:
+		return t.Width
+	case *node.Glyph:
+		return t.Width
+	}
+	return 0
+}
+
+func setNodeWidth(n node.Node, wd bag.ScaledPoint) {
+	switch t := n.(type) {
+	case *node.Glue:
+		t.Width = wd
+	case *node.Glyph:
+		t.Width = wd
+	}
+}
+
+// breakerIndent returns the indentation the line breaker has given to the
+// line with the given row (starting at 0).
+func breakerIndent(ls *node.LinebreakSettings, row int) bag.ScaledPoint {
+	switch rows := ls.IndentRows; {
+	case rows > 0 && row >= rows, rows < 0 && row < -rows:
+		return 0
+	}
+	return ls.Indent
+}
+
+// setLineIndent moves the contents of the line hl by delta to the right.
+func setLineIndent(hl *node.HList, delta bag.ScaledPoint) {
+	for e := hl.List; e != nil; e = e.Next() {
+		if g, ok := e.(*node.Glue); ok && g.Attributes["origin"] == "leftskip" {
+			g.Width += delta
+			hl.Width += delta
+			return
+		}
+	}
+}
+
+// setParagraphHeight adds space above and below the paragraph vl if the text
+// has a height setting.
+func setParagraphHeight(te *frontend.Text, vl *node.VList) *node.VList {
+	ht, ok := te.Settings[frontend.SettingHeight].(bag.ScaledPoint)
+	if !ok {
+		return vl
+	}
+	moreHeight := ht - vl.Height - vl.Depth
+	topGlue := node.NewGlue()
+	bottomGlue := node.NewGlue()
+	valign, ok := te.Settings[frontend.SettingVAlign].(frontend.VerticalAlignment)
+	if !ok {
+		valign = frontend.VAlignMiddle
+	}
+	switch valign {
+	case frontend.VAlignTop:
+		bottomGlue.Width = moreHeight
+	case frontend.VAlignBottom:
+		topGlue.Width = moreHeight
+	default:
+		bottomGlue.Width = moreHeight / 2
+		topGlue.Width = moreHeight / 2
+	}
+	var head node.Node
+	if topGlue.Width != 0 {
+		head = topGlue
+	}
+	head = node.InsertAfter(head, head, vl)
+	if bottomGlue.Width != 0 {
+		head = node.InsertAfter(head, vl, bottomGlue)
+	}
+	wd := vl.Width
+	vl = node.Vpack(head)
+	vl.Width = wd
+	vl.Attributes = node.H{"origin": "format_paragraph, setHeight"}
+	return vl
+}
@@ -0,0 +1,246 @@
+package frontend
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const testParagraph = "The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs. How vexingly quick daft zebras jump! Sphinx of black quartz, judge my vow. The five boxing wizards jump quickly."
+
+func newTestDocument(t *testing.T) (*frontend.Document, *frontend.FontFamily) {
+	t.Helper()
+	fe, err := frontend.NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff := fe.NewFontFamily("text")
+	fs := &frontend.FontSource{Name: "Go Regular", Data: goregular.TTF}
+	if err = ff.AddMember(fs, frontend.FontWeight400, frontend.FontStyleNormal); err != nil {
+		t.Fatal(err)
+	}
+	return fe, ff
+}
+
+// newTestText returns a new text because typesetting changes the text.
+func newTestText(ff *frontend.FontFamily, items ...any) *frontend.Text {
+	te := frontend.NewText()
+	te.Settings[frontend.SettingFontFamily] = ff
+	te.Settings[frontend.SettingSize] = 10 * bag.Factor
+	te.Items = items
+	return te
+}
+
+// testLines returns the lines of a formatted paragraph.
+func testLines(vl *node.VList) []*node.HList {
+	var lines []*node.HList
+	for e := vl.List; e != nil; e = e.Next() {
+		switch t := e.(type) {
+		case *node.HList:
+			if t.Attributes["origin"] == "line" {
+				lines = append(lines, t)
+			}
+		case *node.VList:
+			lines = append(lines, testLines(t)...)
+		}
+	}
+	return lines
+}
+
+// testLineText returns the characters of the line without hyphens.
+func testLineText(n node.Node) string {
+	var sb strings.Builder
+	for e := n; e != nil; e = e.Next() {
+		switch t := e.(type) {
+		case *node.Glyph:
+			sb.WriteString(strings.ReplaceAll(t.Components, "-", ""))
+		case *node.HList:
+			sb.WriteString(testLineText(t.List))
+		}
+	}
+	return sb.String()
+}
+
+func countRules(n node.Node) int {
+	count := 0
+	for e := n; e != nil; e = e.Next() {
+		switch t := e.(type) {
+		case *node.Rule:
+			count++
+		case *node.HList:
+			count += countRules(t.List)
+		case *node.VList:
+			count += countRules(t.List)
+		}
+	}
+	return count
+}
+
+func TestPostLinebreakCallbacks(t *testing.T) {
+	fe, _ := newTestDocument(t)
+	callbacks, err := postLinebreakCallbacks(fe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(callbacks) == 0 {
+		t.Error("a new document has no post line break callbacks, want the underline callback")
+	}
+}
+
+// TestBreakParagraphRectangle compares breakParagraph with
+// frontend.FormatParagraph and the line breaker of boxesandglue.
+func TestBreakParagraphRectangle(t *testing.T) {
+	fe, ff := newTestDocument(t)
+	underlined := func() *frontend.Text {
+		u := frontend.NewText()
+		u.Settings[frontend.SettingTextDecorationLine] = frontend.TextDecorationUnderline
+		u.Items = []any{"over the lazy dog"}
+		return u
+	}
+	opts := []frontend.TypesettingOption{frontend.FontSize(10 * bag.Factor)}
+	for _, wd := range []bag.ScaledPoint{100 * bag.Factor, 150 * bag.Factor, 250 * bag.Factor} {
+		want, _, err := fe.FormatParagraph(newTestText(ff, testParagraph, underlined()), wd, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := breakParagraph(fe, newTestText(ff, testParagraph, underlined()), rectangleShape(wd), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantLines, gotLines := testLines(want), testLines(got.vlist)
+		if len(gotLines) != len(wantLines) || len(got.lines) != len(wantLines) {
+			t.Fatalf("width %s: %d lines (%d infos), want %d", wd, len(gotLines), len(got.lines), len(wantLines))
+		}
+		for i, wl := range wantLines {
+			gl := gotLines[i]
+			if testLineText(gl.List) != testLineText(wl.List) {
+				t.Errorf("width %s, line %d: %q, want %q", wd, i+1, testLineText(gl.List), testLineText(wl.List))
+			}
+			if gl.Width != wl.Width || gl.GlueSet != wl.GlueSet {
+				t.Errorf("width %s, line %d: width %s ratio %g, want %s %g", wd, i+1, gl.Width, gl.GlueSet, wl.Width, wl.GlueSet)
+			}
+			li, wli := got.lines[i], newLineInfo(wl)
+			if li.natural != wli.natural || li.badness != wli.badness {
+				t.Errorf("width %s, line %d: natural width %s badness %d, want %s %d", wd, i+1, li.natural, li.badness, wli.natural, wli.badness)
+			}
+		}
+		if got.vlist.Height != want.Height || got.vlist.Depth != want.Depth {
+			t.Errorf("width %s: height %s depth %s, want %s %s", wd, got.vlist.Height, got.vlist.Depth, want.Height, want.Depth)
+		}
+		// the underline callback of the document inserts rules
+		if n, wn := countRules(got.vlist.List), countRules(want.List); n != wn || n == 0 {
+			t.Errorf("width %s: %d rules, want %d", wd, n, wn)
+		}
+
+		// the demerits of the line breaker
+		te := newTestText(ff, testParagraph, underlined())
+		hlist, tail, err := fe.Mknodes(te)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frontend.Hyphenate(hlist, fe.Doc.DefaultLanguage)
+		node.AppendLineEndAfter(hlist, tail)
+		ls := node.NewLinebreakSettings()
+		ls.HSize = wd
+		ls.Tolerance = 4
+		ls.LineHeight = 12 * bag.Factor
+		_, bps := node.Linebreak(hlist, ls)
+		if d := got.demerits(); d != bps[len(bps)-1].Demerits {
+			t.Errorf("width %s: demerits %d, want %d", wd, d, bps[len(bps)-1].Demerits)
+		}
+	}
+}
+
+// TestBreakParagraphShape breaks a paragraph with several runs of line
+// widths.
+func TestBreakParagraphShape(t *testing.T) {
+	fe, ff := newTestDocument(t)
+	pt := bag.Factor
+	shape := []parshapeLine{
+		{indent: 0, width: 120 * pt},
+		{indent: 0, width: 120 * pt},
+		{indent: 30 * pt, width: 90 * pt},
+		{indent: 30 * pt, width: 90 * pt},
+		{indent: 10 * pt, width: 200 * pt},
+		{indent: 0, width: 150 * pt},
+	}
+	items := []any{testParagraph + " " + testParagraph}
+	got, err := breakParagraph(fe, newTestText(ff, items...), listShape(shape), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := testLines(got.vlist)
+	if len(lines) < len(shape) {
+		t.Fatalf("%d lines, want at least %d", len(lines), len(shape))
+	}
+	if len(got.lines) != len(lines) {
+		t.Errorf("%d line infos for %d lines", len(got.lines), len(lines))
+	}
+	var text strings.Builder
+	for i, hl := range lines {
+		psl := shape[min(i, len(shape)-1)]
+		if hl.Width != psl.indent+psl.width {
+			t.Errorf("line %d: width %s, want %s", i+1, hl.Width, psl.indent+psl.width)
+		}
+		// the natural width includes the indentation
+		if natural := got.lines[i].natural - psl.indent; i < len(lines)-1 && (natural > psl.width+psl.width/10 || natural < psl.width/2) {
+			t.Errorf("line %d: natural width %s for a line of %s", i+1, natural, psl.width)
+		}
+		text.WriteString(testLineText(hl.List))
+	}
+	want := strings.NewReplacer(" ", "", "-", "").Replace(items[0].(string))
+	if text.String() != want {
+		t.Errorf("the lines contain %q, want %q", text.String(), want)
+	}
+}
+
+// TestBreakParagraphIndent checks that the line breaks depend only on the line
+// widths, not on the indentation.
+func TestBreakParagraphIndent(t *testing.T) {
+	fe, ff := newTestDocument(t)
+	pt := bag.Factor
+	want, err := breakParagraph(fe, newTestText(ff, testParagraph), rectangleShape(120*pt), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape := []parshapeLine{
+		{indent: 0, width: 120 * pt},
+		{indent: 20 * pt, width: 120 * pt},
+		{indent: 40 * pt, width: 120 * pt},
+		{indent: 0, width: 120 * pt},
+	}
+	got, err := breakParagraph(fe, newTestText(ff, testParagraph), listShape(shape), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLines, gotLines := testLines(want.vlist), testLines(got.vlist)
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("%d lines, want %d", len(gotLines), len(wantLines))
+	}
+	for i := range wantLines {
+		if g, w := testLineText(gotLines[i].List), testLineText(wantLines[i].List); g != w {
+			t.Errorf("line %d: %q, want %q", i+1, g, w)
+		}
+		if got.lines[i].badness != want.lines[i].badness || got.lines[i].demerits != want.lines[i].demerits {
+			t.Errorf("line %d: badness %d demerits %d, want %d %d", i+1, got.lines[i].badness, got.lines[i].demerits, want.lines[i].badness, want.lines[i].demerits)
+		}
+		psl := shape[min(i, len(shape)-1)]
+		if gotLines[i].Width != psl.indent+psl.width {
+			t.Errorf("line %d: width %s, want %s", i+1, gotLines[i].Width, psl.indent+psl.width)
+		}
+	}
+	// a wide first line takes more text than the narrow lines
+	shape = []parshapeLine{{width: 300 * pt}, {width: 100 * pt}}
+	got, err = breakParagraph(fe, newTestText(ff, testParagraph), listShape(shape), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.lines) < 2 || got.lines[0].natural <= 200*pt || got.lines[1].natural > 110*pt {
+		t.Errorf("wide first line: natural widths of the first lines are not 300pt and 100pt")
+	}
+}
@@ -0,0 +1,474 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/boxesandglue/cli/risor/svg"
+	"github.com/risor-io/risor/object"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	gtext "github.com/yuin/goldmark/text"
+)
+
+// markdownHeadingSizes are the font size factors of the headings h1 to h6.
+var markdownHeadingSizes = []float64{2, 1.5, 1.17, 1, 0.83, 0.67}
+
+// markdownConverter turns a Markdown document into paragraphs that can be
+// formatted with formatBlocks.
+type markdownConverter struct {
+	fd       *frontendDocument
+	source   []byte
+	width    bag.ScaledPoint
+	fontSize bag.ScaledPoint
+	// The settings of every paragraph (font family and size).
+	base frontend.TypesettingSettings
+	// Element type to style name.
+	styles map[string]string
+	blocks []*frontend.Text
+	// The left indentation of lists and block quotes.
+	indent bag.ScaledPoint
+	// The list marker for the next paragraph.
+	marker string
+	// The element type for paragraphs, "p" or "blockquote".
+	paragraph string
+	tight     bool
+}
+
+// settings returns the settings of the element type: first the base settings,
+// then the defaults and finally the settings of the text style.
+func (c *markdownConverter) settings(elt string, defaults frontend.TypesettingSettings) (frontend.TypesettingSettings, error) {
+	ret := frontend.TypesettingSettings{}
+	for k, v := range c.base {
+		ret[k] = v
+	}
+	for k, v := range defaults {
+		ret[k] = v
+	}
+	if err := c.addStyle(ret, elt); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// addStyle adds the settings of the text style of the element type to
+// settings. The style is the one given in the styles option or the style with
+// the name of the element type if it is defined.
+func (c *markdownConverter) addStyle(settings frontend.TypesettingSettings, elt string) error {
+	name, ok := c.styles[elt]
+	if !ok {
+		if _, defined := c.fd.styles[elt]; !defined {
+			return nil
+		}
+		name = elt
+	}
+	ss, err := c.fd.styleSettings(name)
+	if err != nil {
+		return fmt.Errorf("styles: %s: %w", elt, err)
+	}
+	for k, v := range ss {
+		settings[k] = v
+	}
+	return nil
+}
+
+// newBlock starts a new paragraph with the settings of the element type.
+func (c *markdownConverter) newBlock(elt string, defaults frontend.TypesettingSettings) (*frontend.Text, error) {
+	settings, err := c.settings(elt, defaults)
+	if err != nil {
+		return nil, err
+	}
+	te := frontend.NewText()
+	te.Settings = settings
+	ml, _ := te.Settings[frontend.SettingMarginLeft].(bag.ScaledPoint)
+	te.Settings[frontend.SettingMarginLeft] = ml + c.indent
+	if c.tight {
+		te.Settings[frontend.SettingMarginTop] = bag.ScaledPoint(0)
+		te.Settings[frontend.SettingMarginBottom] = bag.ScaledPoint(0)
+	}
+	if c.marker != "" {
+		te.Items = append(te.Items, c.marker)
+		c.marker = ""
+	}
+	c.blocks = append(c.blocks, te)
+	return te, nil
+}
+
+// newInline returns a text for inline content with the settings of the
+// element type: first the defaults, then the settings of the text style. The
+// other settings are inherited from the surrounding text.
+func (c *markdownConverter) newInline(elt string, defaults frontend.TypesettingSettings) (*frontend.Text, error) {
+	te := frontend.NewText()
+	for k, v := range defaults {
+		te.Settings[k] = v
+	}
+	if err := c.addStyle(te.Settings, elt); err != nil {
+		return nil, err
+	}
+	return te, nil
+}
+
+func (c *markdownConverter) em(f float64, size bag.ScaledPoint) bag.ScaledPoint {
+	return bag.MultiplyFloat(size, f)
+}
+
+func (c *markdownConverter) monospace(settings frontend.TypesettingSettings) frontend.TypesettingSettings {
+	if ff := c.fd.value.FindFontFamily("monospace"); ff != nil {
+		settings[frontend.SettingFontFamily] = ff
+	}
+	return settings
+}
+
+func (c *markdownConverter) children(n ast.Node) error {
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if err := c.block(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *markdownConverter) block(n ast.Node) error {
+	switch t := n.(type) {
+	case *ast.Heading:
+		size := c.em(markdownHeadingSizes[min(t.Level, 6)-1], c.fontSize)
+		te, err := c.newBlock("h"+strconv.Itoa(t.Level), frontend.TypesettingSettings{
+			frontend.SettingSize:         size,
+			frontend.SettingFontWeight:   frontend.FontWeight700,
+			frontend.SettingMarginTop:    c.em(0.8, size),
+			frontend.SettingMarginBottom: c.em(0.4, size),
+		})
+		if err != nil {
+			return err
+		}
+		return c.inlines(te, n)
+	case *ast.Paragraph, *ast.TextBlock:
+		te, err := c.newBlock(c.paragraph, frontend.TypesettingSettings{
+			frontend.SettingMarginTop:    c.em(0.5, c.fontSize),
+			frontend.SettingMarginBottom: c.em(0.5, c.fontSize),
+		})
+		if err != nil {
+			return err
+		}
+		return c.inlines(te, n)
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		te, err := c.newBlock("code", c.monospace(frontend.TypesettingSettings{
+			frontend.SettingPreserveWhitespace: true,
+			frontend.SettingHAlign:             frontend.HAlignLeft,
+			frontend.SettingMarginTop:          c.em(0.5, c.fontSize),
+			frontend.SettingMarginBottom:       c.em(0.5, c.fontSize),
+		}))
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			b.Write(seg.Value(c.source))
+		}
+		te.Items = append(te.Items, strings.TrimRight(b.String(), "\n"))
+		return nil
+	case *ast.ThematicBreak:
+		te, err := c.newBlock("hr", frontend.TypesettingSettings{
+			frontend.SettingMarginTop:    c.em(0.5, c.fontSize),
+			frontend.SettingMarginBottom: c.em(0.5, c.fontSize),
+		})
+		if err != nil {
+			return err
+		}
+		ml, _ := te.Settings[frontend.SettingMarginLeft].(bag.ScaledPoint)
+		mr, _ := te.Settings[frontend.SettingMarginRight].(bag.ScaledPoint)
+		r := node.NewRule()
+		r.Width = c.width - ml - mr
+		r.Height = bag.MustSP("0.4pt")
+		te.Items = append(te.Items, r)
+		return nil
+	case *ast.Blockquote:
+		oldIndent, oldParagraph := c.indent, c.paragraph
+		c.indent += c.em(1.5, c.fontSize)
+		c.paragraph = "blockquote"
+		err := c.children(n)
+		c.indent, c.paragraph = oldIndent, oldParagraph
+		return err
+	case *ast.List:
+		oldIndent, oldTight := c.indent, c.tight
+		c.indent += c.em(1.5, c.fontSize)
+		c.tight = t.IsTight
+		counter := t.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			if t.IsOrdered() {
+				c.marker = strconv.Itoa(counter) + ". "
+				counter++
+			} else {
+				c.marker = "• "
+			}
+			oldParagraph := c.paragraph
+			c.paragraph = "li"
+			if err := c.children(item); err != nil {
+				return err
+			}
+			c.paragraph = oldParagraph
+		}
+		c.indent, c.tight = oldIndent, oldTight
+		return nil
+	case *east.Table:
+		return c.table(t)
+	case *ast.HTMLBlock:
+		// raw HTML is not rendered
+		return nil
+	}
+	return c.children(n)
+}
+
+func (c *markdownConverter) table(n *east.Table) error {
+	tbl := &frontend.Table{}
+	border := bag.MustSP("0.4pt")
+	padding := bag.MustSP("2pt")
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		elt := "td"
+		if row.Kind() == east.KindTableHeader {
+			elt = "th"
+		}
+		tr := &frontend.TableRow{}
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			defaults := frontend.TypesettingSettings{}
+			if elt == "th" {
+				defaults[frontend.SettingFontWeight] = frontend.FontWeight700
+			}
+			settings, err := c.settings(elt, defaults)
+			if err != nil {
+				return err
+			}
+			te := frontend.NewText()
+			te.Settings = settings
+			if err = c.inlines(te, cell); err != nil {
+				return err
+			}
+			td := &frontend.TableCell{
+				BorderTopWidth:    border,
+				BorderBottomWidth: border,
+				BorderLeftWidth:   border,
+				BorderRightWidth:  border,
+				PaddingTop:        padding,
+				PaddingBottom:     padding,
+				PaddingLeft:       padding,
+				PaddingRight:      padding,
+				Contents:          []any{te},
+			}
+			if tc, ok := cell.(*east.TableCell); ok {
+				switch tc.Alignment {
+				case east.AlignLeft:
+					td.HAlign = frontend.HAlignLeft
+				case east.AlignRight:
+					td.HAlign = frontend.HAlignRight
+				case east.AlignCenter:
+					td.HAlign = frontend.HAlignCenter
+				}
+			}
+			tr.Cells = append(tr.Cells, td)
+		}
+		tbl.Rows = append(tbl.Rows, tr)
+	}
+	te, err := c.newBlock("table", frontend.TypesettingSettings{
+		frontend.SettingMarginTop:    c.em(0.5, c.fontSize),
+		frontend.SettingMarginBottom: c.em(0.5, c.fontSize),
+	})
+	if err != nil {
+		return err
+	}
+	te.Items = append(te.Items, tbl)
+	return nil
+}
+
+// inlines adds the inline content of n to te.
+func (c *markdownConverter) inlines(te *frontend.Text, n ast.Node) error {
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch t := child.(type) {
+		case *ast.Text:
+			te.Items = append(te.Items, string(t.Segment.Value(c.source)))
+			if t.HardLineBreak() {
+				te.Items = append(te.Items, "\n")
+			} else if t.SoftLineBreak() {
+				te.Items = append(te.Items, " ")
+			}
+		case *ast.String:
+			te.Items = append(te.Items, string(t.Value))
+		case *ast.CodeSpan:
+			inl, err := c.newInline("codespan", c.monospace(frontend.TypesettingSettings{}))
+			if err != nil {
+				return err
+			}
+			if err = c.inlines(inl, child); err != nil {
+				return err
+			}
+			te.Items = append(te.Items, inl)
+		case *ast.Emphasis:
+			elt, defaults := "em", frontend.TypesettingSettings{frontend.SettingStyle: frontend.FontStyleItalic}
+			if t.Level == 2 {
+				elt, defaults = "strong", frontend.TypesettingSettings{frontend.SettingFontWeight: frontend.FontWeight700}
+			}
+			inl, err := c.newInline(elt, defaults)
+			if err != nil {
+				return err
+			}
+			if err = c.inlines(inl, child); err != nil {
+				return err
+			}
+			te.Items = append(te.Items, inl)
+		case *east.Strikethrough:
+			inl, err := c.newInline("del", frontend.TypesettingSettings{frontend.SettingTextDecorationLine: frontend.TextDecorationLineThrough})
+			if err != nil {
+				return err
+			}
+			if err = c.inlines(inl, child); err != nil {
+				return err
+			}
+			te.Items = append(te.Items, inl)
+		case *ast.Link:
+			inl, err := c.newInline("a", frontend.TypesettingSettings{frontend.SettingHyperlink: convertHyperlinkString(string(t.Destination))})
+			if err != nil {
+				return err
+			}
+			if err = c.inlines(inl, child); err != nil {
+				return err
+			}
+			te.Items = append(te.Items, inl)
+		case *ast.AutoLink:
+			url := string(t.URL(c.source))
+			if t.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(url, "mailto:") {
+				url = "mailto:" + url
+			}
+			inl, err := c.newInline("a", frontend.TypesettingSettings{frontend.SettingHyperlink: convertHyperlinkString(url)})
+			if err != nil {
+				return err
+			}
+			inl.Items = append(inl.Items, string(t.Label(c.source)))
+			te.Items = append(te.Items, inl)
+		case *ast.Image:
+			img, err := c.image(string(t.Destination), te)
+			if err != nil {
+				return err
+			}
+			te.Items = append(te.Items, img)
+		case *ast.RawHTML:
+			// ignore
+		default:
+			if err := c.inlines(te, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// image loads the image and scales it down to the width of the paragraph.
+func (c *markdownConverter) image(filename string, te *frontend.Text) (node.Node, error) {
+	if svg.IsSVG(filename) {
+		pdfFilename, err := svg.ToPDF(filename, c.fd.svgFonts)
+		if err != nil {
+			return nil, err
+		}
+		filename = pdfFilename
+	}
+	imgf, err := c.fd.value.Doc.LoadImageFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	img := c.fd.value.Doc.CreateImageNodeFromImagefile(imgf, 1, "/MediaBox")
+	ml, _ := te.Settings[frontend.SettingMarginLeft].(bag.ScaledPoint)
+	mr, _ := te.Settings[frontend.SettingMarginRight].(bag.ScaledPoint)
+	if avail := c.width - ml - mr; img.Width > avail && img.Width > 0 {
+		img.Height = bag.ScaledPoint(float64(img.Height) * float64(avail) / float64(img.Width))
+		img.Width = avail
+	}
+	return img, nil
+}
+
+// formatMarkdown implements f.format_markdown(md, {width, font_size, family,
+// styles}) which returns a vlist. styles maps element types (h1…h6, p, li,
+// blockquote, code, codespan, em, strong, del, a, hr, table, th, td) to names
+// of text styles.
+func (fd *frontendDocument) formatMarkdown(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgsError("frontend.format_markdown", 2, len(args))
+	}
+	source, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	opts, errObj := object.AsMap(args[1])
+	if errObj != nil {
+		return errObj
+	}
+	c := &markdownConverter{
+		fd:        fd,
+		source:    []byte(source),
+		fontSize:  12 * bag.Factor,
+		base:      frontend.TypesettingSettings{},
+		styles:    map[string]string{},
+		paragraph: "p",
+	}
+	for k, v := range opts.Value() {
+		switch k {
+		case "width":
+			sp, ok := v.(*rbag.RSP)
+			if !ok {
+				return object.ArgsErrorf("frontend.format_markdown() expects a bag.scaledpoint argument (width)")
+			}
+			c.width = sp.Value
+		case "font_size":
+			sp, ok := v.(*rbag.RSP)
+			if !ok {
+				return object.ArgsErrorf("frontend.format_markdown() expects a bag.scaledpoint argument (font_size)")
+			}
+			c.fontSize = sp.Value
+		case "family":
+			ff, ok := v.(*FontFamily)
+			if !ok {
+				return object.ArgsErrorf("frontend.format_markdown() expects a frontend.fontfamily argument (family)")
+			}
+			c.base[frontend.SettingFontFamily] = ff.Value
+		case "styles":
+			m, errObj := object.AsMap(v)
+			if errObj != nil {
+				return errObj
+			}
+			for elt, name := range m.Value() {
+				str, errObj := object.AsString(name)
+				if errObj != nil {
+					return errObj
+				}
+				if _, ok := fd.styles[str]; !ok {
+					return object.ArgsErrorf("frontend.format_markdown(): styles: %s: style %q not defined", elt, str)
+				}
+				c.styles[elt] = str
+			}
+		default:
+			return object.ArgsErrorf("frontend.format_markdown(): unknown option %s", k)
+		}
+	}
+	if c.width == 0 {
+		return object.ArgsErrorf("frontend.format_markdown() expects a width")
+	}
+	c.base[frontend.SettingSize] = c.fontSize
+	md := goldmark.New(goldmark.WithExtensions(extension.Table, extension.Strikethrough))
+	doc := md.Parser().Parse(gtext.NewReader(c.source))
+	if err := c.block(doc); err != nil {
+		return object.NewError(fmt.Errorf("format_markdown: %w", err))
+	}
+	vl, err := fd.formatBlocks(c.blocks, c.width)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return &rnode.Node{Value: vl}
+}
@@ -0,0 +1,226 @@
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/risor-io/risor/object"
+)
+
+// Marks record the page number of a position in the text. The page numbers
+// are known when the pages are shipped out, so they are written to an aux
+// file next to the PDF file and read in the next run. ref and toc return the
+// values of the previous run.
+
+const markAttribute = "mark"
+
+// mark is a labeled position in the text.
+type mark struct {
+	Label string `json:"label"`
+	Text  string `json:"text,omitempty"`
+	Level int    `json:"level,omitempty"`
+	Page  int    `json:"page"`
+}
+
+// auxData is the contents of the aux file.
+type auxData struct {
+	Marks []*mark `json:"marks"`
+}
+
+// Run holds the state of the documents created in one run of a script.
+type Run struct {
+	needsRerun bool
+}
+
+// NeedsRerun returns true if the marks of a document finished in this run
+// differ from the marks of the previous run, so the page references might be
+// wrong.
+func (r *Run) NeedsRerun() bool {
+	return r.needsRerun
+}
+
+func auxFilename(pdfname string) string {
+	return strings.TrimSuffix(pdfname, filepath.Ext(pdfname)) + ".aux"
+}
+
+// loadAux reads the marks of the previous run.
+func (fd *frontendDocument) loadAux() {
+	fd.previousMarks = make(map[string]*mark)
+	data, err := os.ReadFile(auxFilename(fd.value.Doc.Filename))
+	if err != nil {
+		return
+	}
+	var aux auxData
+	if err = json.Unmarshal(data, &aux); err != nil {
+		bag.Logger.Warn("Cannot read aux file", "error", err)
+		return
+	}
+	fd.previousToc = aux.Marks
+	for _, m := range aux.Marks {
+		fd.previousMarks[m.Label] = m
+	}
+}
+
+// writeAux writes the marks of this run and returns true if they have
+// changed.
+func (fd *frontendDocument) writeAux() (bool, error) {
+	filename := auxFilename(fd.value.Doc.Filename)
+	old, err := os.ReadFile(filename)
+	if err != nil && len(fd.marks) == 0 {
+		// no marks in this and in the previous run
+		return false, nil
+	}
+	// pages with header or footer are shipped out at the end
+	sort.SliceStable(fd.marks, func(a, b int) bool {
+		return fd.marks[a].Page < fd.marks[b].Page
+	})
+	data, err := json.MarshalIndent(auxData{Marks: fd.marks}, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(old, data), os.WriteFile(filename, data, 0o644)
+}
+
+// recordMarks is called before each page shipout and stores the page number
+// of the marks on the page.
+func (fd *frontendDocument) recordMarks(page *document.Page) {
+	number := 0
+	for i, p := range fd.value.Doc.Pages {
+		if p == page {
+			number = i + 1
+			break
+		}
+	}
+	for _, obj := range page.Objects {
+		walkStartStops(obj.Vlist, func(ss *node.StartStop) {
+			if m, ok := ss.Attributes[markAttribute].(*mark); ok {
+				m.Page = number
+				fd.marks = append(fd.marks, m)
+			}
+		})
+	}
+}
+
+// textString returns the text of te without the settings.
+func textString(te *frontend.Text) string {
+	var b strings.Builder
+	for _, itm := range te.Items {
+		switch t := itm.(type) {
+		case string:
+			b.WriteString(t)
+		case *frontend.Text:
+			b.WriteString(textString(t))
+		}
+	}
+	return b.String()
+}
+
+// setMark implements f.mark(label[, {text, level}]) which returns an
+// invisible text. The page number of the page where the text is shipped out
+// is recorded for ref and toc.
+func (fd *frontendDocument) setMark(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("frontend.mark", 1, 2, len(args))
+	}
+	label, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	m := &mark{Label: label}
+	if len(args) == 2 {
+		opts, errObj := object.AsMap(args[1])
+		if errObj != nil {
+			return errObj
+		}
+		for k, v := range opts.Value() {
+			switch k {
+			case "text":
+				switch t := v.(type) {
+				case *text:
+					m.Text = textString(t.Value)
+				default:
+					if m.Text, errObj = object.AsString(v); errObj != nil {
+						return errObj
+					}
+				}
+			case "level":
+				i, errObj := object.AsInt(v)
+				if errObj != nil {
+					return errObj
+				}
+				m.Level = int(i)
+			default:
+				return object.ArgsErrorf("frontend.mark(): unknown option %s", k)
+			}
+		}
+	}
+	marker := node.NewStartStop()
+	marker.Attributes = markerAttributes(markAttribute, m)
+	te := frontend.NewText()
+	te.Items = append(te.Items, marker)
+	return &text{Value: te}
+}
+
+// ref implements f.ref(label) which returns the page number of the mark from
+// the previous run or nil if the mark is not known yet.
+func (fd *frontendDocument) ref(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewArgsError("frontend.ref", 1, len(args))
+	}
+	label, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	if m, ok := fd.previousMarks[label]; ok {
+		return object.NewInt(int64(m.Page))
+	}
+	return object.Nil
+}
+
+// toc implements f.toc([{max_level}]) which returns the marks with a level
+// from the previous run as a list of maps with the keys label, text, level
+// and page.
+func (fd *frontendDocument) toc(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return object.NewArgsRangeError("frontend.toc", 0, 1, len(args))
+	}
+	maxLevel := int64(0)
+	if len(args) == 1 {
+		opts, errObj := object.AsMap(args[0])
+		if errObj != nil {
+			return errObj
+		}
+		for k, v := range opts.Value() {
+			switch k {
+			case "max_level":
+				if maxLevel, errObj = object.AsInt(v); errObj != nil {
+					return errObj
+				}
+			default:
+				return object.ArgsErrorf("frontend.toc(): unknown option %s", k)
+			}
+		}
+	}
+	lst := object.NewList(nil)
+	for _, m := range fd.previousToc {
+		if m.Level == 0 || (maxLevel > 0 && int64(m.Level) > maxLevel) {
+			continue
+		}
+		lst.Append(object.NewMap(map[string]object.Object{
+			"label": object.NewString(m.Label),
+			"text":  object.NewString(m.Text),
+			"level": object.NewInt(int64(m.Level)),
+			"page":  object.NewInt(int64(m.Page)),
+		}))
+	}
+	return lst
+}
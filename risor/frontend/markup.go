@@ -0,0 +1,180 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/risor-io/risor/object"
+)
+
+// The inline markup understood by parse_markup:
+//
+//	<b>…</b>, <strong>…</strong>   bold
+//	<i>…</i>, <em>…</em>           italic
+//	<u>…</u>                       underline
+//	<a href="uri">…</a>            hyperlink
+//	<br> or <br/>                  line break
+//	<span size="14pt" …>…</span>   any text setting as an attribute, the
+//	                               attribute class sets a named style
+//
+// The entities &amp;, &lt;, &gt;, &quot; and &apos; can be used for the
+// special characters.
+
+var markupEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&amp;", "&")
+
+type markupTag struct {
+	name  string
+	attrs [][2]string
+	// closing is true for </name>, selfClosing for <name/>.
+	closing     bool
+	selfClosing bool
+}
+
+// parseMarkup turns the markup into a text. The items of the returned text
+// are strings and texts. The class attribute sets the style name of a text.
+func parseMarkup(str string) (*frontend.Text, error) {
+	root := frontend.NewText()
+	stack := []*frontend.Text{root}
+	names := []string{""}
+	for len(str) > 0 {
+		pos := strings.IndexByte(str, '<')
+		if pos == -1 {
+			pos = len(str)
+		}
+		if pos > 0 {
+			cur := stack[len(stack)-1]
+			cur.Items = append(cur.Items, markupEntities.Replace(str[:pos]))
+			str = str[pos:]
+			continue
+		}
+		end := strings.IndexByte(str, '>')
+		if end == -1 {
+			return nil, fmt.Errorf("markup: unterminated tag %q", str)
+		}
+		tag, err := parseMarkupTag(str[1:end])
+		if err != nil {
+			return nil, err
+		}
+		str = str[end+1:]
+		cur := stack[len(stack)-1]
+		if tag.closing {
+			if names[len(names)-1] != tag.name {
+				return nil, fmt.Errorf("markup: unexpected closing tag </%s>", tag.name)
+			}
+			stack = stack[:len(stack)-1]
+			names = names[:len(names)-1]
+			continue
+		}
+		if tag.name == "br" {
+			cur.Items = append(cur.Items, "\n")
+			continue
+		}
+		te := frontend.NewText()
+		if err = applyMarkupTag(te, tag); err != nil {
+			return nil, err
+		}
+		cur.Items = append(cur.Items, te)
+		if !tag.selfClosing {
+			stack = append(stack, te)
+			names = append(names, tag.name)
+		}
+	}
+	if len(names) > 1 {
+		return nil, fmt.Errorf("markup: missing closing tag </%s>", names[len(names)-1])
+	}
+	return root, nil
+}
+
+func parseMarkupTag(str string) (*markupTag, error) {
+	tag := &markupTag{}
+	str = strings.TrimSpace(str)
+	if strings.HasPrefix(str, "/") {
+		tag.closing = true
+		str = str[1:]
+	}
+	if strings.HasSuffix(str, "/") {
+		tag.selfClosing = true
+		str = strings.TrimSpace(str[:len(str)-1])
+	}
+	name, rest := str, ""
+	if i := strings.IndexFunc(str, unicode.IsSpace); i >= 0 {
+		name, rest = str[:i], str[i:]
+	}
+	tag.name = strings.ToLower(name)
+	rest = strings.TrimSpace(rest)
+	for rest != "" {
+		key, val, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("markup: attribute without value in <%s>", str)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		if len(val) == 0 || (val[0] != '"' && val[0] != '\'') {
+			return nil, fmt.Errorf("markup: attribute value must be quoted in <%s>", str)
+		}
+		q := val[0]
+		end := strings.IndexByte(val[1:], q)
+		if end == -1 {
+			return nil, fmt.Errorf("markup: unterminated attribute value in <%s>", str)
+		}
+		tag.attrs = append(tag.attrs, [2]string{key, markupEntities.Replace(val[1 : end+1])})
+		rest = strings.TrimSpace(val[end+2:])
+	}
+	return tag, nil
+}
+
+func applyMarkupTag(te *frontend.Text, tag *markupTag) error {
+	set := func(name, value string) error {
+		st, v, err := convertSetting(name, object.NewString(value))
+		if err != nil {
+			return fmt.Errorf("markup: <%s>: %w", tag.name, err)
+		}
+		te.Settings[st] = v
+		return nil
+	}
+	switch tag.name {
+	case "b", "strong":
+		return set("fontweight", "bold")
+	case "i", "em":
+		return set("style", "italic")
+	case "u":
+		return set("textdecorationline", "underline")
+	case "a":
+		for _, attr := range tag.attrs {
+			if attr[0] == "href" {
+				return set("hyperlink", attr[1])
+			}
+		}
+		return fmt.Errorf("markup: <a> without href")
+	case "span":
+		for _, attr := range tag.attrs {
+			if attr[0] == "class" {
+				setStyleName(te, attr[1])
+				continue
+			}
+			if err := set(attr[0], attr[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("markup: unknown tag <%s>", tag.name)
+}
+
+func frontendParseMarkup(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.ArgsErrorf("frontend.parse_markup() takes exactly one argument")
+	}
+	str, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	te, err := parseMarkup(str)
+	if err != nil {
+		return object.NewError(err)
+	}
+	return &text{Value: te}
+}
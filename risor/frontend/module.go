@@ -3,6 +3,7 @@ package frontend
 import (
 	"context"
 
+	backenddoc "github.com/boxesandglue/boxesandglue/backend/document"
 	"github.com/boxesandglue/boxesandglue/frontend"
 	"github.com/boxesandglue/cli/risor/backend/document"
 	rlang "github.com/boxesandglue/cli/risor/backend/lang"
@@ -72,7 +73,7 @@ func frontendGetLanguage(ctx context.Context, args ...object.Object) object.Obje
 	return backendLang
 }
 
-func frontendNew(ctx context.Context, args ...object.Object) object.Object {
+func (r *Run) frontendNew(ctx context.Context, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return object.ArgsErrorf("frontend.new() takes exactly one argument")
 	}
@@ -85,24 +86,65 @@ func frontendNew(ctx context.Context, args ...object.Object) object.Object {
 	if err != nil {
 		return object.NewError(err)
 	}
-	fd := &frontendDocument{value: doc, doc: &document.Document{PDFDoc: doc.Doc, Attachments: object.NewList(nil)}}
+	fd := &frontendDocument{value: doc, doc: &document.Document{PDFDoc: doc.Doc, Attachments: object.NewList(nil)}, run: r}
+	fd.doc.BeforeFinish = fd.beforeFinish
+	fd.svgFonts = &svgFonts{doc: doc}
+	fd.doc.SVGFonts = fd.svgFonts
+	doc.Doc.RegisterCallback(backenddoc.CallbackPreShipout, fd.recordMarks)
+	doc.Doc.RegisterCallback(backenddoc.CallbackPreShipout, fd.placeDrawings)
+	fd.loadAux()
 	return fd
 }
 
+// newText creates a new text. The optional map argument can contain the name
+// of a style (class), the items of the text (items) and any text setting.
 func newText(ctx context.Context, args ...object.Object) object.Object {
-	return &text{Value: frontend.NewText()}
+	txt := &text{Value: frontend.NewText()}
+	if len(args) == 0 {
+		return txt
+	}
+	if len(args) != 1 {
+		return object.NewArgsRangeError("frontend.new_text", 0, 1, len(args))
+	}
+	m, errObj := object.AsMap(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	s := &settings{txt: txt.Value}
+	for _, k := range m.SortedKeys() {
+		var err error
+		switch k {
+		case "class", "items":
+			err = txt.SetAttr(k, m.Get(k))
+		default:
+			err = s.SetAttr(k, m.Get(k))
+		}
+		if err != nil {
+			return object.ArgsErrorf("frontend.new_text(): %s", err)
+		}
+	}
+	return txt
 }
 
 // Module returns the frontend module.
 func Module() *object.Module {
+	return new(Run).Module()
+}
+
+// Module returns the frontend module for a run of a script. The documents
+// created with the module report to r whether another run is needed.
+func (r *Run) Module() *object.Module {
 	return object.NewBuiltinsModule("frontend", map[string]object.Object{
-		"new":               object.NewBuiltin("frontend.new", frontendNew),
+		"new":               object.NewBuiltin("frontend.new", r.frontendNew),
 		"get_language":      object.NewBuiltin("frontend.get_language", frontendGetLanguage),
+		"load_css":          object.NewBuiltin("frontend.load_css", frontendLoadCSS),
 		"new_fontsource":    object.NewBuiltin("frontend.new_fontsource", frontendNewFontsource),
 		"new_text":          object.NewBuiltin("frontend.new_text", newText),
+		"parse_markup":      object.NewBuiltin("frontend.parse_markup", frontendParseMarkup),
 		"new_table":         object.NewBuiltin("frontend.new_table", newTable),
 		"new_tr":            object.NewBuiltin("frontend.new_tr", newTr),
 		"new_td":            object.NewBuiltin("frontend.new_td", newTd),
+		"table_from_rows":   object.NewBuiltin("frontend.table_from_rows", tableFromRows),
 		"font_weight_400":   object.NewInt(400),
 		"font_style_normal": object.NewInt(0),
 	})
@@ -0,0 +1,198 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/risor-io/risor/object"
+)
+
+// Footnotes and margin notes are inserted into a text as a mark which
+// contains an invisible start stop node. When flow places the line with the
+// node on a page, the note is placed on the same page: footnotes at the bottom
+// of the column and margin notes next to the line.
+//
+// The styles footnote, footnote_mark and margin_note are used for the notes
+// if they are defined.
+
+const (
+	footnoteAttribute   = "footnote"
+	marginNoteAttribute = "margin note"
+)
+
+// footnote is the text of a footnote.
+type footnote struct {
+	number int
+	body   *frontend.Text
+}
+
+// marginNote is the text of a margin note. side is "left" or "right".
+type marginNote struct {
+	body *frontend.Text
+	side string
+}
+
+// noteContent returns the text for the argument of footnote and margin_note.
+// Strings are parsed as markup.
+func noteContent(fn string, arg object.Object) (*frontend.Text, *object.Error) {
+	switch t := arg.(type) {
+	case *text:
+		return t.Value, nil
+	case *object.String:
+		te, err := parseMarkup(t.Value())
+		if err != nil {
+			return nil, object.NewError(err)
+		}
+		return te, nil
+	}
+	return nil, object.ArgsErrorf("%s() expects a string or a frontend.text argument", fn)
+}
+
+// footnoteMark returns the footnote number as a raised text.
+func (fd *frontendDocument) footnoteMark(number int) *frontend.Text {
+	mark := frontend.NewText()
+	if _, ok := fd.styles["footnote_mark"]; ok {
+		setStyleName(mark, "footnote_mark")
+	} else {
+		mark.Settings[frontend.SettingYOffset] = bag.MustSP("3pt")
+	}
+	mark.Items = append(mark.Items, strconv.Itoa(number))
+	return mark
+}
+
+// footnote implements f.footnote(content) which returns the footnote mark.
+// The mark must be added to a text that is placed on the page with flow.
+func (fd *frontendDocument) footnote(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewArgsError("frontend.footnote", 1, len(args))
+	}
+	content, errObj := noteContent("frontend.footnote", args[0])
+	if errObj != nil {
+		return errObj
+	}
+	fd.footnoteNumber++
+	fn := &footnote{number: fd.footnoteNumber, body: frontend.NewText()}
+	if _, ok := fd.styles["footnote"]; ok {
+		setStyleName(fn.body, "footnote")
+	}
+	fn.body.Items = append(fn.body.Items, fd.footnoteMark(fn.number), " ", content)
+
+	marker := node.NewStartStop()
+	marker.Attributes = markerAttributes(footnoteAttribute, fn)
+	txt := &text{Value: fd.footnoteMark(fn.number)}
+	txt.Value.Items = append([]any{marker}, txt.Value.Items...)
+	return txt
+}
+
+// marginNote implements f.margin_note(content[, {side}]) which returns an
+// invisible text. The note is placed in the margin next to the line that
+// contains the text. side is "right" (default) or "left".
+func (fd *frontendDocument) marginNote(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("frontend.margin_note", 1, 2, len(args))
+	}
+	content, errObj := noteContent("frontend.margin_note", args[0])
+	if errObj != nil {
+		return errObj
+	}
+	mn := &marginNote{body: frontend.NewText(), side: "right"}
+	if len(args) == 2 {
+		opts, errObj := object.AsMap(args[1])
+		if errObj != nil {
+			return errObj
+		}
+		for k, v := range opts.Value() {
+			switch k {
+			case "side":
+				if mn.side, errObj = object.AsString(v); errObj != nil {
+					return errObj
+				}
+				if mn.side != "left" && mn.side != "right" {
+					return object.ArgsErrorf("frontend.margin_note(): side must be left or right, got %s", mn.side)
+				}
+			default:
+				return object.ArgsErrorf("frontend.margin_note(): unknown option %s", k)
+			}
+		}
+	}
+	if _, ok := fd.styles["margin_note"]; ok {
+		setStyleName(mn.body, "margin_note")
+	}
+	mn.body.Items = append(mn.body.Items, content)
+
+	marker := node.NewStartStop()
+	marker.Attributes = markerAttributes(marginNoteAttribute, mn)
+	te := frontend.NewText()
+	te.Items = append(te.Items, marker)
+	return &text{Value: te}
+}
+
+// markerAttributes returns the attributes of an invisible marker node. The
+// line breaking post processing looks for the underline attribute in every
+// start stop node that has attributes, so it must be set.
+func markerAttributes(key string, value any) node.H {
+	return node.H{key: value, "underline": false}
+}
+
+// walkStartStops calls fn for every start stop node in n and its sub lists.
+func walkStartStops(n node.Node, fn func(*node.StartStop)) {
+	var walk func(head node.Node)
+	walk = func(head node.Node) {
+		for e := head; e != nil; e = e.Next() {
+			switch t := e.(type) {
+			case *node.HList:
+				walk(t.List)
+			case *node.VList:
+				walk(t.List)
+			case *node.StartStop:
+				fn(t)
+			}
+		}
+	}
+	switch t := n.(type) {
+	case *node.HList:
+		walk(t.List)
+	case *node.VList:
+		walk(t.List)
+	}
+}
+
+// collectNotes returns the footnotes and the margin notes in the node list.
+func collectNotes(n node.Node) ([]*footnote, []*marginNote) {
+	var fns []*footnote
+	var mns []*marginNote
+	walkStartStops(n, func(ss *node.StartStop) {
+		if fn, ok := ss.Attributes[footnoteAttribute].(*footnote); ok {
+			fns = append(fns, fn)
+		}
+		if mn, ok := ss.Attributes[marginNoteAttribute].(*marginNote); ok {
+			mns = append(mns, mn)
+		}
+	})
+	return fns, mns
+}
+
+// formatNote formats the text of a note with the given width. Notes without
+// a font family use the font family "text".
+func (fd *frontendDocument) formatNote(body *frontend.Text, width bag.ScaledPoint) (*node.VList, error) {
+	te, err := fd.styledText(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := te.Settings[frontend.SettingFontFamily]; !ok {
+		ff := fd.value.FindFontFamily("text")
+		if ff == nil {
+			return nil, fmt.Errorf("note without font family, define the font family text or a style for the note")
+		}
+		te.Settings[frontend.SettingFontFamily] = ff
+	}
+	info, err := formatParagraph(fd.value, &paragraphOptions{text: te, width: width})
+	if err != nil {
+		return nil, err
+	}
+	return info.vlist, nil
+}
@@ -0,0 +1,370 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rdocument "github.com/boxesandglue/cli/risor/backend/document"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// pageArea is a rectangle on the page. x and y are measured from the top left
+// corner of the page.
+type pageArea struct {
+	x      bag.ScaledPoint
+	y      bag.ScaledPoint
+	width  bag.ScaledPoint
+	height bag.ScaledPoint
+}
+
+// pageMaster describes the size, the areas and the decorations of the pages
+// created from it.
+type pageMaster struct {
+	name         string
+	width        bag.ScaledPoint
+	height       bag.ScaledPoint
+	marginTop    bag.ScaledPoint
+	marginRight  bag.ScaledPoint
+	marginBottom bag.ScaledPoint
+	marginLeft   bag.ScaledPoint
+	areas        map[string]*pageArea
+	// header and footer are called when the page is shipped out.
+	header object.Callable
+	footer object.Callable
+}
+
+// pendingPage is a page that is shipped out when the document is finished,
+// because the header or the footer needs the total number of pages.
+type pendingPage struct {
+	page   *document.Page
+	master *pageMaster
+}
+
+func (fd *frontendDocument) defaultPageMaster() *pageMaster {
+	return &pageMaster{
+		width:        fd.value.Doc.DefaultPageWidth,
+		height:       fd.value.Doc.DefaultPageHeight,
+		marginTop:    bag.MustSP("1cm"),
+		marginRight:  bag.MustSP("1cm"),
+		marginBottom: bag.MustSP("1cm"),
+		marginLeft:   bag.MustSP("1cm"),
+	}
+}
+
+// area returns the area with the given name. The area "text" is the page
+// without the margins unless it is defined explicitly.
+func (pm *pageMaster) area(name string) (*pageArea, error) {
+	if a, ok := pm.areas[name]; ok {
+		return a, nil
+	}
+	if name == "text" {
+		return &pageArea{
+			x:      pm.marginLeft,
+			y:      pm.marginTop,
+			width:  pm.width - pm.marginLeft - pm.marginRight,
+			height: pm.height - pm.marginTop - pm.marginBottom,
+		}, nil
+	}
+	return nil, fmt.Errorf("page master %q has no area %q", pm.name, name)
+}
+
+// parseMargins sets the margins from a single value, a list of one to four
+// values (in the order top, right, bottom, left like in CSS) or a map with
+// the keys top, right, bottom and left.
+func (pm *pageMaster) parseMargins(obj object.Object) error {
+	var values []object.Object
+	switch t := obj.(type) {
+	case *object.List:
+		values = t.Value()
+	case *object.Map:
+		for k, v := range t.Value() {
+			sp, err := convertSP(v)
+			if err != nil {
+				return fmt.Errorf("margins: %s: %w", k, err)
+			}
+			switch k {
+			case "top":
+				pm.marginTop = sp.(bag.ScaledPoint)
+			case "right":
+				pm.marginRight = sp.(bag.ScaledPoint)
+			case "bottom":
+				pm.marginBottom = sp.(bag.ScaledPoint)
+			case "left":
+				pm.marginLeft = sp.(bag.ScaledPoint)
+			default:
+				return fmt.Errorf("margins: unknown key %s", k)
+			}
+		}
+		return nil
+	default:
+		values = []object.Object{obj}
+	}
+	var sps []bag.ScaledPoint
+	for _, v := range values {
+		sp, err := convertSP(v)
+		if err != nil {
+			return fmt.Errorf("margins: %w", err)
+		}
+		sps = append(sps, sp.(bag.ScaledPoint))
+	}
+	switch len(sps) {
+	case 1:
+		pm.marginTop, pm.marginRight, pm.marginBottom, pm.marginLeft = sps[0], sps[0], sps[0], sps[0]
+	case 2:
+		pm.marginTop, pm.marginRight, pm.marginBottom, pm.marginLeft = sps[0], sps[1], sps[0], sps[1]
+	case 3:
+		pm.marginTop, pm.marginRight, pm.marginBottom, pm.marginLeft = sps[0], sps[1], sps[2], sps[1]
+	case 4:
+		pm.marginTop, pm.marginRight, pm.marginBottom, pm.marginLeft = sps[0], sps[1], sps[2], sps[3]
+	default:
+		return fmt.Errorf("margins: expected one to four values, got %d", len(sps))
+	}
+	return nil
+}
+
+func parsePageArea(obj object.Object) (*pageArea, error) {
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	a := &pageArea{}
+	for k, v := range m.Value() {
+		sp, err := convertSP(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		switch k {
+		case "x":
+			a.x = sp.(bag.ScaledPoint)
+		case "y":
+			a.y = sp.(bag.ScaledPoint)
+		case "width":
+			a.width = sp.(bag.ScaledPoint)
+		case "height":
+			a.height = sp.(bag.ScaledPoint)
+		default:
+			return nil, fmt.Errorf("unknown key %s", k)
+		}
+	}
+	return a, nil
+}
+
+// parsePageMaster reads the page master from a map with the keys width,
+// height, margins (or margin), margin_top, margin_right, margin_bottom,
+// margin_left, areas, header and footer. Missing page dimensions are taken
+// from the document defaults.
+func (fd *frontendDocument) parsePageMaster(m *object.Map) (*pageMaster, error) {
+	pm := fd.defaultPageMaster()
+	// margins first, so that the single margins override them
+	for _, k := range []string{"margin", "margins"} {
+		if v, ok := m.Value()[k]; ok {
+			if err := pm.parseMargins(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sp := func(key string, dest *bag.ScaledPoint) error {
+		v, err := convertSP(m.Get(key))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*dest = v.(bag.ScaledPoint)
+		return nil
+	}
+	for _, k := range m.SortedKeys() {
+		var err error
+		switch k {
+		case "margin", "margins":
+		case "width":
+			err = sp(k, &pm.width)
+		case "height":
+			err = sp(k, &pm.height)
+		case "margin_top":
+			err = sp(k, &pm.marginTop)
+		case "margin_right":
+			err = sp(k, &pm.marginRight)
+		case "margin_bottom":
+			err = sp(k, &pm.marginBottom)
+		case "margin_left":
+			err = sp(k, &pm.marginLeft)
+		case "areas":
+			areas, errObj := object.AsMap(m.Get(k))
+			if errObj != nil {
+				return nil, errObj.Value()
+			}
+			pm.areas = make(map[string]*pageArea)
+			for name, v := range areas.Value() {
+				if pm.areas[name], err = parsePageArea(v); err != nil {
+					return nil, fmt.Errorf("areas: %s: %w", name, err)
+				}
+			}
+		case "header", "footer":
+			fn, ok := m.Get(k).(object.Callable)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a function", k)
+			}
+			if k == "header" {
+				pm.header = fn
+			} else {
+				pm.footer = fn
+			}
+		default:
+			err = fmt.Errorf("unknown key %s", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pm, nil
+}
+
+// getPageMaster returns the page master for obj which is either the name of a
+// page master or a map with the page master settings.
+func (fd *frontendDocument) getPageMaster(obj object.Object) (*pageMaster, error) {
+	switch t := obj.(type) {
+	case *object.String:
+		pm, ok := fd.pageMasters[t.Value()]
+		if !ok {
+			return nil, fmt.Errorf("page master %q not defined", t.Value())
+		}
+		return pm, nil
+	case *object.Map:
+		return fd.parsePageMaster(t)
+	}
+	return nil, fmt.Errorf("expected a string or a map, got %s", obj.Type())
+}
+
+// definePageMaster implements f.define_page_master(name, {width, height,
+// margins, areas, header, footer}).
+func (fd *frontendDocument) definePageMaster(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgsError("frontend.define_page_master", 2, len(args))
+	}
+	name, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	m, errObj := object.AsMap(args[1])
+	if errObj != nil {
+		return errObj
+	}
+	pm, err := fd.parsePageMaster(m)
+	if err != nil {
+		return object.ArgsErrorf("frontend.define_page_master(): %s", err)
+	}
+	pm.name = name
+	if fd.pageMasters == nil {
+		fd.pageMasters = make(map[string]*pageMaster)
+	}
+	fd.pageMasters[name] = pm
+	return object.Nil
+}
+
+// newMasterPage creates a page with the geometry of the page master. Pages
+// with a header or a footer are remembered for shipout at the end.
+func (fd *frontendDocument) newMasterPage(pm *pageMaster) *document.Page {
+	page := fd.value.Doc.NewPage()
+	page.Width = pm.width
+	page.Height = pm.height
+	if pm.header != nil || pm.footer != nil {
+		fd.pendingPages = append(fd.pendingPages, &pendingPage{page: page, master: pm})
+	}
+	return page
+}
+
+// newPage implements f.new_page([master]).
+func (fd *frontendDocument) newPage(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return object.NewArgsRangeError("frontend.new_page", 0, 1, len(args))
+	}
+	pm := fd.defaultPageMaster()
+	if len(args) == 1 {
+		var err error
+		if pm, err = fd.getPageMaster(args[0]); err != nil {
+			return object.ArgsErrorf("frontend.new_page(): %s", err)
+		}
+	}
+	return &rdocument.Page{Value: fd.newMasterPage(pm)}
+}
+
+// decoratePage calls fn with the page and the page info and places the
+// returned vlist (if any) vertically centered in the area.
+func decoratePage(ctx context.Context, fn object.Callable, pp *pendingPage, number, total int, area *pageArea) error {
+	pm := pp.master
+	info := object.NewMap(map[string]object.Object{
+		"number": object.NewInt(int64(number)),
+		"total":  object.NewInt(int64(total)),
+		"master": object.NewString(pm.name),
+		"width":  &rbag.RSP{Value: area.width},
+		"height": &rbag.RSP{Value: area.height},
+	})
+	ret := fn.Call(ctx, &rdocument.Page{Value: pp.page}, info)
+	switch t := ret.(type) {
+	case *object.Error:
+		return t.Value()
+	case *rnode.Node:
+		vl, ok := t.Value.(*node.VList)
+		if !ok {
+			vl = node.Vpack(t.Value)
+		}
+		y := area.y + (area.height-vl.Height-vl.Depth)/2
+		pp.page.OutputAt(area.x, pp.page.Height-y, vl)
+	}
+	return nil
+}
+
+// shipoutPendingPages adds the headers and footers to the pages that have
+// not been shipped out and ships them out. It is called when the document is
+// finished, so "page x of y" can be typeset.
+func (fd *frontendDocument) shipoutPendingPages(ctx context.Context) error {
+	total := len(fd.value.Doc.Pages)
+	numbers := make(map[*document.Page]int, total)
+	for i, p := range fd.value.Doc.Pages {
+		numbers[p] = i + 1
+	}
+	for _, pp := range fd.pendingPages {
+		pm := pp.master
+		if pm.header != nil {
+			area, ok := pm.areas["header"]
+			if !ok {
+				area = &pageArea{x: pm.marginLeft, y: 0, width: pm.width - pm.marginLeft - pm.marginRight, height: pm.marginTop}
+			}
+			if err := decoratePage(ctx, pm.header, pp, numbers[pp.page], total, area); err != nil {
+				return err
+			}
+		}
+		if pm.footer != nil {
+			area, ok := pm.areas["footer"]
+			if !ok {
+				area = &pageArea{x: pm.marginLeft, y: pm.height - pm.marginBottom, width: pm.width - pm.marginLeft - pm.marginRight, height: pm.marginBottom}
+			}
+			if err := decoratePage(ctx, pm.footer, pp, numbers[pp.page], total, area); err != nil {
+				return err
+			}
+		}
+		pp.page.Shipout()
+	}
+	fd.pendingPages = nil
+	return nil
+}
+
+// beforeFinish ships out the pending pages and writes the aux file. The run
+// of the document is told if the marks have changed.
+func (fd *frontendDocument) beforeFinish(ctx context.Context) error {
+	if err := fd.shipoutPendingPages(ctx); err != nil {
+		return err
+	}
+	changed, err := fd.writeAux()
+	if err != nil {
+		return err
+	}
+	if changed {
+		fd.run.needsRerun = true
+	}
+	return nil
+}
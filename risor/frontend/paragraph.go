@@ -0,0 +1,330 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	rpdfdraw "github.com/boxesandglue/cli/risor/frontend/pdfdraw"
+	"github.com/risor-io/risor/object"
+	"github.com/risor-io/risor/op"
+)
+
+// FrontendParagraphInfoType is the type name of the paragraph metrics object.
+const FrontendParagraphInfoType = "frontend.paragraphinfo"
+
+// paragraphInfo holds the metrics of a formatted paragraph.
+type paragraphInfo struct {
+	vlist *node.VList
+	lines []lineInfo
+}
+
+// lineInfo holds the metrics of a single line of a paragraph. The demerits
+// are the demerits of the break at the end of the line as calculated by the
+// line breaker.
+type lineInfo struct {
+	hlist    *node.HList
+	natural  bag.ScaledPoint
+	badness  int
+	ratio    float64
+	demerits int
+}
+
+// paragraphOptions holds the parsed options of a format_paragraph call.
+type paragraphOptions struct {
+	text  *frontend.Text
+	width bag.ScaledPoint
+	opts  []frontend.TypesettingOption
+	// shape returns the indentation and the width of each line, nil for a
+	// rectangular paragraph of the given width.
+	shape lineShape
+	// background is drawn behind the paragraph
+	background *rpdfdraw.Drawing
+}
+
+// parshapeLine is the indentation and the width of one line of a paragraph.
+type parshapeLine struct {
+	indent bag.ScaledPoint
+	width  bag.ScaledPoint
+}
+
+// parseParagraphOptions reads the options map of format_paragraph and
+// format_paragraph_info. fn is the name of the calling function and is used
+// in error messages. A parshape callback is called with ctx while the
+// paragraph is formatted.
+func parseParagraphOptions(ctx context.Context, fn string, args []object.Object) (*paragraphOptions, *object.Error) {
+	if len(args) != 1 {
+		return nil, object.ArgsErrorf("%s() takes exactly one argument", fn)
+	}
+	firstArg := args[0]
+	if firstArg.Type() != object.MAP {
+		return nil, object.ArgsErrorf("%s() expects a map argument (formatting options)", fn)
+	}
+	po := &paragraphOptions{}
+	hasWidth := false
+	for k, v := range firstArg.(*object.Map).Value() {
+		switch k {
+		case "width":
+			if v.Type() == "bag.scaledpoint" {
+				po.width = v.(*rbag.RSP).Value
+				hasWidth = true
+			} else {
+				return nil, object.ArgsErrorf("%s() expects a bag.scaledpoint argument (width)", fn)
+			}
+		case "text":
+			if v.Type() == "frontend.text" {
+				po.text = v.(*text).Value
+			} else {
+				return nil, object.ArgsErrorf("%s() expects a frontend.text argument (text)", fn)
+			}
+		case "leading":
+			if v.Type() == "bag.scaledpoint" {
+				po.opts = append(po.opts, frontend.Leading(v.(*rbag.RSP).Value))
+			} else {
+				return nil, object.ArgsErrorf("%s() expects a bag.scaledpoint argument (leading)", fn)
+			}
+		case "font_size":
+			if v.Type() == "bag.scaledpoint" {
+				po.opts = append(po.opts, frontend.FontSize(v.(*rbag.RSP).Value))
+			} else {
+				return nil, object.ArgsErrorf("%s() expects a bag.scaledpoint argument (font_size)", fn)
+			}
+		case "family":
+			if v.Type() == "frontend.fontfamily" {
+				ff := v.(*FontFamily)
+				po.opts = append(po.opts, frontend.Family(ff.Value))
+			} else {
+				return nil, object.ArgsErrorf("%s() expects a frontend.fontfamily argument (font family)", fn)
+			}
+		case "parshape":
+			if cb, ok := v.(object.Callable); ok {
+				po.shape = callbackShape(ctx, fn, cb)
+				break
+			}
+			ps, errObj := parseParshape(fn, v)
+			if errObj != nil {
+				return nil, errObj
+			}
+			po.shape = listShape(ps)
+		case "background":
+			d, ok := v.(*rpdfdraw.Drawing)
+			if !ok {
+				return nil, object.ArgsErrorf("%s() expects a draw.drawing argument (background)", fn)
+			}
+			po.background = d
+		default:
+			return nil, object.ArgsErrorf("%s(): unknown option %s", fn, k)
+		}
+	}
+	if po.text == nil {
+		return nil, object.ArgsErrorf("%s() expects a text in the options map", fn)
+	}
+	if hasWidth && po.shape != nil {
+		return nil, object.ArgsErrorf("%s() expects either a width or a parshape, not both", fn)
+	}
+	return po, nil
+}
+
+// parseParshape reads a list of [indent, width] pairs. Each pair describes one
+// line, the last pair is used for all remaining lines.
+func parseParshape(fn string, v object.Object) ([]parshapeLine, *object.Error) {
+	lst, ok := v.(*object.List)
+	if !ok || len(lst.Value()) == 0 {
+		return nil, object.ArgsErrorf("%s() expects a non-empty list of [indent, width] pairs or a function (parshape)", fn)
+	}
+	var ps []parshapeLine
+	for _, itm := range lst.Value() {
+		psl, errObj := parseParshapeLine(fn, itm)
+		if errObj != nil {
+			return nil, errObj
+		}
+		ps = append(ps, psl)
+	}
+	return ps, nil
+}
+
+// parseParshapeLine reads an [indent, width] pair.
+func parseParshapeLine(fn string, v object.Object) (parshapeLine, *object.Error) {
+	pair, ok := v.(*object.List)
+	if !ok || len(pair.Value()) != 2 {
+		return parshapeLine{}, object.ArgsErrorf("%s() expects [indent, width] pairs (parshape)", fn)
+	}
+	indent, ok := pair.Value()[0].(*rbag.RSP)
+	if !ok {
+		return parshapeLine{}, object.ArgsErrorf("%s() expects a bag.scaledpoint as the indent (parshape)", fn)
+	}
+	wd, ok := pair.Value()[1].(*rbag.RSP)
+	if !ok {
+		return parshapeLine{}, object.ArgsErrorf("%s() expects a bag.scaledpoint as the width (parshape)", fn)
+	}
+	return parshapeLine{indent: indent.Value, width: wd.Value}, nil
+}
+
+// callbackShape returns a line shape that calls cb with the line number
+// (starting at 1). The function returns an [indent, width] pair. The line
+// breaker asks for a line more than once, so the results are cached.
+func callbackShape(ctx context.Context, fn string, cb object.Callable) lineShape {
+	cache := map[int]parshapeLine{}
+	return func(line int) (parshapeLine, error) {
+		if psl, ok := cache[line]; ok {
+			return psl, nil
+		}
+		ret := cb.Call(ctx, object.NewInt(int64(line)))
+		if errObj, ok := ret.(*object.Error); ok {
+			return parshapeLine{}, errObj.Value()
+		}
+		psl, errObj := parseParshapeLine(fn, ret)
+		if errObj != nil {
+			return parshapeLine{}, errObj.Value()
+		}
+		cache[line] = psl
+		return psl, nil
+	}
+}
+
+// formatParagraph formats the paragraph described by po. Each line of the
+// paragraph can have its own indentation and width. A background drawing is
+// scaled to the size of the paragraph.
+func formatParagraph(fe *frontend.Document, po *paragraphOptions) (*paragraphInfo, error) {
+	shape := po.shape
+	if shape == nil {
+		shape = rectangleShape(po.width)
+	}
+	info, err := breakParagraph(fe, po.text, shape, po.opts)
+	if err != nil || po.background == nil {
+		return info, err
+	}
+	vl := info.vlist
+	bg, err := po.background.Background(vl.Width, vl.Height+vl.Depth)
+	if err != nil {
+		return nil, fmt.Errorf("background: %w", err)
+	}
+	vl.List = node.InsertBefore(vl.List, vl.List, bg)
+	return info, nil
+}
+
+// demerits returns the sum of the demerits of all lines.
+func (pi *paragraphInfo) demerits() int {
+	sum := 0
+	for _, li := range pi.lines {
+		sum += li.demerits
+	}
+	return sum
+}
+
+// newLineInfo reconstructs the natural width and the badness of a packed
+// line. Lines that are filled with infinite glue (such as the last line of a
+// paragraph) have no badness.
+func newLineInfo(hl *node.HList) lineInfo {
+	li := lineInfo{hlist: hl, badness: hl.Badness, ratio: hl.GlueSet}
+	var stretch, shrink [4]bag.ScaledPoint
+	for e := hl.List; e != nil; e = e.Next() {
+		if g, ok := e.(*node.Glue); ok {
+			stretch[g.StretchOrder] += g.Stretch
+			shrink[g.ShrinkOrder] += g.Shrink
+		}
+	}
+	totals := stretch
+	if hl.GlueSet < 0 {
+		totals = shrink
+	}
+	order := 0
+	for i := 3; i > 0; i-- {
+		if totals[i] != 0 {
+			order = i
+			break
+		}
+	}
+	li.natural = hl.Width - bag.ScaledPoint(hl.GlueSet*float64(totals[order]))
+	if order > 0 {
+		li.badness = 0
+		li.ratio = 0
+	}
+	return li
+}
+
+// Type of the object.
+func (pi *paragraphInfo) Type() object.Type {
+	return FrontendParagraphInfoType
+}
+
+// Inspect returns a string representation of the given object.
+func (pi *paragraphInfo) Inspect() string {
+	return "paragraphinfo"
+}
+
+// Interface converts the given object to a native Go value.
+func (pi *paragraphInfo) Interface() interface{} {
+	return pi.vlist
+}
+
+// Equals returns True if the given object is equal to this object.
+func (pi *paragraphInfo) Equals(other object.Object) object.Object {
+	return object.NewBool(pi == other)
+}
+
+// GetAttr returns the attribute with the given name from this object.
+func (pi *paragraphInfo) GetAttr(name string) (object.Object, bool) {
+	switch name {
+	case "vlist":
+		return &rnode.Node{Value: pi.vlist}, true
+	case "lines":
+		return object.NewInt(int64(len(pi.lines))), true
+	case "height":
+		return &rbag.RSP{Value: pi.vlist.Height}, true
+	case "depth":
+		return &rbag.RSP{Value: pi.vlist.Depth}, true
+	case "widths":
+		lst := object.NewList(nil)
+		for _, li := range pi.lines {
+			lst.Append(&rbag.RSP{Value: li.natural})
+		}
+		return lst, true
+	case "badness":
+		lst := object.NewList(nil)
+		for _, li := range pi.lines {
+			lst.Append(object.NewInt(int64(li.badness)))
+		}
+		return lst, true
+	case "max_badness":
+		maxBadness := 0
+		for _, li := range pi.lines {
+			maxBadness = max(maxBadness, li.badness)
+		}
+		return object.NewInt(int64(maxBadness)), true
+	case "glue_ratios":
+		lst := object.NewList(nil)
+		for _, li := range pi.lines {
+			lst.Append(object.NewFloat(li.ratio))
+		}
+		return lst, true
+	case "demerits":
+		return object.NewInt(int64(pi.demerits())), true
+	}
+	return nil, false
+}
+
+// SetAttr sets the attribute with the given name on this object.
+func (pi *paragraphInfo) SetAttr(name string, value object.Object) error {
+	return object.Errorf("cannot set attribute %s on paragraphinfo", name)
+}
+
+// IsTruthy returns true if the object is considered "truthy".
+func (pi *paragraphInfo) IsTruthy() bool {
+	return true
+}
+
+// RunOperation runs an operation on this object with the given
+// right-hand side object.
+func (pi *paragraphInfo) RunOperation(opType op.BinaryOpType, right object.Object) object.Object {
+	return object.Errorf("operation %s not supported on paragraphinfo", opType)
+}
+
+// Cost returns the incremental processing cost of this object.
+func (pi *paragraphInfo) Cost() int {
+	return 0
+}
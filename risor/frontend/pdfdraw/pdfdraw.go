@@ -0,0 +1,646 @@
+package pdfdraw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+	"github.com/risor-io/risor/op"
+)
+
+// DrawingType is the type of the object.
+const DrawingType = "draw.drawing"
+
+// Drawing collects PDF drawing instructions. The origin is the lower left
+// corner of the drawing and the y axis points upwards. Coordinates and lengths
+// are scaled points, strings with a unit or numbers (in PDF points).
+type Drawing struct {
+	Value *pdfdraw.Object
+	// the extent of the points used in the drawing
+	maxX, maxY bag.ScaledPoint
+	// a path is started and the current point is set
+	inPath bool
+	// the position of the current path in the PDF code
+	pathStart int
+	// ExtGState and Shading resources, see write
+	extGStates []string
+	shadings   []string
+	// the drawing uses a spot color
+	spot bool
+}
+
+func newDrawing(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return object.NewArgsError("draw.new", 0, len(args))
+	}
+	return &Drawing{Value: pdfdraw.New()}
+}
+
+// toSP converts a length argument.
+func toSP(obj object.Object) (bag.ScaledPoint, error) {
+	switch t := obj.(type) {
+	case *rbag.RSP:
+		return t.Value, nil
+	case *object.String:
+		return bag.SP(t.Value())
+	case *object.Int:
+		return bag.ScaledPointFromFloat(float64(t.Value())), nil
+	case *object.Float:
+		return bag.ScaledPointFromFloat(t.Value()), nil
+	}
+	return 0, fmt.Errorf("expected a bag.scaledpoint, a string with a unit or a number, got %s", obj.Type())
+}
+
+// toFloat converts a number argument.
+func toFloat(obj object.Object) (float64, error) {
+	switch t := obj.(type) {
+	case *object.Int:
+		return float64(t.Value()), nil
+	case *object.Float:
+		return t.Value(), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %s", obj.Type())
+}
+
+// lengths converts the arguments of the method name to scaled points.
+func lengths(name string, n int, args []object.Object) ([]bag.ScaledPoint, *object.Error) {
+	if len(args) != n {
+		return nil, object.NewArgsError("draw."+name, n, len(args))
+	}
+	ret := make([]bag.ScaledPoint, n)
+	for i, arg := range args {
+		sp, err := toSP(arg)
+		if err != nil {
+			return nil, object.ArgsErrorf("draw.%s(): argument %d: %s", name, i+1, err)
+		}
+		ret[i] = sp
+	}
+	return ret, nil
+}
+
+// floats converts the arguments of the method name to numbers.
+func floats(name string, n int, args []object.Object) ([]float64, *object.Error) {
+	if len(args) != n {
+		return nil, object.NewArgsError("draw."+name, n, len(args))
+	}
+	ret := make([]float64, n)
+	for i, arg := range args {
+		f, err := toFloat(arg)
+		if err != nil {
+			return nil, object.ArgsErrorf("draw.%s(): argument %d: %s", name, i+1, err)
+		}
+		ret[i] = f
+	}
+	return ret, nil
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100000)/100000, 'f', -1, 64)
+}
+
+// beginPath records the start of a path in the PDF code if no path is started.
+func (d *Drawing) beginPath() {
+	if !d.inPath {
+		d.pathStart = len(d.Value.String())
+		d.inPath = true
+	}
+}
+
+// point records the point for the extent of the drawing.
+func (d *Drawing) point(x, y bag.ScaledPoint) {
+	d.maxX = max(d.maxX, x)
+	d.maxY = max(d.maxY, y)
+}
+
+func (d *Drawing) moveTo(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("move_to", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.beginPath()
+	d.point(l[0], l[1])
+	d.Value.Moveto(l[0], l[1])
+	return d
+}
+
+func (d *Drawing) lineTo(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("line_to", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	if !d.inPath {
+		return object.Errorf("draw.line_to(): no current point, use move_to first")
+	}
+	d.point(l[0], l[1])
+	d.Value.Lineto(l[0], l[1])
+	return d
+}
+
+func (d *Drawing) curveTo(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("curve_to", 6, args)
+	if errObj != nil {
+		return errObj
+	}
+	if !d.inPath {
+		return object.Errorf("draw.curve_to(): no current point, use move_to first")
+	}
+	for i := 0; i < 6; i += 2 {
+		d.point(l[i], l[i+1])
+	}
+	d.Value.Curveto(l[0], l[1], l[2], l[3], l[4], l[5])
+	return d
+}
+
+func (d *Drawing) closePath(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return object.NewArgsError("draw.close", 0, len(args))
+	}
+	d.Value.Close()
+	return d
+}
+
+func (d *Drawing) rect(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("rect", 4, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.beginPath()
+	d.point(l[0], l[1])
+	d.point(l[0]+l[2], l[1]+l[3])
+	d.Value.Rect(l[0], l[1], l[2], l[3])
+	return d
+}
+
+func (d *Drawing) circle(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("circle", 3, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.beginPath()
+	d.point(l[0]+l[2], l[1]+l[2])
+	d.Value.Circle(l[0], l[1], l[2], l[2])
+	return d
+}
+
+func (d *Drawing) ellipse(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("ellipse", 4, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.beginPath()
+	d.point(l[0]+l[2], l[1]+l[3])
+	d.Value.Circle(l[0], l[1], l[2], l[3])
+	return d
+}
+
+// arc implements d.arc(x, y, radius, start, end). The arc around the center
+// (x, y) runs counterclockwise from the start angle to the end angle (in
+// degrees, 0 is to the right). A line is drawn from the current point to the
+// start of the arc, without a current point the path starts there.
+func (d *Drawing) arc(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 5 {
+		return object.NewArgsError("draw.arc", 5, len(args))
+	}
+	l, errObj := lengths("arc", 3, args[:3])
+	if errObj != nil {
+		return errObj
+	}
+	angles, errObj := floats("arc", 2, args[3:])
+	if errObj != nil {
+		return errObj
+	}
+	cx, cy, r := l[0].ToPT(), l[1].ToPT(), l[2].ToPT()
+	start, end := angles[0]*math.Pi/180, angles[1]*math.Pi/180
+	for end < start {
+		end += 2 * math.Pi
+	}
+	pt := func(x, y float64) (bag.ScaledPoint, bag.ScaledPoint) {
+		return bag.ScaledPointFromFloat(x), bag.ScaledPointFromFloat(y)
+	}
+	x0, y0 := pt(cx+r*math.Cos(start), cy+r*math.Sin(start))
+	if d.inPath {
+		d.Value.Lineto(x0, y0)
+	} else {
+		d.beginPath()
+		d.Value.Moveto(x0, y0)
+	}
+	d.point(x0, y0)
+	// bezier segments of at most 90 degrees
+	segments := max(1, int(math.Ceil((end-start)/(math.Pi/2)-1e-9)))
+	step := (end - start) / float64(segments)
+	k := 4.0 / 3.0 * math.Tan(step/4)
+	for i := range segments {
+		a0 := start + float64(i)*step
+		a1 := a0 + step
+		c1x, c1y := pt(cx+r*(math.Cos(a0)-k*math.Sin(a0)), cy+r*(math.Sin(a0)+k*math.Cos(a0)))
+		c2x, c2y := pt(cx+r*(math.Cos(a1)+k*math.Sin(a1)), cy+r*(math.Sin(a1)-k*math.Cos(a1)))
+		x1, y1 := pt(cx+r*math.Cos(a1), cy+r*math.Sin(a1))
+		d.point(c1x, c1y)
+		d.point(c2x, c2y)
+		d.point(x1, y1)
+		d.Value.Curveto(c1x, c1y, c2x, c2y, x1, y1)
+	}
+	return d
+}
+
+// paint returns a method that ends the path with the operator. If the method
+// has an even-odd variant, the optional argument true selects the even-odd
+// rule.
+func (d *Drawing) paint(name, operator, evenOddOperator string) object.Object {
+	return object.NewBuiltin("draw."+name, func(ctx context.Context, args ...object.Object) object.Object {
+		maxArgs := 0
+		if evenOddOperator != "" {
+			maxArgs = 1
+		}
+		if len(args) > maxArgs {
+			return object.NewArgsRangeError("draw."+name, 0, maxArgs, len(args))
+		}
+		op := operator
+		if len(args) == 1 {
+			evenOdd, errObj := object.AsBool(args[0])
+			if errObj != nil {
+				return errObj
+			}
+			if evenOdd {
+				op = evenOddOperator
+			}
+		}
+		d.Value.Literal(op)
+		d.inPath = false
+		return d
+	})
+}
+
+func (d *Drawing) setColor(name string, stroking, nonstroking bool) object.Object {
+	return object.NewBuiltin("draw."+name, func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return object.NewArgsError("draw."+name, 1, len(args))
+		}
+		col, ok := args[0].(*rcolor.RColor)
+		if !ok || col.Value == nil {
+			return object.ArgsErrorf("draw.%s() expects a backend.color argument (see frontend get_color and define_color)", name)
+		}
+		if col.Value.Space == color.ColorSpotcolor {
+			d.spot = true
+		}
+		if stroking {
+			d.Value.ColorStroking(*col.Value)
+		}
+		if nonstroking {
+			d.Value.ColorNonstroking(*col.Value)
+		}
+		return d
+	})
+}
+
+func (d *Drawing) lineWidth(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("line_width", 1, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.Value.LineWidth(l[0])
+	return d
+}
+
+// dash implements d.dash(pattern[, phase]). The pattern is a list of lengths
+// of dashes and gaps, an empty list draws solid lines.
+func (d *Drawing) dash(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("draw.dash", 1, 2, len(args))
+	}
+	lst, errObj := object.AsList(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	var pattern []string
+	for _, item := range lst.Value() {
+		sp, err := toSP(item)
+		if err != nil {
+			return object.ArgsErrorf("draw.dash(): %s", err)
+		}
+		pattern = append(pattern, sp.String())
+	}
+	var phase bag.ScaledPoint
+	if len(args) == 2 {
+		var err error
+		if phase, err = toSP(args[1]); err != nil {
+			return object.ArgsErrorf("draw.dash(): phase: %s", err)
+		}
+	}
+	d.Value.Literal(fmt.Sprintf("[%s] %s d", strings.Join(pattern, " "), phase))
+	return d
+}
+
+// setStyle returns a method that sets a line style by name.
+func (d *Drawing) setStyle(name, operator string, values []string) object.Object {
+	return object.NewBuiltin("draw."+name, func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return object.NewArgsError("draw."+name, 1, len(args))
+		}
+		s, errObj := object.AsString(args[0])
+		if errObj != nil {
+			return errObj
+		}
+		for i, v := range values {
+			if v == s {
+				d.Value.Literal(fmt.Sprintf("%d %s", i, operator))
+				return d
+			}
+		}
+		return object.ArgsErrorf("draw.%s(): unknown value %q, expected one of %s", name, s, strings.Join(values, ", "))
+	})
+}
+
+func (d *Drawing) miterLimit(ctx context.Context, args ...object.Object) object.Object {
+	f, errObj := floats("miter_limit", 1, args)
+	if errObj != nil {
+		return errObj
+	}
+	if f[0] < 1 {
+		return object.ArgsErrorf("draw.miter_limit(): the limit must be at least 1")
+	}
+	d.Value.Literal(num(f[0]) + " M")
+	return d
+}
+
+// cm appends a transformation matrix.
+func (d *Drawing) cm(a, b, c, dd, e, f float64) {
+	d.Value.Literal(fmt.Sprintf("%s %s %s %s %s %s cm", num(a), num(b), num(c), num(dd), num(e), num(f)))
+}
+
+func (d *Drawing) translate(ctx context.Context, args ...object.Object) object.Object {
+	l, errObj := lengths("translate", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.cm(1, 0, 0, 1, l[0].ToPT(), l[1].ToPT())
+	return d
+}
+
+// rotate implements d.rotate(angle) counterclockwise in degrees around the
+// origin.
+func (d *Drawing) rotate(ctx context.Context, args ...object.Object) object.Object {
+	f, errObj := floats("rotate", 1, args)
+	if errObj != nil {
+		return errObj
+	}
+	a := f[0] * math.Pi / 180
+	d.cm(math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0)
+	return d
+}
+
+// scale implements d.scale(sx[, sy]).
+func (d *Drawing) scale(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) == 1 {
+		args = append(args, args[0])
+	}
+	f, errObj := floats("scale", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.cm(f[0], 0, 0, f[1], 0, 0)
+	return d
+}
+
+// skew implements d.skew(ax, ay) with the angles in degrees.
+func (d *Drawing) skew(ctx context.Context, args ...object.Object) object.Object {
+	f, errObj := floats("skew", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.cm(1, math.Tan(f[1]*math.Pi/180), math.Tan(f[0]*math.Pi/180), 1, 0, 0)
+	return d
+}
+
+// transform implements d.transform(a, b, c, d, e, f) with e and f in PDF
+// points.
+func (d *Drawing) transform(ctx context.Context, args ...object.Object) object.Object {
+	f, errObj := floats("transform", 6, args)
+	if errObj != nil {
+		return errObj
+	}
+	d.cm(f[0], f[1], f[2], f[3], f[4], f[5])
+	return d
+}
+
+func (d *Drawing) simple(name string, fn func() *pdfdraw.Object) object.Object {
+	return object.NewBuiltin("draw."+name, func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return object.NewArgsError("draw."+name, 0, len(args))
+		}
+		fn()
+		return d
+	})
+}
+
+// ImageAttribute is the attribute of an invisible rule that stands for a
+// drawing with transparency or gradients. The value is an *Image. The
+// frontend replaces the rule by an image node before the page is shipped
+// out.
+const ImageAttribute = "drawing image"
+
+// Image is a drawing written to a PDF file. It is placed with the given size
+// at the top left corner of the vlist that contains the rule.
+type Image struct {
+	Filename      string
+	Width, Height bag.ScaledPoint
+}
+
+// toNode implements d.node([width, height]). The drawing is put into a vlist
+// of the given size, the default size is the extent of the points used
+// (without the transformations). Parts of the drawing may lie outside of the
+// box. Drawings with transparency or gradients are written to a PDF file of
+// the size of the box and placed as an image, so they are clipped to the box.
+func (d *Drawing) toNode(ctx context.Context, args ...object.Object) object.Object {
+	wd, ht := d.maxX, d.maxY
+	switch len(args) {
+	case 0:
+	case 2:
+		l, errObj := lengths("node", 2, args)
+		if errObj != nil {
+			return errObj
+		}
+		wd, ht = l[0], l[1]
+	default:
+		return object.ArgsErrorf("draw.node() takes no arguments or two arguments (width and height)")
+	}
+	r := node.NewRule()
+	r.Width = wd
+	r.Height = ht
+	r.Hide = true
+	r.Attributes = node.H{"origin": "drawing"}
+	if d.needsResources() {
+		filename, err := d.cachedPDF(wd, ht)
+		if err != nil {
+			return object.Errorf("draw.node(): %s", err)
+		}
+		r.Attributes[ImageAttribute] = &Image{Filename: filename, Width: wd, Height: ht}
+	} else {
+		// The rule starts at the top left corner of the box.
+		r.Pre = fmt.Sprintf("q 1 0 0 1 0 %s cm %s Q", -ht, d.Value.String())
+	}
+	vl := node.Vpack(r)
+	vl.Attributes = node.H{"origin": "drawing"}
+	return &rnode.Node{Value: vl}
+}
+
+// Background returns an invisible rule without a size that draws the drawing
+// scaled from the extent of its points to the width and the height. The
+// drawing starts at the position of the rule and extends to the right and
+// downwards, so the rule is put at the top of a vlist.
+func (d *Drawing) Background(wd, ht bag.ScaledPoint) (*node.Rule, error) {
+	if d.maxX <= 0 || d.maxY <= 0 {
+		return nil, fmt.Errorf("the drawing has no size")
+	}
+	r := node.NewRule()
+	r.Hide = true
+	r.Attributes = node.H{"origin": "drawing background"}
+	if d.needsResources() {
+		filename, err := d.cachedPDF(d.maxX, d.maxY)
+		if err != nil {
+			return nil, err
+		}
+		r.Attributes[ImageAttribute] = &Image{Filename: filename, Width: wd, Height: ht}
+		return r, nil
+	}
+	sx := float64(wd) / float64(d.maxX)
+	sy := float64(ht) / float64(d.maxY)
+	r.Pre = fmt.Sprintf("q %s 0 0 %s 0 %s cm %s Q", num(sx), num(sy), -ht, d.Value.String())
+	return r, nil
+}
+
+// Type of the object.
+func (d *Drawing) Type() object.Type {
+	return DrawingType
+}
+
+// Inspect returns a string representation of the given object.
+func (d *Drawing) Inspect() string {
+	return d.Value.String()
+}
+
+// Interface converts the given object to a native Go value.
+func (d *Drawing) Interface() any {
+	return d.Value
+}
+
+// Equals returns True if the given object is equal to this object.
+func (d *Drawing) Equals(other object.Object) object.Object {
+	return object.NewBool(d == other)
+}
+
+// GetAttr returns the attribute with the given name from this object.
+func (d *Drawing) GetAttr(name string) (object.Object, bool) {
+	switch name {
+	case "arc":
+		return object.NewBuiltin("draw.arc", d.arc), true
+	case "blend_mode":
+		return object.NewBuiltin("draw.blend_mode", d.blendMode), true
+	case "circle":
+		return object.NewBuiltin("draw.circle", d.circle), true
+	case "clip":
+		return d.paint("clip", "W n", "W* n"), true
+	case "close":
+		return object.NewBuiltin("draw.close", d.closePath), true
+	case "color":
+		return d.setColor("color", true, true), true
+	case "curve_to":
+		return object.NewBuiltin("draw.curve_to", d.curveTo), true
+	case "dash":
+		return object.NewBuiltin("draw.dash", d.dash), true
+	case "ellipse":
+		return object.NewBuiltin("draw.ellipse", d.ellipse), true
+	case "end_path":
+		return d.paint("end_path", "n", ""), true
+	case "fill":
+		return d.paint("fill", "f", "f*"), true
+	case "fill_color":
+		return d.setColor("fill_color", false, true), true
+	case "fill_stroke":
+		return d.paint("fill_stroke", "B", "B*"), true
+	case "linear_gradient":
+		return object.NewBuiltin("draw.linear_gradient", d.linearGradient), true
+	case "line_cap":
+		return d.setStyle("line_cap", "J", []string{"butt", "round", "square"}), true
+	case "line_join":
+		return d.setStyle("line_join", "j", []string{"miter", "round", "bevel"}), true
+	case "line_to":
+		return object.NewBuiltin("draw.line_to", d.lineTo), true
+	case "line_width":
+		return object.NewBuiltin("draw.line_width", d.lineWidth), true
+	case "miter_limit":
+		return object.NewBuiltin("draw.miter_limit", d.miterLimit), true
+	case "move_to":
+		return object.NewBuiltin("draw.move_to", d.moveTo), true
+	case "node":
+		return object.NewBuiltin("draw.node", d.toNode), true
+	case "opacity":
+		return object.NewBuiltin("draw.opacity", d.opacity), true
+	case "pdf":
+		return object.NewString(d.Value.String()), true
+	case "radial_gradient":
+		return object.NewBuiltin("draw.radial_gradient", d.radialGradient), true
+	case "rect":
+		return object.NewBuiltin("draw.rect", d.rect), true
+	case "restore":
+		return d.simple("restore", d.Value.Restore), true
+	case "rotate":
+		return object.NewBuiltin("draw.rotate", d.rotate), true
+	case "save":
+		return d.simple("save", d.Value.Save), true
+	case "scale":
+		return object.NewBuiltin("draw.scale", d.scale), true
+	case "skew":
+		return object.NewBuiltin("draw.skew", d.skew), true
+	case "stroke":
+		return d.paint("stroke", "S", ""), true
+	case "stroke_color":
+		return d.setColor("stroke_color", true, false), true
+	case "transform":
+		return object.NewBuiltin("draw.transform", d.transform), true
+	case "translate":
+		return object.NewBuiltin("draw.translate", d.translate), true
+	case "write":
+		return object.NewBuiltin("draw.write", d.write), true
+	}
+	return nil, false
+}
+
+// SetAttr sets the attribute with the given name on this object.
+func (d *Drawing) SetAttr(name string, value object.Object) error {
+	return object.Errorf("cannot set attribute %s on draw.drawing", name)
+}
+
+// IsTruthy returns true if the object is considered "truthy".
+func (d *Drawing) IsTruthy() bool {
+	return true
+}
+
+// RunOperation runs an operation on this object with the given
+// right-hand side object.
+func (d *Drawing) RunOperation(opType op.BinaryOpType, right object.Object) object.Object {
+	return object.Errorf("operation %s not supported on draw.drawing", opType)
+}
+
+// Cost returns the incremental processing cost of this object.
+func (d *Drawing) Cost() int {
+	return 0
+}
+
+// Module returns the draw module.
+func Module() *object.Module {
+	return object.NewBuiltinsModule("draw", map[string]object.Object{
+		"new":       object.NewBuiltin("draw.new", newDrawing),
+		"transform": object.NewBuiltin("draw.transform", transform),
+	})
+}
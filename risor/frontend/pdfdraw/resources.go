@@ -0,0 +1,313 @@
+package pdfdraw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	"github.com/boxesandglue/cli/risor/pdfpage"
+	"github.com/risor-io/risor/object"
+)
+
+// Transparency and gradients need ExtGState and Shading resources. The page
+// resources of the PDF writer only have fonts, images and color spaces, so
+// these drawings are written to a separate PDF file with its own resources
+// (see package pdfpage). The file can be loaded as an image and placed like any other image. node
+// and Background write the file to the user's cache directory and the
+// frontend places it as an image, see ImageAttribute.
+
+// blendModes maps the names of the blend modes to the PDF names.
+var blendModes = []struct{ name, pdfName string }{
+	{"normal", "Normal"},
+	{"multiply", "Multiply"},
+	{"screen", "Screen"},
+	{"overlay", "Overlay"},
+	{"darken", "Darken"},
+	{"lighten", "Lighten"},
+	{"color_dodge", "ColorDodge"},
+	{"color_burn", "ColorBurn"},
+	{"hard_light", "HardLight"},
+	{"soft_light", "SoftLight"},
+	{"difference", "Difference"},
+	{"exclusion", "Exclusion"},
+	{"hue", "Hue"},
+	{"saturation", "Saturation"},
+	{"color", "Color"},
+	{"luminosity", "Luminosity"},
+}
+
+// setExtGState adds the graphics state dictionary (if not already present) and
+// selects it.
+func (d *Drawing) setExtGState(dict string) {
+	idx := -1
+	for i, gs := range d.extGStates {
+		if gs == dict {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		d.extGStates = append(d.extGStates, dict)
+		idx = len(d.extGStates) - 1
+	}
+	d.Value.Literal(fmt.Sprintf("/GS%d gs", idx+1))
+}
+
+// opacity implements d.opacity(fill[, stroke]). The values are between 0
+// (transparent) and 1 (opaque), the stroke opacity defaults to the fill
+// opacity.
+func (d *Drawing) opacity(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) == 1 {
+		args = append(args, args[0])
+	}
+	f, errObj := floats("opacity", 2, args)
+	if errObj != nil {
+		return errObj
+	}
+	for _, v := range f {
+		if v < 0 || v > 1 {
+			return object.ArgsErrorf("draw.opacity(): the opacity %s is not between 0 and 1", num(v))
+		}
+	}
+	d.setExtGState(fmt.Sprintf("<< /Type /ExtGState /ca %s /CA %s >>", num(f[0]), num(f[1])))
+	return d
+}
+
+// blendMode implements d.blend_mode(name) with the names from blendModes.
+func (d *Drawing) blendMode(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewArgsError("draw.blend_mode", 1, len(args))
+	}
+	s, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	names := make([]string, 0, len(blendModes))
+	for _, bm := range blendModes {
+		if bm.name == s {
+			d.setExtGState(fmt.Sprintf("<< /Type /ExtGState /BM /%s >>", bm.pdfName))
+			return d
+		}
+		names = append(names, bm.name)
+	}
+	return object.ArgsErrorf("draw.blend_mode(): unknown value %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// colorValues returns the PDF color space and the color values of col.
+func colorValues(col *color.Color) (string, []string, error) {
+	var values []float64
+	var space string
+	switch col.Space {
+	case color.ColorRGB:
+		space, values = "/DeviceRGB", []float64{col.R, col.G, col.B}
+	case color.ColorCMYK:
+		space, values = "/DeviceCMYK", []float64{col.C, col.M, col.Y, col.K}
+	case color.ColorGray:
+		space, values = "/DeviceGray", []float64{col.G}
+	default:
+		return "", nil, fmt.Errorf("gradients need rgb, cmyk or gray colors")
+	}
+	ret := make([]string, len(values))
+	for i, v := range values {
+		ret[i] = num(v)
+	}
+	return space, ret, nil
+}
+
+// gradientFunction returns the color space and the PDF function of the color
+// stops. The stops are a list of colors which are distributed evenly or a list
+// of [offset, color] pairs with the offsets between 0 and 1. All colors must be
+// in the same color space.
+func gradientFunction(obj object.Object) (string, string, error) {
+	lst, ok := obj.(*object.List)
+	if !ok {
+		return "", "", fmt.Errorf("expected a list of color stops, got %s", obj.Type())
+	}
+	items := lst.Value()
+	if len(items) < 2 {
+		return "", "", fmt.Errorf("a gradient needs at least two colors")
+	}
+	var space string
+	var stops []pdfpage.Stop
+	for i, item := range items {
+		offset := float64(i) / float64(len(items)-1)
+		if pair, ok := item.(*object.List); ok {
+			if pair.Len().Value() != 2 {
+				return "", "", fmt.Errorf("color stop %d: expected [offset, color]", i+1)
+			}
+			var err error
+			if offset, err = toFloat(pair.Value()[0]); err != nil {
+				return "", "", fmt.Errorf("color stop %d: %w", i+1, err)
+			}
+			item = pair.Value()[1]
+		}
+		if offset < 0 || offset > 1 {
+			return "", "", fmt.Errorf("color stop %d: the offset %s is not between 0 and 1", i+1, num(offset))
+		}
+		if len(stops) > 0 && offset < stops[len(stops)-1].Offset {
+			return "", "", fmt.Errorf("color stop %d: the offsets must be in increasing order", i+1)
+		}
+		col, ok := item.(*rcolor.RColor)
+		if !ok || col.Value == nil {
+			return "", "", fmt.Errorf("color stop %d: expected a backend.color, got %s", i+1, item.Type())
+		}
+		sp, values, err := colorValues(col.Value)
+		if err != nil {
+			return "", "", fmt.Errorf("color stop %d: %w", i+1, err)
+		}
+		if space != "" && sp != space {
+			return "", "", fmt.Errorf("color stop %d: all colors must be in the same color space", i+1)
+		}
+		space = sp
+		stops = append(stops, pdfpage.Stop{Offset: offset, Color: strings.Join(values, " ")})
+	}
+	return space, pdfpage.GradientFunction(stops), nil
+}
+
+// shade fills the current path with the shading. The path is the clipping path
+// for the shading only, the graphics state is saved and restored around it.
+func (d *Drawing) shade(name string, shadingType int, coords []float64, stops object.Object) object.Object {
+	if !d.inPath {
+		return object.Errorf("draw.%s(): no path to fill", name)
+	}
+	space, function, err := gradientFunction(stops)
+	if err != nil {
+		return object.ArgsErrorf("draw.%s(): %s", name, err)
+	}
+	c := make([]string, len(coords))
+	for i, v := range coords {
+		c[i] = num(v)
+	}
+	d.shadings = append(d.shadings, fmt.Sprintf("<< /ShadingType %d /ColorSpace %s /Coords [%s] /Function %s /Extend [true true] >>",
+		shadingType, space, strings.Join(c, " "), function))
+	// q is not allowed inside of a path, so the path is moved behind it.
+	code := d.Value.String()
+	d.Value = pdfdraw.New()
+	if prefix := strings.TrimSpace(code[:d.pathStart]); prefix != "" {
+		d.Value.Literal(prefix)
+	}
+	d.Value.Literal(fmt.Sprintf("q %s W n /Sh%d sh Q", strings.TrimSpace(code[d.pathStart:]), len(d.shadings)))
+	d.inPath = false
+	return d
+}
+
+// linearGradient implements d.linear_gradient(x1, y1, x2, y2, stops). It fills
+// the current path with a gradient along the line from (x1, y1) to (x2, y2).
+// See gradientFunction for the stops.
+func (d *Drawing) linearGradient(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 5 {
+		return object.NewArgsError("draw.linear_gradient", 5, len(args))
+	}
+	l, errObj := lengths("linear_gradient", 4, args[:4])
+	if errObj != nil {
+		return errObj
+	}
+	return d.shade("linear_gradient", 2, []float64{l[0].ToPT(), l[1].ToPT(), l[2].ToPT(), l[3].ToPT()}, args[4])
+}
+
+// radialGradient implements d.radial_gradient(x1, y1, r1, x2, y2, r2, stops).
+// It fills the current path with a gradient from the circle around (x1, y1)
+// with radius r1 to the circle around (x2, y2) with radius r2.
+func (d *Drawing) radialGradient(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 7 {
+		return object.NewArgsError("draw.radial_gradient", 7, len(args))
+	}
+	l, errObj := lengths("radial_gradient", 6, args[:6])
+	if errObj != nil {
+		return errObj
+	}
+	if l[2] < 0 || l[5] < 0 {
+		return object.ArgsErrorf("draw.radial_gradient(): the radius must not be negative")
+	}
+	coords := make([]float64, len(l))
+	for i, sp := range l {
+		coords[i] = sp.ToPT()
+	}
+	return d.shade("radial_gradient", 3, coords, args[6])
+}
+
+// write implements d.write(filename[, width, height]). The drawing is written
+// as a one page PDF file with the given size, the default size is the extent
+// of the points used. The file can be loaded with load_imagefile.
+func (d *Drawing) write(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 3 {
+		return object.ArgsErrorf("draw.write() takes one argument (filename) or three arguments (filename, width and height)")
+	}
+	filename, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	wd, ht := d.maxX, d.maxY
+	if len(args) == 3 {
+		l, errObj := lengths("write", 2, args[1:])
+		if errObj != nil {
+			return errObj
+		}
+		wd, ht = l[0], l[1]
+	}
+	if wd <= 0 || ht <= 0 {
+		return object.Errorf("draw.write(): the drawing has no size")
+	}
+	if d.spot {
+		return object.Errorf("draw.write(): spot colors are not supported in written drawings")
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return object.NewError(err)
+	}
+	if err = d.writePDF(f, wd, ht); err != nil {
+		f.Close()
+		return object.NewError(err)
+	}
+	if err = f.Close(); err != nil {
+		return object.NewError(err)
+	}
+	return object.Nil
+}
+
+// needsResources returns true if the drawing uses transparency or gradients.
+func (d *Drawing) needsResources() bool {
+	return len(d.extGStates) > 0 || len(d.shadings) > 0
+}
+
+// cachedPDF writes the drawing as a one page PDF file with the given size to
+// the user's cache directory and returns the name of the file. The name is
+// derived from the drawing, so each drawing is written only once.
+func (d *Drawing) cachedPDF(wd, ht bag.ScaledPoint) (string, error) {
+	if wd <= 0 || ht <= 0 {
+		return "", fmt.Errorf("the drawing has no size")
+	}
+	if d.spot {
+		return "", fmt.Errorf("spot colors can't be used together with transparency or gradients")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %d\n%s\n", wd, ht, d.Value.String())
+	for _, gs := range d.extGStates {
+		fmt.Fprintf(h, "gs %s\n", gs)
+	}
+	for _, sh := range d.shadings {
+		fmt.Fprintf(h, "sh %s\n", sh)
+	}
+	return pdfpage.Cached(pdfpage.CacheDir("draw"), hex.EncodeToString(h.Sum(nil)[:16]), func(w io.Writer) error {
+		return d.writePDF(w, wd, ht)
+	})
+}
+
+func (d *Drawing) writePDF(w io.Writer, wd, ht bag.ScaledPoint) error {
+	p := &pdfpage.Page{
+		Width:      wd.ToPT(),
+		Height:     ht.ToPT(),
+		Content:    []byte(d.Value.String()),
+		ExtGStates: d.extGStates,
+		Shadings:   d.shadings,
+	}
+	return p.Write(w)
+}
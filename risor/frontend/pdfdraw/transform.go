@@ -0,0 +1,217 @@
+package pdfdraw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// A transformed box is an hlist with two hidden rules at the same position,
+// one before and one after the contents. The PDF code of the first rule
+// applies the transformation matrix and the second one applies the inverse
+// matrix. The graphics state is not saved and restored, because the text state
+// (the current font for example) must stay in sync with the PDF writer.
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+// mul returns the matrix that applies m first and then n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// apply returns the transformed point.
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// inverse returns the inverse matrix. ok is false if the matrix is not
+// invertible.
+func (m matrix) inverse() (inv matrix, ok bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if math.Abs(det) < 1e-12 {
+		return inv, false
+	}
+	inv[0] = m[3] / det
+	inv[1] = -m[1] / det
+	inv[2] = -m[2] / det
+	inv[3] = m[0] / det
+	inv[4] = -(inv[0]*m[4] + inv[2]*m[5])
+	inv[5] = -(inv[1]*m[4] + inv[3]*m[5])
+	return inv, true
+}
+
+// String returns the PDF code of the matrix. The values are rounded to more
+// decimal places than in the drawings, so that the inverse matrix restores the
+// coordinate system of the page without a visible drift.
+func (m matrix) String() string {
+	f := func(v float64) string { return strconv.FormatFloat(math.Round(v*1e9)/1e9+0, 'f', -1, 64) }
+	return fmt.Sprintf("%s %s %s %s %s %s cm", f(m[0]), f(m[1]), f(m[2]), f(m[3]), f(m[4]), f(m[5]))
+}
+
+// parseTransform returns the matrix for the keys scale (a number or [sx, sy]),
+// mirror (horizontal, vertical or both), skew ([ax, ay] in degrees) and rotate
+// (counterclockwise in degrees). They are applied in this order.
+func parseTransform(m *object.Map) (matrix, error) {
+	ret := matrix{1, 0, 0, 1, 0, 0}
+	opts := m.Value()
+	pair := func(k string) (float64, float64, error) {
+		v := opts[k]
+		if lst, ok := v.(*object.List); ok {
+			if lst.Len().Value() != 2 {
+				return 0, 0, fmt.Errorf("%s: expected a number or a list of two numbers", k)
+			}
+			x, err := toFloat(lst.Value()[0])
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s: %w", k, err)
+			}
+			y, err := toFloat(lst.Value()[1])
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s: %w", k, err)
+			}
+			return x, y, nil
+		}
+		f, err := toFloat(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", k, err)
+		}
+		return f, f, nil
+	}
+	for k := range opts {
+		switch k {
+		case "scale", "mirror", "skew", "rotate":
+		default:
+			return ret, fmt.Errorf("unknown key %s", k)
+		}
+	}
+	if _, ok := opts["scale"]; ok {
+		sx, sy, err := pair("scale")
+		if err != nil {
+			return ret, err
+		}
+		ret = ret.mul(matrix{sx, 0, 0, sy, 0, 0})
+	}
+	if v, ok := opts["mirror"]; ok {
+		s, errObj := object.AsString(v)
+		if errObj != nil {
+			return ret, fmt.Errorf("mirror: %w", errObj.Value())
+		}
+		switch s {
+		case "horizontal":
+			ret = ret.mul(matrix{-1, 0, 0, 1, 0, 0})
+		case "vertical":
+			ret = ret.mul(matrix{1, 0, 0, -1, 0, 0})
+		case "both":
+			ret = ret.mul(matrix{-1, 0, 0, -1, 0, 0})
+		default:
+			return ret, fmt.Errorf("mirror: unknown value %q, expected horizontal, vertical or both", s)
+		}
+	}
+	if _, ok := opts["skew"]; ok {
+		ax, ay, err := pair("skew")
+		if err != nil {
+			return ret, err
+		}
+		ret = ret.mul(matrix{1, math.Tan(ay * math.Pi / 180), math.Tan(ax * math.Pi / 180), 1, 0, 0})
+	}
+	if v, ok := opts["rotate"]; ok {
+		deg, err := toFloat(v)
+		if err != nil {
+			return ret, fmt.Errorf("rotate: %w", err)
+		}
+		a := deg * math.Pi / 180
+		ret = ret.mul(matrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0})
+	}
+	return ret, nil
+}
+
+// transformBox returns a vlist with the box transformed by m. The size of the
+// vlist is the bounding box of the transformed box.
+func transformBox(box node.Node, m matrix) (*node.VList, error) {
+	// A vlist in an hlist is aligned at the top of the hlist, so the box gets
+	// its own hlist to have its depth below the baseline.
+	inner := node.Hpack(box)
+	wd, ht, dp := inner.Width, inner.Height, inner.Depth
+	// The bottom left corner of the box is the origin of the transformation.
+	w, h := wd.ToPT(), (ht + dp).ToPT()
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		x, y := m.apply(p[0], p[1])
+		minX, maxX = min(minX, x), max(maxX, x)
+		minY, maxY = min(minY, y), max(maxY, y)
+	}
+	// The rules are on the baseline, the box is shifted down by its depth.
+	m = matrix{1, 0, 0, 1, 0, dp.ToPT()}.mul(m).mul(matrix{1, 0, 0, 1, -minX, -minY})
+	inv, ok := m.inverse()
+	if !ok {
+		return nil, fmt.Errorf("the transformation is not invertible")
+	}
+	start := node.NewRule()
+	start.Hide = true
+	start.Pre = m.String()
+	stop := node.NewRule()
+	stop.Hide = true
+	stop.Pre = inv.String()
+	back := node.NewKern()
+	back.Kern = -wd
+	width := bag.ScaledPointFromFloat(maxX - minX)
+	advance := node.NewKern()
+	advance.Kern = width
+
+	var head node.Node = start
+	node.InsertAfter(head, start, inner)
+	node.InsertAfter(head, inner, back)
+	node.InsertAfter(head, back, stop)
+	node.InsertAfter(head, stop, advance)
+	hl := node.Hpack(head)
+	hl.Width = width
+	hl.Height = bag.ScaledPointFromFloat(maxY - minY)
+	hl.Depth = 0
+	hl.Attributes = node.H{"origin": "transform"}
+	return node.Vpack(hl), nil
+}
+
+// transform implements draw.transform(box, {rotate, scale, skew, mirror}).
+// The box is an hlist or a vlist, the result is a vlist that has the size of
+// the bounding box of the transformed box.
+func transform(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgsError("draw.transform", 2, len(args))
+	}
+	n, ok := args[0].(*rnode.Node)
+	if !ok {
+		return object.ArgsErrorf("draw.transform() expects a node.hlist or node.vlist as first argument")
+	}
+	switch n.Value.(type) {
+	case *node.HList, *node.VList:
+	default:
+		return object.ArgsErrorf("draw.transform() expects a node.hlist or node.vlist as first argument")
+	}
+	opts, errObj := object.AsMap(args[1])
+	if errObj != nil {
+		return errObj
+	}
+	m, err := parseTransform(opts)
+	if err != nil {
+		return object.ArgsErrorf("draw.transform(): %s", err)
+	}
+	vl, err := transformBox(n.Value, m)
+	if err != nil {
+		return object.ArgsErrorf("draw.transform(): %s", err)
+	}
+	return &rnode.Node{Value: vl}
+}
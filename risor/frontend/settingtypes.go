@@ -0,0 +1,451 @@
+package frontend
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// settingDef describes how the value of a setting is converted between the
+// risor and the Go representation.
+type settingDef struct {
+	name    string
+	toGo    func(object.Object) (any, error)
+	toRisor func(any) object.Object
+}
+
+// enumValue is a named value of an enumeration setting.
+type enumValue struct {
+	name  string
+	value any
+}
+
+var settingDefs = map[frontend.SettingType]settingDef{
+	frontend.SettingBackgroundColor:         {"backgroundcolor", convertColor, colorToRisor},
+	frontend.SettingBorderBottomColor:       {"borderbottomcolor", convertColor, colorToRisor},
+	frontend.SettingBorderBottomLeftRadius:  {"borderbottomleftradius", convertSP, spToRisor},
+	frontend.SettingBorderBottomRightRadius: {"borderbottomrightradius", convertSP, spToRisor},
+	frontend.SettingBorderBottomStyle:       {"borderbottomstyle", borderStyles.toGo, borderStyles.toRisor},
+	frontend.SettingBorderBottomWidth:       {"borderbottomwidth", convertSP, spToRisor},
+	frontend.SettingBorderLeftColor:         {"borderleftcolor", convertColor, colorToRisor},
+	frontend.SettingBorderLeftStyle:         {"borderleftstyle", borderStyles.toGo, borderStyles.toRisor},
+	frontend.SettingBorderLeftWidth:         {"borderleftwidth", convertSP, spToRisor},
+	frontend.SettingBorderRightColor:        {"borderrightcolor", convertColor, colorToRisor},
+	frontend.SettingBorderRightStyle:        {"borderrightstyle", borderStyles.toGo, borderStyles.toRisor},
+	frontend.SettingBorderRightWidth:        {"borderrightwidth", convertSP, spToRisor},
+	frontend.SettingBorderTopColor:          {"bordertopcolor", convertColor, colorToRisor},
+	frontend.SettingBorderTopLeftRadius:     {"bordertopleftradius", convertSP, spToRisor},
+	frontend.SettingBorderTopRightRadius:    {"bordertoprightradius", convertSP, spToRisor},
+	frontend.SettingBorderTopStyle:          {"bordertopstyle", borderStyles.toGo, borderStyles.toRisor},
+	frontend.SettingBorderTopWidth:          {"bordertopwidth", convertSP, spToRisor},
+	frontend.SettingBox:                     {"box", convertBool, boolToRisor},
+	frontend.SettingColor:                   {"color", convertColor, colorToRisor},
+	frontend.SettingDebug:                   {"debug", convertAny, anyToRisor},
+	frontend.SettingFontExpansion:           {"fontexpansion", convertFloat, floatToRisor},
+	frontend.SettingFontFamily:              {"fontfamily", convertFontFamily, fontFamilyToRisor},
+	frontend.SettingFontWeight:              {"fontweight", convertFontWeight, fontWeightToRisor},
+	frontend.SettingHAlign:                  {"halign", hAlignments.toGo, hAlignments.toRisor},
+	frontend.SettingHangingPunctuation:      {"hangingpunctuation", convertHangingPunctuation, hangingPunctuationToRisor},
+	frontend.SettingHeight:                  {"height", convertSP, spToRisor},
+	frontend.SettingHyperlink:               {"hyperlink", convertHyperlink, hyperlinkToRisor},
+	frontend.SettingIndentLeft:              {"indentleft", convertSP, spToRisor},
+	frontend.SettingIndentLeftRows:          {"indentleftrows", convertInt, intToRisor},
+	frontend.SettingLeading:                 {"leading", convertSP, spToRisor},
+	frontend.SettingMarginBottom:            {"marginbottom", convertSP, spToRisor},
+	frontend.SettingMarginLeft:              {"marginleft", convertSP, spToRisor},
+	frontend.SettingMarginRight:             {"marginright", convertSP, spToRisor},
+	frontend.SettingMarginTop:               {"margintop", convertSP, spToRisor},
+	frontend.SettingOpenTypeFeature:         {"opentypefeature", convertOpenTypeFeature, openTypeFeatureToRisor},
+	frontend.SettingPaddingBottom:           {"paddingbottom", convertSP, spToRisor},
+	frontend.SettingPaddingLeft:             {"paddingleft", convertSP, spToRisor},
+	frontend.SettingPaddingRight:            {"paddingright", convertSP, spToRisor},
+	frontend.SettingPaddingTop:              {"paddingtop", convertSP, spToRisor},
+	frontend.SettingPrepend:                 {"prepend", convertNode, nodeToRisor},
+	frontend.SettingPreserveWhitespace:      {"preservewhitespace", convertBool, boolToRisor},
+	frontend.SettingSize:                    {"size", convertSP, spToRisor},
+	frontend.SettingStyle:                   {"style", fontStyles.toGo, fontStyles.toRisor},
+	frontend.SettingTabSize:                 {"tabsize", convertSP, spToRisor},
+	frontend.SettingTabSizeSpaces:           {"tabsizespaces", convertInt, intToRisor},
+	frontend.SettingTextDecorationLine:      {"textdecorationline", textDecorations.toGo, textDecorations.toRisor},
+	frontend.SettingVAlign:                  {"valign", vAlignments.toGo, vAlignments.toRisor},
+	frontend.SettingWidth:                   {"width", convertWidth, anyToRisor},
+	frontend.SettingYOffset:                 {"yoffset", convertSP, spToRisor},
+}
+
+// settingAliases are alternative names for settings.
+var settingAliases = map[string]frontend.SettingType{
+	"fontstyle": frontend.SettingStyle,
+	"fontsize":  frontend.SettingSize,
+}
+
+// settingNames maps the setting names to the setting types.
+var settingNames = func() map[string]frontend.SettingType {
+	names := make(map[string]frontend.SettingType, len(settingDefs)+len(settingAliases))
+	for st, def := range settingDefs {
+		names[def.name] = st
+	}
+	for name, st := range settingAliases {
+		names[name] = st
+	}
+	return names
+}()
+
+// convertSetting validates the risor value for the setting with the given name
+// and returns the setting type and the Go value.
+func convertSetting(name string, value object.Object) (frontend.SettingType, any, error) {
+	st, ok := settingNames[name]
+	if !ok {
+		return frontend.SettingDummy, nil, fmt.Errorf("unknown setting %q", name)
+	}
+	v, err := settingDefs[st].toGo(value)
+	if err != nil {
+		return frontend.SettingDummy, nil, fmt.Errorf("setting %s: %w", settingDefs[st].name, err)
+	}
+	return st, v, nil
+}
+
+// settingToRisor converts the Go value of a setting to a risor object.
+func settingToRisor(st frontend.SettingType, value any) object.Object {
+	if def, ok := settingDefs[st]; ok {
+		return def.toRisor(value)
+	}
+	return anyToRisor(value)
+}
+
+type enumSetting []enumValue
+
+// toGo returns the value for the name. The first entry of a value is its
+// canonical name, the other entries are aliases.
+func (es enumSetting) toGo(obj object.Object) (any, error) {
+	str, ok := obj.(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %s", obj.Type())
+	}
+	for _, ev := range es {
+		if ev.name == str.Value() {
+			return ev.value, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %q", str.Value())
+}
+
+func (es enumSetting) toRisor(value any) object.Object {
+	for _, ev := range es {
+		if ev.value == value {
+			return object.NewString(ev.name)
+		}
+	}
+	return anyToRisor(value)
+}
+
+var hAlignments = enumSetting{
+	{"default", frontend.HAlignDefault},
+	{"left", frontend.HAlignLeft},
+	{"right", frontend.HAlignRight},
+	{"center", frontend.HAlignCenter},
+	{"justify", frontend.HAlignJustified},
+	{"justified", frontend.HAlignJustified},
+}
+
+var vAlignments = enumSetting{
+	{"default", frontend.VAlignDefault},
+	{"top", frontend.VAlignTop},
+	{"middle", frontend.VAlignMiddle},
+	{"bottom", frontend.VAlignBottom},
+}
+
+var fontStyles = enumSetting{
+	{"normal", frontend.FontStyleNormal},
+	{"italic", frontend.FontStyleItalic},
+	{"oblique", frontend.FontStyleOblique},
+}
+
+var borderStyles = enumSetting{
+	{"none", frontend.BorderStyleNone},
+	{"solid", frontend.BorderStyleSolid},
+}
+
+var textDecorations = enumSetting{
+	{"none", frontend.TextDecorationLineNone},
+	{"underline", frontend.TextDecorationUnderline},
+	{"overline", frontend.TextDecorationOverline},
+	{"line-through", frontend.TextDecorationLineThrough},
+}
+
+var fontWeights = enumSetting{
+	{"thin", frontend.FontWeight100},
+	{"extralight", frontend.FontWeight200},
+	{"light", frontend.FontWeight300},
+	{"normal", frontend.FontWeight400},
+	{"medium", frontend.FontWeight500},
+	{"semibold", frontend.FontWeight600},
+	{"bold", frontend.FontWeight700},
+	{"ultrabold", frontend.FontWeight800},
+	{"black", frontend.FontWeight900},
+}
+
+// convertSP accepts a scaled point or a string with a unit such as "12pt".
+func convertSP(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *rbag.RSP:
+		return t.Value, nil
+	case *object.String:
+		return bag.SP(t.Value())
+	}
+	return nil, fmt.Errorf("expected a bag.scaledpoint or a string with a unit, got %s", obj.Type())
+}
+
+func spToRisor(value any) object.Object {
+	if sp, ok := value.(bag.ScaledPoint); ok {
+		return &rbag.RSP{Value: sp}
+	}
+	return anyToRisor(value)
+}
+
+func convertInt(obj object.Object) (any, error) {
+	i, err := object.AsInt(obj)
+	if err != nil {
+		return nil, err.Value()
+	}
+	return int(i), nil
+}
+
+func intToRisor(value any) object.Object {
+	if i, ok := value.(int); ok {
+		return object.NewInt(int64(i))
+	}
+	return anyToRisor(value)
+}
+
+func convertFloat(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *object.Float:
+		return t.Value(), nil
+	case *object.Int:
+		return float64(t.Value()), nil
+	}
+	return nil, fmt.Errorf("expected a float, got %s", obj.Type())
+}
+
+func floatToRisor(value any) object.Object {
+	if f, ok := value.(float64); ok {
+		return object.NewFloat(f)
+	}
+	return anyToRisor(value)
+}
+
+func convertBool(obj object.Object) (any, error) {
+	b, err := object.AsBool(obj)
+	if err != nil {
+		return nil, err.Value()
+	}
+	return b, nil
+}
+
+func boolToRisor(value any) object.Object {
+	if b, ok := value.(bool); ok {
+		return object.NewBool(b)
+	}
+	return anyToRisor(value)
+}
+
+// convertColor accepts a backend color or a color string (a color name, #rgb
+// or rgb(...)). Color strings are resolved by the document when the text is
+// typeset.
+func convertColor(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *rcolor.RColor:
+		return t.Value, nil
+	case *object.String:
+		if t.Value() == "" {
+			return nil, fmt.Errorf("empty color name")
+		}
+		return t.Value(), nil
+	}
+	return nil, fmt.Errorf("expected a color or a color name, got %s", obj.Type())
+}
+
+func colorToRisor(value any) object.Object {
+	switch t := value.(type) {
+	case *color.Color:
+		return &rcolor.RColor{Value: t}
+	case string:
+		return object.NewString(t)
+	}
+	return anyToRisor(value)
+}
+
+func convertFontFamily(obj object.Object) (any, error) {
+	if ff, ok := obj.(*FontFamily); ok {
+		return ff.Value, nil
+	}
+	return nil, fmt.Errorf("expected a frontend.fontfamily, got %s", obj.Type())
+}
+
+func fontFamilyToRisor(value any) object.Object {
+	if ff, ok := value.(*frontend.FontFamily); ok {
+		return &FontFamily{Value: ff}
+	}
+	return anyToRisor(value)
+}
+
+// convertFontWeight accepts a number (100-900) or a name such as "bold".
+func convertFontWeight(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *object.Int:
+		return frontend.FontWeight(t.Value()), nil
+	case *object.String:
+		if i, err := strconv.Atoi(t.Value()); err == nil {
+			return frontend.FontWeight(i), nil
+		}
+		return fontWeights.toGo(t)
+	}
+	return nil, fmt.Errorf("expected an int or a string, got %s", obj.Type())
+}
+
+func fontWeightToRisor(value any) object.Object {
+	switch t := value.(type) {
+	case frontend.FontWeight:
+		return object.NewInt(int64(t))
+	case int:
+		return object.NewInt(int64(t))
+	}
+	return anyToRisor(value)
+}
+
+// convertHangingPunctuation accepts a bool or the string "allow-end".
+func convertHangingPunctuation(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *object.Bool:
+		if t.Value() {
+			return frontend.HangingPunctuation(frontend.HangingPunctuationAllowEnd), nil
+		}
+		return frontend.HangingPunctuation(0), nil
+	case *object.String:
+		switch t.Value() {
+		case "allow-end":
+			return frontend.HangingPunctuation(frontend.HangingPunctuationAllowEnd), nil
+		case "none":
+			return frontend.HangingPunctuation(0), nil
+		}
+		return nil, fmt.Errorf("invalid value %q", t.Value())
+	}
+	return nil, fmt.Errorf("expected a bool or a string, got %s", obj.Type())
+}
+
+func hangingPunctuationToRisor(value any) object.Object {
+	if hp, ok := value.(frontend.HangingPunctuation); ok {
+		return object.NewBool(hp&frontend.HangingPunctuationAllowEnd != 0)
+	}
+	return anyToRisor(value)
+}
+
+// convertHyperlink accepts an URI or a map with the keys uri and local.
+func convertHyperlink(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *object.String:
+		return document.Hyperlink{URI: t.Value()}, nil
+	case *object.Map:
+		hl := document.Hyperlink{}
+		for k, v := range t.Value() {
+			str, err := object.AsString(v)
+			if err != nil {
+				return nil, err.Value()
+			}
+			switch k {
+			case "uri":
+				hl.URI = str
+			case "local":
+				hl.Local = str
+			default:
+				return nil, fmt.Errorf("unknown key %q", k)
+			}
+		}
+		return hl, nil
+	}
+	return nil, fmt.Errorf("expected a string or a map, got %s", obj.Type())
+}
+
+func hyperlinkToRisor(value any) object.Object {
+	if hl, ok := value.(document.Hyperlink); ok {
+		return object.NewMap(map[string]object.Object{
+			"uri":   object.NewString(hl.URI),
+			"local": object.NewString(hl.Local),
+		})
+	}
+	return anyToRisor(value)
+}
+
+// convertOpenTypeFeature accepts a comma separated string or a list of
+// strings such as ["+smcp", "-liga"].
+func convertOpenTypeFeature(obj object.Object) (any, error) {
+	switch t := obj.(type) {
+	case *object.String:
+		return t.Value(), nil
+	case *object.List:
+		features := make([]string, 0, len(t.Value()))
+		for _, itm := range t.Value() {
+			str, err := object.AsString(itm)
+			if err != nil {
+				return nil, err.Value()
+			}
+			features = append(features, str)
+		}
+		return features, nil
+	}
+	return nil, fmt.Errorf("expected a string or a list of strings, got %s", obj.Type())
+}
+
+func openTypeFeatureToRisor(value any) object.Object {
+	switch t := value.(type) {
+	case string:
+		return object.NewString(t)
+	case []string:
+		lst := object.NewList(nil)
+		for _, s := range t {
+			lst.Append(object.NewString(s))
+		}
+		return lst
+	}
+	return anyToRisor(value)
+}
+
+func convertNode(obj object.Object) (any, error) {
+	if n, ok := obj.(*rnode.Node); ok {
+		return n.Value, nil
+	}
+	return nil, fmt.Errorf("expected a node, got %s", obj.Type())
+}
+
+func nodeToRisor(value any) object.Object {
+	if n, ok := value.(node.Node); ok {
+		return &rnode.Node{Value: n}
+	}
+	return anyToRisor(value)
+}
+
+// convertWidth accepts a width such as "100%".
+func convertWidth(obj object.Object) (any, error) {
+	str, ok := obj.(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %s", obj.Type())
+	}
+	return str.Value(), nil
+}
+
+func convertAny(obj object.Object) (any, error) {
+	return obj.Interface(), nil
+}
+
+func anyToRisor(value any) object.Object {
+	return object.FromGoType(value)
+}
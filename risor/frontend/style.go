@@ -0,0 +1,168 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/risor-io/risor/object"
+)
+
+// textStyle is a named set of text settings. Settings that are not set in the
+// style are taken from the parent style.
+type textStyle struct {
+	name     string
+	parent   string
+	settings frontend.TypesettingSettings
+}
+
+// settingStyle is the private setting that holds the style name (class) of a
+// text. The style is resolved by the document when the text is typeset, so
+// the setting never reaches the typesetter, see styledText.
+const settingStyle frontend.SettingType = -1
+
+// styleName returns the style name of the text, "" if the text has none.
+func styleName(te *frontend.Text) string {
+	name, _ := te.Settings[settingStyle].(string)
+	return name
+}
+
+// setStyleName sets the style name of the text. An empty name removes the
+// style.
+func setStyleName(te *frontend.Text, name string) {
+	if name == "" {
+		delete(te.Settings, settingStyle)
+		return
+	}
+	te.Settings[settingStyle] = name
+}
+
+// defineStyle implements f.define_style(name, settings[, parent]). The parent
+// can also be given with the key "parent" in the settings map.
+func (fd *frontendDocument) defineStyle(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 2 || len(args) > 3 {
+		return object.NewArgsRangeError("frontend.define_style", 2, 3, len(args))
+	}
+	name, errObj := object.AsString(args[0])
+	if errObj != nil {
+		return errObj
+	}
+	m, errObj := object.AsMap(args[1])
+	if errObj != nil {
+		return errObj
+	}
+	st := &textStyle{name: name, settings: frontend.TypesettingSettings{}}
+	for _, k := range m.SortedKeys() {
+		if k == "parent" {
+			if st.parent, errObj = object.AsString(m.Get(k)); errObj != nil {
+				return errObj
+			}
+			continue
+		}
+		setting, v, err := convertSetting(k, m.Get(k))
+		if err != nil {
+			return object.ArgsErrorf("frontend.define_style(): %s", err)
+		}
+		st.settings[setting] = v
+	}
+	if len(args) == 3 {
+		if st.parent, errObj = object.AsString(args[2]); errObj != nil {
+			return errObj
+		}
+	}
+	if fd.styles == nil {
+		fd.styles = make(map[string]*textStyle)
+	}
+	fd.styles[name] = st
+	return object.Nil
+}
+
+// styleSettings returns the settings of the style including the settings
+// inherited from the parent styles.
+func (fd *frontendDocument) styleSettings(name string) (frontend.TypesettingSettings, error) {
+	ret := frontend.TypesettingSettings{}
+	seen := map[string]bool{}
+	for name != "" {
+		if seen[name] {
+			return nil, fmt.Errorf("style %q inherits from itself", name)
+		}
+		seen[name] = true
+		st, ok := fd.styles[name]
+		if !ok {
+			return nil, fmt.Errorf("style %q not defined", name)
+		}
+		for k, v := range st.settings {
+			if _, found := ret[k]; !found {
+				ret[k] = v
+			}
+		}
+		name = st.parent
+	}
+	return ret, nil
+}
+
+// styledText returns a copy of te and the texts contained in te with the
+// settings of their styles added. Settings that are set in the text take
+// precedence over the style settings. te is not changed, so a style or a class
+// that is changed applies the next time the text is typeset.
+func (fd *frontendDocument) styledText(te *frontend.Text) (*frontend.Text, error) {
+	ret := frontend.NewText()
+	for k, v := range te.Settings {
+		if k != settingStyle {
+			ret.Settings[k] = v
+		}
+	}
+	if name := styleName(te); name != "" {
+		ss, err := fd.styleSettings(name)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ss {
+			if _, found := ret.Settings[k]; !found {
+				ret.Settings[k] = v
+			}
+		}
+	}
+	ret.Items = make([]any, len(te.Items))
+	for i, itm := range te.Items {
+		if t, ok := itm.(*frontend.Text); ok {
+			c, err := fd.styledText(t)
+			if err != nil {
+				return nil, err
+			}
+			itm = c
+		}
+		ret.Items[i] = itm
+	}
+	return ret, nil
+}
+
+// styleCells replaces the texts in the table cells with styled copies and
+// returns a function that restores the cell contents.
+func (fd *frontendDocument) styleCells(t *Table) (func(), error) {
+	saved := map[*frontend.TableCell][]any{}
+	restore := func() {
+		for cell, contents := range saved {
+			cell.Contents = contents
+		}
+	}
+	for _, tr := range t.rows {
+		for _, td := range tr.cells {
+			contents := make([]any, len(td.Value.Contents))
+			for i, c := range td.Value.Contents {
+				if te, ok := c.(*frontend.Text); ok {
+					styled, err := fd.styledText(te)
+					if err != nil {
+						restore()
+						return nil, err
+					}
+					c = styled
+				}
+				contents[i] = c
+			}
+			saved[td.Value] = td.Value.Contents
+			td.Value.Contents = contents
+		}
+	}
+	return restore, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/boxesandglue/boxesandglue/frontend"
 
 	rbag "github.com/boxesandglue/cli/risor/backend/bag"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
 
 	"github.com/risor-io/risor/object"
 	"github.com/risor-io/risor/op"
@@ -16,15 +17,27 @@ const FrontendTrType = "frontend.tr"
 const FrontendTdType = "frontend.td"
 
 type Table struct {
-	Value *frontend.Table
+	Value      *frontend.Table
+	rows       []*Tr
+	columns    []*tableColumn
+	defaults   tableSettings
+	stripes    []object.Object
+	headerRows int
+	footerRows int
 }
 
+// Tr is a table row. The attributes set on the row are inherited by its
+// cells.
 type Tr struct {
-	Value *frontend.TableRow
+	Value    *frontend.TableRow
+	cells    []*Td
+	settings tableSettings
 }
 
+// Td is a table cell with the attributes set on the cell.
 type Td struct {
-	Value *frontend.TableCell
+	Value    *frontend.TableCell
+	settings tableSettings
 }
 
 func newTable(ctx context.Context, args ...object.Object) object.Object {
@@ -54,13 +67,19 @@ func (tbl *Table) append(ctx context.Context, args ...object.Object) object.Obje
 	}
 	switch args[0].Type() {
 	case FrontendTrType:
-		tbl.Value.Rows = append(tbl.Value.Rows, args[0].(*Tr).Value)
+		tbl.addRow(args[0].(*Tr))
 	default:
 		return object.ArgsErrorf("frontend.table.append() expects a tr argument")
 	}
 	return tbl
 }
 
+// addRow appends the row to the table.
+func (tbl *Table) addRow(tr *Tr) {
+	tbl.rows = append(tbl.rows, tr)
+	tbl.Value.Rows = append(tbl.Value.Rows, tr.Value)
+}
+
 // Inspect returns a string representation of the given object.
 func (tbl *Table) Inspect() string {
 	return "frontend.table"
@@ -98,6 +117,46 @@ func (tbl *Table) SetAttr(name string, value object.Object) error {
 			tbl.Value.Stretch = v.IsTruthy()
 			return nil
 		}
+	case "columns":
+		cols, err := parseTableColumns(value)
+		if err != nil {
+			return object.Errorf("columns: %s", err)
+		}
+		tbl.columns = cols
+		return nil
+	case "defaults":
+		ts, err := parseTableSettings(value)
+		if err != nil {
+			return object.Errorf("defaults: %s", err)
+		}
+		tbl.defaults = ts
+		return nil
+	case "header_rows", "footer_rows":
+		i, errObj := object.AsInt(value)
+		if errObj != nil {
+			return errObj.Value()
+		}
+		if i < 0 {
+			return object.Errorf("%s must not be negative", name)
+		}
+		if name == "header_rows" {
+			tbl.headerRows = int(i)
+		} else {
+			tbl.footerRows = int(i)
+		}
+		return nil
+	case "stripes":
+		lst, errObj := object.AsList(value)
+		if errObj != nil {
+			return errObj.Value()
+		}
+		for _, v := range lst.Value() {
+			if _, err := convertColor(v); err != nil {
+				return object.Errorf("stripes: %s", err)
+			}
+		}
+		tbl.stripes = lst.Value()
+		return nil
 	case "width":
 	}
 	return object.Errorf("cannot set attribute %s on table", name)
@@ -134,13 +193,19 @@ func (tr *Tr) append(ctx context.Context, args ...object.Object) object.Object {
 	}
 	switch args[0].Type() {
 	case FrontendTdType:
-		tr.Value.Cells = append(tr.Value.Cells, args[0].(*Td).Value)
+		tr.addCell(args[0].(*Td))
 	default:
 		return object.ArgsErrorf("frontend.tr.append() expects a td argument")
 	}
 	return tr
 }
 
+// addCell appends the cell to the row.
+func (tr *Tr) addCell(td *Td) {
+	tr.cells = append(tr.cells, td)
+	tr.Value.Cells = append(tr.Value.Cells, td.Value)
+}
+
 // Inspect returns a string representation of the given object.
 func (tr *Tr) Inspect() string {
 	panic("not implemented") // TODO: Implement
@@ -165,9 +230,16 @@ func (tr *Tr) GetAttr(name string) (object.Object, bool) {
 	return nil, false
 }
 
-// SetAttr sets the attribute with the given name on this object.
+// SetAttr sets the attribute with the given name on this object. The
+// attributes are inherited by the cells of the row.
 func (tr *Tr) SetAttr(name string, value object.Object) error {
-	panic("not implemented") // TODO: Implement
+	if tr.settings == nil {
+		tr.settings = tableSettings{}
+	}
+	if err := setInheritedAttr(tr.settings, name, value); err != nil {
+		return object.Errorf("tr: %s", err)
+	}
+	return nil
 }
 
 // IsTruthy returns true if the object is considered "truthy".
@@ -203,9 +275,17 @@ func (td *Td) append(ctx context.Context, args ...object.Object) object.Object {
 	case object.STRING:
 		td.Value.Contents = append(td.Value.Contents, args[0].(*object.String).Value())
 	case FrontendTextType:
-		td.Value.Contents = append(td.Value.Contents, args[0].(*text).Value)
+		txt := args[0].(*text)
+		td.Value.Contents = append(td.Value.Contents, txt.Value)
+	case FrontendTableType:
+		// nested tables are built with the width of the cell
+		td.Value.Contents = append(td.Value.Contents, args[0].(*Table))
 	default:
-		return object.ArgsErrorf("frontend.td.append() expects a string or text argument")
+		n, ok := args[0].(*rnode.Node)
+		if !ok {
+			return object.ArgsErrorf("frontend.td.append() expects a string, text, table or node argument")
+		}
+		td.Value.Contents = append(td.Value.Contents, n.Value)
 	}
 	return td
 }
@@ -236,55 +316,14 @@ func (td *Td) GetAttr(name string) (object.Object, bool) {
 
 // SetAttr sets the attribute with the given name on this object.
 func (td *Td) SetAttr(name string, value object.Object) error {
-	switch name {
-	case "align":
-		if v, ok := value.(*object.String); ok {
-			switch v.Value() {
-			case "left":
-				td.Value.HAlign = frontend.HAlignLeft
-			case "center":
-				td.Value.HAlign = frontend.HAlignCenter
-			case "right":
-				td.Value.HAlign = frontend.HAlignRight
-			case "justify":
-				td.Value.HAlign = frontend.HAlignJustified
-			default:
-				return object.Errorf("invalid value for align: %s", v.Value())
-			}
-			return nil
-		}
-	case "border_top_width":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.BorderTopWidth = v.Value
-			return nil
-		}
-	case "border_bottom_width":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.BorderBottomWidth = v.Value
-			return nil
-		}
-	case "border_left_width":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.BorderLeftWidth = v.Value
-			return nil
-		}
-	case "border_right_width":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.BorderRightWidth = v.Value
-			return nil
-		}
-	case "padding_top":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.PaddingTop = v.Value
-			return nil
-		}
-	case "padding_bottom":
-		if v, ok := value.(*rbag.RSP); ok {
-			td.Value.PaddingBottom = v.Value
-			return nil
-		}
+	if err := setCellAttr(td.Value, name, value); err != nil {
+		return object.Errorf("td: %s", err)
 	}
-	return object.Errorf("cannot set attribute %s on td", name)
+	if td.settings == nil {
+		td.settings = tableSettings{}
+	}
+	td.settings[name] = value
+	return nil
 }
 
 // IsTruthy returns true if the object is considered "truthy".
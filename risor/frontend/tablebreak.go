@@ -0,0 +1,173 @@
+package frontend
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+)
+
+// A table built by build_table carries a tableInfo in its attributes. The
+// table can be broken between two body rows (unless a cell spans both rows).
+// The header rows are repeated at the top of each chunk and the footer rows at
+// the bottom. flow uses the same information to break tables across pages.
+
+const tableInfoAttribute = "table info"
+
+// tableInfo describes the rows of a built table.
+type tableInfo struct {
+	rows   int
+	header []*node.HList
+	footer []*node.HList
+	// keep[i] is true if row i and row i+1 must not be separated.
+	keep         []bool
+	headerHeight bag.ScaledPoint
+	footerHeight bag.ScaledPoint
+}
+
+// newTableInfo returns the break information for the table vlist vl which is
+// built from tbl.
+func newTableInfo(vl *node.VList, tbl *frontend.Table, headerRows, footerRows int) (*tableInfo, error) {
+	var rows []*node.HList
+	for e := vl.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*node.HList); ok {
+			rows = append(rows, hl)
+		}
+	}
+	if len(rows) != len(tbl.Rows) {
+		return nil, fmt.Errorf("table has %d rows but %d rows were built", len(tbl.Rows), len(rows))
+	}
+	if headerRows+footerRows > len(rows) {
+		return nil, fmt.Errorf("table has %d rows, but %d header and %d footer rows", len(rows), headerRows, footerRows)
+	}
+	ti := &tableInfo{
+		rows:   len(rows),
+		header: rows[:headerRows],
+		footer: rows[len(rows)-footerRows:],
+		keep:   make([]bool, len(rows)),
+	}
+	for _, hl := range ti.header {
+		ti.headerHeight += hl.Height + hl.Depth
+	}
+	for _, hl := range ti.footer {
+		ti.footerHeight += hl.Height + hl.Depth
+	}
+	for i, row := range tbl.Rows {
+		if i < headerRows || i >= len(rows)-footerRows-1 {
+			ti.keep[i] = true
+		}
+		for _, cell := range row.Cells {
+			for j := i; j < i+cell.ExtraRowspan && j < len(rows); j++ {
+				ti.keep[j] = true
+			}
+		}
+	}
+	return ti, nil
+}
+
+// isBody returns true if row is neither a header nor a footer row.
+func (ti *tableInfo) isBody(row int) bool {
+	return row >= len(ti.header) && row < ti.rows-len(ti.footer)
+}
+
+// copyNode returns a deep copy of n. Unlike node.CopyList the PDF code of
+// rules (cell backgrounds and borders) and the start stop actions (for
+// example colors) are copied.
+func copyNode(n node.Node) node.Node {
+	starts := map[*node.StartStop]*node.StartStop{}
+	var copyList func(head node.Node) node.Node
+	var cp func(n node.Node) node.Node
+	copyList = func(head node.Node) node.Node {
+		var ret, tail node.Node
+		for e := head; e != nil; e = e.Next() {
+			c := cp(e)
+			ret = node.InsertAfter(ret, tail, c)
+			tail = c
+		}
+		return ret
+	}
+	cp = func(n node.Node) node.Node {
+		switch t := n.(type) {
+		case *node.HList:
+			hl := t.Copy().(*node.HList)
+			hl.List = copyList(t.List)
+			hl.VAlign = t.VAlign
+			hl.GlueOrder = t.GlueOrder
+			hl.Attributes = t.Attributes
+			return hl
+		case *node.VList:
+			vl := t.Copy().(*node.VList)
+			vl.List = copyList(t.List)
+			vl.Attributes = t.Attributes
+			return vl
+		case *node.Rule:
+			r := t.Copy().(*node.Rule)
+			r.Pre, r.Post, r.Hide = t.Pre, t.Post, t.Hide
+			r.Attributes = t.Attributes
+			return r
+		case *node.StartStop:
+			// marks, footnotes and margin notes are not copied
+			ss := node.NewStartStop()
+			ss.Action = t.Action
+			ss.Position = t.Position
+			ss.ShipoutCallback = t.ShipoutCallback
+			ss.Value = t.Value
+			if t.StartNode != nil {
+				ss.StartNode = starts[t.StartNode]
+			} else {
+				starts[t] = ss
+			}
+			return ss
+		}
+		return n.Copy()
+	}
+	return cp(n)
+}
+
+// addTable adds the rows of a table. Breakpoints are inserted between the
+// body rows that may be separated.
+func (ff *flowFlattener) addTable(vl *node.VList, ti *tableInfo) {
+	if ff.afterBox() {
+		ff.items = append(ff.items, flowItem{breakable: true})
+	}
+	row := 0
+	for e := vl.List; e != nil; e = e.Next() {
+		hl, ok := e.(*node.HList)
+		if !ok {
+			continue
+		}
+		if row > 0 && !ti.keep[row-1] {
+			ff.items = append(ff.items, flowItem{breakable: true, table: ti})
+		}
+		fi := flowItem{n: hl}
+		if ti.isBody(row) {
+			fi.table = ti
+		}
+		ff.addNotes(&fi)
+		ff.items = append(ff.items, fi)
+		row++
+	}
+}
+
+// splitTable breaks the table into vlists. The first vlist has at most the
+// height firstHeight, the others at most the height height.
+func splitTable(vl *node.VList, ti *tableInfo, firstHeight, height bag.ScaledPoint) []*node.VList {
+	ff := &flowFlattener{}
+	ff.addTable(vl, ti)
+	items := ff.items
+	var chunks []*node.VList
+	avail := firstHeight
+	for start := 0; start < len(items); start = skipDiscardable(items, start) {
+		end, ok := nextBreak(items, start, avail, 0)
+		if !ok {
+			bag.Logger.Warn("build_table: table rows do not fit into the height")
+		}
+		chunk := packItems(items, start, end)
+		chunk.Attributes = node.H{"origin": "table"}
+		chunks = append(chunks, chunk)
+		start = end
+		avail = height
+	}
+	return chunks
+}
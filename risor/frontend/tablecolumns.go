@@ -0,0 +1,186 @@
+package frontend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/risor-io/risor/object"
+)
+
+// tableColumn is a column definition of a table. A column has either a fixed
+// width or a relative width (factor > 0) which is a share of the space left
+// by the fixed columns. min and max limit the width of relative columns.
+type tableColumn struct {
+	width  bag.ScaledPoint
+	factor float64
+	min    bag.ScaledPoint
+	max    bag.ScaledPoint
+}
+
+// parseColumnWidth sets the width of the column from a fixed width ("3cm" or a
+// bag.scaledpoint) or a relative width ("*", "2*", "0.5*").
+func (col *tableColumn) parseColumnWidth(obj object.Object) error {
+	if s, ok := obj.(*object.String); ok && strings.HasSuffix(s.Value(), "*") {
+		col.factor = 1
+		if f := strings.TrimSuffix(s.Value(), "*"); f != "" {
+			var err error
+			if col.factor, err = strconv.ParseFloat(f, 64); err != nil || col.factor <= 0 {
+				return fmt.Errorf("invalid relative width %q", s.Value())
+			}
+		}
+		return nil
+	}
+	sp, err := convertSP(obj)
+	if err != nil {
+		return err
+	}
+	col.width = sp.(bag.ScaledPoint)
+	return nil
+}
+
+// parseTableColumns reads the column definitions from a list. Each entry is a
+// width (see parseColumnWidth) or a map with the keys width, min and max.
+func parseTableColumns(obj object.Object) ([]*tableColumn, error) {
+	lst, errObj := object.AsList(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	var cols []*tableColumn
+	for i, v := range lst.Value() {
+		col := &tableColumn{}
+		m, ok := v.(*object.Map)
+		if !ok {
+			if err := col.parseColumnWidth(v); err != nil {
+				return nil, fmt.Errorf("column %d: %w", i+1, err)
+			}
+			cols = append(cols, col)
+			continue
+		}
+		col.factor = 1
+		for k, val := range m.Value() {
+			var err error
+			switch k {
+			case "width":
+				col.factor = 0
+				err = col.parseColumnWidth(val)
+			case "min", "max":
+				var sp any
+				if sp, err = convertSP(val); err == nil {
+					if k == "min" {
+						col.min = sp.(bag.ScaledPoint)
+					} else {
+						col.max = sp.(bag.ScaledPoint)
+					}
+				}
+			default:
+				err = fmt.Errorf("unknown key %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %w", i+1, err)
+			}
+		}
+		if col.max > 0 && col.max < col.min {
+			return nil, fmt.Errorf("column %d: max is smaller than min", i+1)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// columnWidths returns the widths of the columns for a table of the given
+// width. The relative columns share the space left by the fixed columns.
+// Columns whose share violates min or max get the limit and the other
+// relative columns are distributed again.
+func columnWidths(cols []*tableColumn, width bag.ScaledPoint) []bag.ScaledPoint {
+	widths := make([]bag.ScaledPoint, len(cols))
+	open := map[int]bool{}
+	avail := width
+	for i, col := range cols {
+		if col.factor > 0 {
+			open[i] = true
+		} else {
+			widths[i] = col.width
+			avail -= col.width
+		}
+	}
+	for len(open) > 0 {
+		sumFactors := 0.0
+		for i := range open {
+			sumFactors += cols[i].factor
+		}
+		fixed := false
+		share := avail.ToPT() / sumFactors
+		for i := range open {
+			col := cols[i]
+			wd := bag.ScaledPointFromFloat(share * col.factor)
+			if wd < col.min {
+				wd = col.min
+			} else if col.max > 0 && wd > col.max {
+				wd = col.max
+			} else {
+				continue
+			}
+			widths[i] = wd
+			avail -= wd
+			delete(open, i)
+			fixed = true
+		}
+		if !fixed {
+			for i := range open {
+				widths[i] = bag.ScaledPointFromFloat(share * cols[i].factor)
+			}
+			break
+		}
+	}
+	return widths
+}
+
+// countColumns returns the number of columns of the table taking the colspan
+// and the rowspan of the cells into account.
+func countColumns(tbl *frontend.Table) int {
+	n := 0
+	// the columns occupied by cells from the rows above
+	occupied := map[int]int{}
+	for i, row := range tbl.Rows {
+		c := occupied[i]
+		for _, cell := range row.Cells {
+			c += 1 + cell.ExtraColspan
+			for j := 1; j <= cell.ExtraRowspan; j++ {
+				occupied[i+j] += 1 + cell.ExtraColspan
+			}
+		}
+		if c > n {
+			n = c
+		}
+	}
+	return n
+}
+
+// setColumnSpecs sets the column widths of the table from the column
+// definitions and returns the sum of the widths. The table must be built with
+// this width, because the column glues have no stretch.
+func setColumnSpecs(tbl *frontend.Table, cols []*tableColumn) (bag.ScaledPoint, error) {
+	if n := countColumns(tbl); n != len(cols) {
+		return 0, fmt.Errorf("the table has %d columns but %d column definitions", n, len(cols))
+	}
+	relative := false
+	for _, col := range cols {
+		relative = relative || col.factor > 0
+	}
+	if relative && tbl.MaxWidth == 0 {
+		return 0, fmt.Errorf("relative column widths need the max_width of the table")
+	}
+	tbl.ColSpec = tbl.ColSpec[:0]
+	sum := bag.ScaledPoint(0)
+	for _, wd := range columnWidths(cols, tbl.MaxWidth) {
+		g := node.NewGlue()
+		g.Width = wd
+		sum += wd
+		tbl.ColSpec = append(tbl.ColSpec, frontend.ColSpec{ColumnWidth: g})
+	}
+	return sum, nil
+}
@@ -0,0 +1,121 @@
+package frontend
+
+import (
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+)
+
+// The table builder formats texts in cells, but it does not measure other
+// contents and it supports only one formatting function per cell. Cells with
+// nodes (images, boxes) or nested tables get a single formatting function
+// for all of their contents while the table is built.
+
+// prepareCellContents replaces the contents of the cells that contain other
+// things than texts. The returned function restores the contents.
+func (fd *frontendDocument) prepareCellContents(tbl *frontend.Table) func() {
+	saved := map[*frontend.TableCell][]any{}
+	for _, row := range tbl.Rows {
+		for _, cell := range row.Cells {
+			for _, c := range cell.Contents {
+				if _, ok := c.(*frontend.Text); !ok {
+					saved[cell] = cell.Contents
+					cell.Contents = []any{fd.cellContents(cell, cell.Contents)}
+					break
+				}
+			}
+		}
+	}
+	return func() {
+		for cell, contents := range saved {
+			cell.Contents = contents
+		}
+	}
+}
+
+// cellContents returns a function that formats the contents of a cell below
+// each other. The table builder measures the cell with the width of the
+// returned list, so the natural width of the contents is set as the width.
+func (fd *frontendDocument) cellContents(cell *frontend.TableCell, contents []any) frontend.FormatToVList {
+	return func(width bag.ScaledPoint) (*node.VList, error) {
+		var head, tail node.Node
+		var natural bag.ScaledPoint
+		for _, c := range contents {
+			var n node.Node
+			var wd bag.ScaledPoint
+			switch t := c.(type) {
+			case *frontend.Text:
+				// like format_paragraph, so the leading follows the font size
+				info, err := formatParagraph(fd.value, &paragraphOptions{text: t, width: width})
+				if err != nil {
+					return nil, err
+				}
+				n, wd = info.vlist, info.vlist.Width
+				if len(info.lines) > 0 {
+					// the natural width of the longest line
+					wd = 0
+					for _, li := range info.lines {
+						wd = max(wd, li.natural)
+					}
+				}
+			case *Table:
+				vl, err := fd.buildNestedTable(t, width)
+				if err != nil {
+					return nil, err
+				}
+				n, wd = vl, vl.Width
+			case node.Node:
+				n = copyNode(t)
+				wd, _, _ = node.Dimensions(n, n, node.Horizontal)
+				n = alignBox(n, wd, width, cell.HAlign)
+			}
+			natural = max(natural, wd)
+			head = node.InsertAfter(head, tail, n)
+			tail = n
+		}
+		vl := node.Vpack(head)
+		vl.Width = natural
+		return node.Vpack(node.Hpack(vl)), nil
+	}
+}
+
+// alignBox returns an hlist with the box n of the width wd aligned in the
+// given width. Boxes wider than width and boxes that are measured with the
+// maximum width are not aligned.
+func alignBox(n node.Node, wd, width bag.ScaledPoint, align frontend.HorizontalAlignment) node.Node {
+	if wd >= width || width == bag.MaxSP {
+		if _, ok := n.(*node.VList); ok {
+			return n
+		}
+		return node.Hpack(n)
+	}
+	fil := func() node.Node {
+		g := node.NewGlue()
+		g.Stretch = bag.Factor
+		g.StretchOrder = 1
+		return g
+	}
+	var head node.Node = n
+	if align == frontend.HAlignCenter || align == frontend.HAlignRight {
+		head = node.InsertBefore(head, n, fil())
+	}
+	if align != frontend.HAlignRight {
+		node.InsertAfter(head, n, fil())
+	}
+	return node.HpackTo(head, width)
+}
+
+// buildNestedTable builds a table in a cell with the width of the cell. A
+// smaller max_width of the nested table is kept.
+func (fd *frontendDocument) buildNestedTable(t *Table, width bag.ScaledPoint) (*node.VList, error) {
+	maxWidth := t.Value.MaxWidth
+	defer func() { t.Value.MaxWidth = maxWidth }()
+	if maxWidth == 0 || maxWidth > width {
+		t.Value.MaxWidth = width
+	}
+	vls, err := fd.buildTableNodes(t)
+	if err != nil {
+		return nil, err
+	}
+	return vls[0], nil
+}
@@ -0,0 +1,497 @@
+package frontend
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	rnode "github.com/boxesandglue/cli/risor/backend/node"
+	"github.com/risor-io/risor/object"
+)
+
+// dataColumn is a column of a table created by table_from_rows.
+type dataColumn struct {
+	key    string
+	title  string
+	align  string
+	width  object.Object
+	format object.Object
+}
+
+// dataTableOptions are the options of table_from_rows.
+type dataTableOptions struct {
+	columns    []*dataColumn
+	header     bool
+	formatters map[string]object.Object
+	text       *object.Map
+	headerText *object.Map
+	maxWidth   object.Object
+	separator  rune
+}
+
+func parseDataColumns(obj object.Object) ([]*dataColumn, error) {
+	lst, errObj := object.AsList(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	var cols []*dataColumn
+	for i, v := range lst.Value() {
+		switch t := v.(type) {
+		case *object.String:
+			cols = append(cols, &dataColumn{key: t.Value(), title: t.Value()})
+		case *object.Map:
+			col := &dataColumn{}
+			for k, cv := range t.Value() {
+				var errObj *object.Error
+				switch k {
+				case "key":
+					col.key, errObj = object.AsString(cv)
+				case "title":
+					col.title, errObj = object.AsString(cv)
+				case "align":
+					col.align, errObj = object.AsString(cv)
+				case "width":
+					col.width = cv
+				case "format":
+					col.format = cv
+				default:
+					return nil, fmt.Errorf("column %d: unknown key %s", i+1, k)
+				}
+				if errObj != nil {
+					return nil, fmt.Errorf("column %d: %s: %w", i+1, k, errObj.Value())
+				}
+			}
+			if col.key == "" {
+				return nil, fmt.Errorf("column %d: key is missing", i+1)
+			}
+			if _, ok := t.Value()["title"]; !ok {
+				col.title = col.key
+			}
+			cols = append(cols, col)
+		default:
+			return nil, fmt.Errorf("column %d: expected a string or a map, got %s", i+1, v.Type())
+		}
+	}
+	return cols, nil
+}
+
+func parseDataTableOptions(obj object.Object) (*dataTableOptions, error) {
+	opts := &dataTableOptions{header: true, separator: ','}
+	if obj == nil {
+		return opts, nil
+	}
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	for k, v := range m.Value() {
+		var err error
+		switch k {
+		case "columns":
+			opts.columns, err = parseDataColumns(v)
+		case "header":
+			var errObj *object.Error
+			if opts.header, errObj = object.AsBool(v); errObj != nil {
+				err = errObj.Value()
+			}
+		case "formatters":
+			fm, errObj := object.AsMap(v)
+			if errObj != nil {
+				return nil, errObj.Value()
+			}
+			opts.formatters = fm.Value()
+		case "text", "header_text":
+			tm, errObj := object.AsMap(v)
+			if errObj != nil {
+				return nil, errObj.Value()
+			}
+			if k == "text" {
+				opts.text = tm
+			} else {
+				opts.headerText = tm
+			}
+		case "max_width":
+			opts.maxWidth = v
+		case "separator":
+			sep, errObj := object.AsString(v)
+			if errObj != nil {
+				return nil, errObj.Value()
+			}
+			if utf8.RuneCountInString(sep) != 1 {
+				return nil, fmt.Errorf("separator must be a single character")
+			}
+			opts.separator, _ = utf8.DecodeRuneInString(sep)
+		default:
+			err = fmt.Errorf("unknown option %s", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.headerText == nil {
+		opts.headerText = opts.text
+	}
+	return opts, nil
+}
+
+// readDataRows returns the rows from a list of maps or from a CSV file. The
+// first line of the CSV file contains the keys. keys are the column keys in
+// the order of the CSV file or the sorted keys of the first map.
+func readDataRows(obj object.Object, separator rune) (rows []*object.Map, keys []string, err error) {
+	switch t := obj.(type) {
+	case *object.List:
+		for i, v := range t.Value() {
+			m, ok := v.(*object.Map)
+			if !ok {
+				return nil, nil, fmt.Errorf("row %d: expected a map, got %s", i+1, v.Type())
+			}
+			rows = append(rows, m)
+		}
+		if len(rows) > 0 {
+			keys = rows[0].SortedKeys()
+		}
+		return rows, keys, nil
+	case *object.String:
+		f, err := os.Open(t.Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r := csv.NewReader(f)
+		r.Comma = separator
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil, nil
+		}
+		keys = records[0]
+		for _, rec := range records[1:] {
+			m := make(map[string]object.Object, len(keys))
+			for i, k := range keys {
+				if i < len(rec) {
+					m[k] = object.NewString(rec[i])
+				}
+			}
+			rows = append(rows, object.NewMap(m))
+		}
+		return rows, keys, nil
+	}
+	return nil, nil, fmt.Errorf("expected a list of maps or the name of a CSV file, got %s", obj.Type())
+}
+
+// toFloat returns the number in obj. Strings (from CSV files) are parsed.
+func toFloat(obj object.Object) (float64, error) {
+	switch t := obj.(type) {
+	case *object.Int:
+		return float64(t.Value()), nil
+	case *object.Float:
+		return t.Value(), nil
+	case *object.String:
+		return strconv.ParseFloat(strings.TrimSpace(t.Value()), 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %s", obj.Type())
+}
+
+// formatNumber formats the number with the given number of decimals and
+// separators.
+func formatNumber(f float64, decimals int, decimalSep, thousandsSep string) string {
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(thousandsSep)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(decimalSep)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// formatWithMap formats a number with the keys decimals, decimal, thousands,
+// prefix and suffix or a date with the keys date (the Go layout of the output)
+// and parse (the Go layout of string values).
+func formatWithMap(value object.Object, m *object.Map) (string, error) {
+	opts := m.Value()
+	if layout, ok := opts["date"]; ok {
+		out, errObj := object.AsString(layout)
+		if errObj != nil {
+			return "", errObj.Value()
+		}
+		var tm time.Time
+		switch t := value.(type) {
+		case *object.Time:
+			tm = t.Value()
+		case *object.String:
+			in := time.RFC3339
+			if p, ok := opts["parse"]; ok {
+				if in, errObj = object.AsString(p); errObj != nil {
+					return "", errObj.Value()
+				}
+			}
+			var err error
+			if tm, err = time.Parse(in, strings.TrimSpace(t.Value())); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("expected a time, got %s", value.Type())
+		}
+		return tm.Format(out), nil
+	}
+	f, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	decimals, decimalSep, thousandsSep := int64(-1), ".", ""
+	var prefix, suffix string
+	for k, v := range opts {
+		var errObj *object.Error
+		switch k {
+		case "decimals":
+			decimals, errObj = object.AsInt(v)
+		case "decimal":
+			decimalSep, errObj = object.AsString(v)
+		case "thousands":
+			thousandsSep, errObj = object.AsString(v)
+		case "prefix":
+			prefix, errObj = object.AsString(v)
+		case "suffix":
+			suffix, errObj = object.AsString(v)
+		default:
+			return "", fmt.Errorf("unknown format key %s", k)
+		}
+		if errObj != nil {
+			return "", errObj.Value()
+		}
+	}
+	return prefix + formatNumber(f, int(decimals), decimalSep, thousandsSep) + suffix, nil
+}
+
+// printfVerb returns the verb of the first formatting directive in format.
+func printfVerb(format string) byte {
+	i := strings.IndexByte(format, '%')
+	for i >= 0 && i+1 < len(format) {
+		for j := i + 1; j < len(format); j++ {
+			c := format[j]
+			if strings.IndexByte("+-# 0123456789.", c) < 0 {
+				if c != '%' {
+					return c
+				}
+				i = j + 1
+				break
+			}
+		}
+		if next := strings.IndexByte(format[i:], '%'); next >= 0 {
+			i += next
+		} else {
+			break
+		}
+	}
+	return 0
+}
+
+// formatWithString formats a time with a Go layout and other values with a
+// printf format. Strings are converted to numbers for numeric formats.
+func formatWithString(value object.Object, format string) (string, error) {
+	if t, ok := value.(*object.Time); ok {
+		return t.Value().Format(format), nil
+	}
+	switch printfVerb(format) {
+	case 'd', 'x', 'X', 'o', 'b':
+		f, err := toFloat(value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(format, int64(f)), nil
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		f, err := toFloat(value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(format, f), nil
+	}
+	return fmt.Sprintf(format, value.Interface()), nil
+}
+
+// valueString returns the text of a value without a formatter.
+func valueString(value object.Object) string {
+	switch t := value.(type) {
+	case *object.String:
+		return t.Value()
+	case *object.Float:
+		return strconv.FormatFloat(t.Value(), 'f', -1, 64)
+	case *object.Time:
+		return t.Value().Format("2006-01-02")
+	case *object.NilType:
+		return ""
+	}
+	return value.Inspect()
+}
+
+// formatValue returns the cell contents for the value. A formatter is a
+// function which gets the value and the row and returns a string, a text or a
+// node, a format string or a map (see formatWithMap).
+func formatValue(ctx context.Context, value object.Object, formatter object.Object, row *object.Map) (object.Object, error) {
+	if value == nil {
+		value = object.Nil
+	}
+	switch f := formatter.(type) {
+	case nil:
+		return object.NewString(valueString(value)), nil
+	case object.Callable:
+		ret := f.Call(ctx, value, row)
+		switch t := ret.(type) {
+		case *object.Error:
+			return nil, t.Value()
+		case *object.String, *text, *rnode.Node:
+			return ret, nil
+		}
+		return object.NewString(valueString(ret)), nil
+	case *object.String:
+		if value == object.Nil {
+			return object.NewString(""), nil
+		}
+		s, err := formatWithString(value, f.Value())
+		return object.NewString(s), err
+	case *object.Map:
+		if value == object.Nil {
+			return object.NewString(""), nil
+		}
+		s, err := formatWithMap(value, f)
+		return object.NewString(s), err
+	}
+	return nil, fmt.Errorf("a formatter must be a function, a string or a map, got %s", formatter.Type())
+}
+
+// dataCell returns a cell with the contents. Strings and texts are put into a
+// text with the text settings. The paragraph gets the alignment of the column
+// unless the settings have a halign.
+func dataCell(ctx context.Context, contents object.Object, settings *object.Map, align string) (*Td, error) {
+	td := newTd(ctx).(*Td)
+	if _, ok := contents.(*rnode.Node); !ok {
+		m := map[string]object.Object{"items": object.NewList([]object.Object{contents})}
+		if settings != nil {
+			for k, v := range settings.Value() {
+				m[k] = v
+			}
+		}
+		if _, ok := m["halign"]; !ok && align != "" {
+			m["halign"] = object.NewString(align)
+		}
+		contents = newText(ctx, object.NewMap(m))
+		if errObj, ok := contents.(*object.Error); ok {
+			return nil, errObj.Value()
+		}
+	}
+	if errObj, ok := td.append(ctx, contents).(*object.Error); ok {
+		return nil, errObj.Value()
+	}
+	if align != "" {
+		if err := td.SetAttr("align", object.NewString(align)); err != nil {
+			return nil, err
+		}
+	}
+	return td, nil
+}
+
+// tableFromRows implements frontend.table_from_rows(rows[, {columns, header,
+// formatters, text, header_text, max_width, separator}]). rows is a list of
+// maps or the name of a CSV file. The columns are a list of keys or maps with
+// the keys key, title, align, width and format. The header row is repeated
+// when the table breaks across pages.
+func tableFromRows(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return object.NewArgsRangeError("frontend.table_from_rows", 1, 2, len(args))
+	}
+	var optsArg object.Object
+	if len(args) == 2 {
+		optsArg = args[1]
+	}
+	opts, err := parseDataTableOptions(optsArg)
+	if err != nil {
+		return object.ArgsErrorf("frontend.table_from_rows(): %s", err)
+	}
+	rows, keys, err := readDataRows(args[0], opts.separator)
+	if err != nil {
+		return object.ArgsErrorf("frontend.table_from_rows(): %s", err)
+	}
+	cols := opts.columns
+	if cols == nil {
+		for _, k := range keys {
+			cols = append(cols, &dataColumn{key: k, title: k})
+		}
+	}
+	tbl := &Table{Value: &frontend.Table{}}
+	if opts.header {
+		tr := &Tr{Value: &frontend.TableRow{}}
+		for _, col := range cols {
+			td, err := dataCell(ctx, object.NewString(col.title), opts.headerText, col.align)
+			if err != nil {
+				return object.NewError(err)
+			}
+			tr.addCell(td)
+		}
+		tbl.addRow(tr)
+		tbl.headerRows = 1
+	}
+	for i, row := range rows {
+		tr := &Tr{Value: &frontend.TableRow{}}
+		for _, col := range cols {
+			formatter := col.format
+			if f, ok := opts.formatters[col.key]; ok {
+				formatter = f
+			}
+			contents, err := formatValue(ctx, row.Value()[col.key], formatter, row)
+			if err != nil {
+				return object.Errorf("frontend.table_from_rows(): row %d, column %s: %s", i+1, col.key, err)
+			}
+			td, err := dataCell(ctx, contents, opts.text, col.align)
+			if err != nil {
+				return object.NewError(err)
+			}
+			tr.addCell(td)
+		}
+		tbl.addRow(tr)
+	}
+	widths := false
+	for _, col := range cols {
+		widths = widths || col.width != nil
+	}
+	if widths {
+		var lst []object.Object
+		for _, col := range cols {
+			if col.width == nil {
+				lst = append(lst, object.NewString("*"))
+			} else {
+				lst = append(lst, col.width)
+			}
+		}
+		if err := tbl.SetAttr("columns", object.NewList(lst)); err != nil {
+			return object.ArgsErrorf("frontend.table_from_rows(): %s", err)
+		}
+	}
+	if opts.maxWidth != nil {
+		sp, err := convertSP(opts.maxWidth)
+		if err != nil {
+			return object.ArgsErrorf("frontend.table_from_rows(): max_width: %s", err)
+		}
+		tbl.Value.MaxWidth = sp.(bag.ScaledPoint)
+	}
+	return tbl
+}
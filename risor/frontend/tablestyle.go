@@ -0,0 +1,423 @@
+package frontend
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+	rcolor "github.com/boxesandglue/cli/risor/backend/color"
+	rpdfdraw "github.com/boxesandglue/cli/risor/frontend/pdfdraw"
+	"github.com/risor-io/risor/object"
+)
+
+// The cell attributes can be set on the table (defaults), on the rows and on
+// the cells. Rows inherit the table defaults and cells inherit the row
+// attributes. The attributes are collected when the table is built. Colors
+// can be given as color names which are resolved by the document.
+//
+// Cell backgrounds and border styles other than solid are not drawn by the
+// table builder, so the built cells are decorated afterwards. The attribute
+// background is a drawing which is scaled to the size of the cell.
+
+var borderSides = []string{"top", "right", "bottom", "left"}
+
+// shorthands are attributes which set the attribute for all four sides.
+var shorthands = map[string]string{
+	"border_width": "border_%s_width",
+	"border_color": "border_%s_color",
+	"border_style": "border_%s_style",
+	"padding":      "padding_%s",
+}
+
+var cellBorderStyles = map[string]bool{
+	"solid":  true,
+	"dashed": true,
+	"dotted": true,
+	"none":   true,
+}
+
+// tableSettings holds the cell attributes of a table, a row or a cell.
+type tableSettings map[string]object.Object
+
+// keys returns the keys with the shorthands first, so that attributes for a
+// single side override the shorthands on the same level.
+func (ts tableSettings) keys() []string {
+	keys := make([]string, 0, len(ts))
+	for k := range ts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		_, sa := shorthands[keys[a]]
+		_, sb := shorthands[keys[b]]
+		if sa != sb {
+			return sa
+		}
+		return keys[a] < keys[b]
+	})
+	return keys
+}
+
+// cellDecoration is the part of the cell appearance that is drawn after the
+// table is built.
+type cellDecoration struct {
+	background  *color.Color
+	drawing     *rpdfdraw.Drawing
+	borderStyle map[string]string
+}
+
+// setCellAttr sets the attribute on the cell. Color and border style
+// attributes are only checked, they are set by setCellDecoration when the
+// table is built.
+func setCellAttr(cell *frontend.TableCell, name string, value object.Object) error {
+	if pattern, ok := shorthands[name]; ok {
+		for _, side := range borderSides {
+			if err := setCellAttr(cell, fmt.Sprintf(pattern, side), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	sp := func(dest *bag.ScaledPoint) error {
+		v, err := convertSP(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*dest = v.(bag.ScaledPoint)
+		return nil
+	}
+	str := func() (string, error) {
+		s, errObj := object.AsString(value)
+		if errObj != nil {
+			return "", fmt.Errorf("%s: %w", name, errObj.Value())
+		}
+		return s, nil
+	}
+	switch name {
+	case "align":
+		s, err := str()
+		if err != nil {
+			return err
+		}
+		switch s {
+		case "left":
+			cell.HAlign = frontend.HAlignLeft
+		case "center":
+			cell.HAlign = frontend.HAlignCenter
+		case "right":
+			cell.HAlign = frontend.HAlignRight
+		case "justify":
+			cell.HAlign = frontend.HAlignJustified
+		default:
+			return fmt.Errorf("invalid value for align: %s", s)
+		}
+	case "valign":
+		s, err := str()
+		if err != nil {
+			return err
+		}
+		switch s {
+		case "top":
+			cell.VAlign = frontend.VAlignTop
+		case "middle":
+			cell.VAlign = frontend.VAlignMiddle
+		case "bottom":
+			cell.VAlign = frontend.VAlignBottom
+		default:
+			return fmt.Errorf("invalid value for valign: %s", s)
+		}
+	case "border_top_width":
+		return sp(&cell.BorderTopWidth)
+	case "border_right_width":
+		return sp(&cell.BorderRightWidth)
+	case "border_bottom_width":
+		return sp(&cell.BorderBottomWidth)
+	case "border_left_width":
+		return sp(&cell.BorderLeftWidth)
+	case "padding_top":
+		return sp(&cell.PaddingTop)
+	case "padding_right":
+		return sp(&cell.PaddingRight)
+	case "padding_bottom":
+		return sp(&cell.PaddingBottom)
+	case "padding_left":
+		return sp(&cell.PaddingLeft)
+	case "colspan", "rowspan":
+		i, errObj := object.AsInt(value)
+		if errObj != nil {
+			return fmt.Errorf("%s: %w", name, errObj.Value())
+		}
+		if i < 1 {
+			return fmt.Errorf("%s must be at least 1", name)
+		}
+		if name == "colspan" {
+			cell.ExtraColspan = int(i) - 1
+		} else {
+			cell.ExtraRowspan = int(i) - 1
+		}
+	case "background_color", "border_top_color", "border_right_color", "border_bottom_color", "border_left_color":
+		if _, err := convertColor(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	case "background":
+		if _, ok := value.(*rpdfdraw.Drawing); !ok {
+			return fmt.Errorf("background: expected a draw.drawing, got %s", value.Type())
+		}
+	case "border_top_style", "border_right_style", "border_bottom_style", "border_left_style":
+		s, err := str()
+		if err != nil {
+			return err
+		}
+		if !cellBorderStyles[s] {
+			return fmt.Errorf("invalid value for %s: %s", name, s)
+		}
+	default:
+		return fmt.Errorf("unknown attribute %s", name)
+	}
+	return nil
+}
+
+// parseTableSettings reads inheritable cell attributes from a map. The
+// attributes are checked on a scratch cell.
+func parseTableSettings(obj object.Object) (tableSettings, error) {
+	m, errObj := object.AsMap(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	ts := tableSettings{}
+	for k, v := range m.Value() {
+		if err := setInheritedAttr(ts, k, v); err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// setInheritedAttr checks and stores an attribute of a table or a row.
+func setInheritedAttr(ts tableSettings, name string, value object.Object) error {
+	if name == "colspan" || name == "rowspan" {
+		return fmt.Errorf("%s can only be set on a cell", name)
+	}
+	if err := setCellAttr(&frontend.TableCell{}, name, value); err != nil {
+		return err
+	}
+	ts[name] = value
+	return nil
+}
+
+// resolveColor returns the color for a backend color or a color name.
+func (fd *frontendDocument) resolveColor(obj object.Object) (*color.Color, error) {
+	if c, ok := obj.(*rcolor.RColor); ok {
+		if c.Value == nil {
+			return nil, fmt.Errorf("the color is not defined")
+		}
+		return c.Value, nil
+	}
+	name, errObj := object.AsString(obj)
+	if errObj != nil {
+		return nil, errObj.Value()
+	}
+	col := fd.value.GetColor(name)
+	if col == nil {
+		return nil, fmt.Errorf("unknown color %s", name)
+	}
+	return col, nil
+}
+
+// setCellDecoration sets the color and border style attributes of the cell.
+func (fd *frontendDocument) setCellDecoration(cell *frontend.TableCell, dec *cellDecoration, name string, value object.Object) error {
+	if pattern, ok := shorthands[name]; ok {
+		for _, side := range borderSides {
+			if err := fd.setCellDecoration(cell, dec, fmt.Sprintf(pattern, side), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var col **color.Color
+	switch name {
+	case "background":
+		dec.drawing = value.(*rpdfdraw.Drawing)
+		return nil
+	case "background_color":
+		col = &dec.background
+	case "border_top_color":
+		col = &cell.BorderTopColor
+	case "border_right_color":
+		col = &cell.BorderRightColor
+	case "border_bottom_color":
+		col = &cell.BorderBottomColor
+	case "border_left_color":
+		col = &cell.BorderLeftColor
+	case "border_top_style", "border_right_style", "border_bottom_style", "border_left_style":
+		style, errObj := object.AsString(value)
+		if errObj != nil {
+			return errObj.Value()
+		}
+		if dec.borderStyle == nil {
+			dec.borderStyle = make(map[string]string)
+		}
+		dec.borderStyle[name[len("border_"):len(name)-len("_style")]] = style
+		return nil
+	default:
+		return nil
+	}
+	c, err := fd.resolveColor(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*col = c
+	return nil
+}
+
+// applyTableSettings sets the inherited attributes on the cells of the table
+// and returns the decorations of the cells.
+func (fd *frontendDocument) applyTableSettings(t *Table) (map[*frontend.TableCell]*cellDecoration, error) {
+	decorations := make(map[*frontend.TableCell]*cellDecoration)
+	// the attributes set on the rows and the cells
+	rowSettings := make(map[*frontend.TableRow]tableSettings)
+	cellSettings := make(map[*frontend.TableCell]tableSettings)
+	for _, tr := range t.rows {
+		rowSettings[tr.Value] = tr.settings
+		for _, td := range tr.cells {
+			cellSettings[td.Value] = td.settings
+		}
+	}
+	rows := t.Value.Rows
+	for i, row := range rows {
+		levels := []tableSettings{t.defaults}
+		// the stripes start with the first body row
+		if body := i - t.headerRows; len(t.stripes) > 0 && body >= 0 && i < len(rows)-t.footerRows {
+			levels = append(levels, tableSettings{"background_color": t.stripes[body%len(t.stripes)]})
+		}
+		levels = append(levels, rowSettings[row])
+		for _, cell := range row.Cells {
+			dec := &cellDecoration{}
+			for _, ts := range append(levels[:len(levels):len(levels)], cellSettings[cell]) {
+				for _, k := range ts.keys() {
+					if err := setCellAttr(cell, k, ts[k]); err != nil {
+						return nil, err
+					}
+					if err := fd.setCellDecoration(cell, dec, k, ts[k]); err != nil {
+						return nil, err
+					}
+				}
+			}
+			decorations[cell] = dec
+		}
+	}
+	return decorations, nil
+}
+
+// decorateTable draws the cell backgrounds and the border styles into the
+// table built by the library. The rows and the cells are the direct children
+// of the table and of the rows.
+func decorateTable(vl *node.VList, tbl *frontend.Table, decorations map[*frontend.TableCell]*cellDecoration) error {
+	rowNumber := 0
+	for e := vl.List; e != nil; e = e.Next() {
+		hl, ok := e.(*node.HList)
+		if !ok || hl.Attributes["origin"] != "table row" || rowNumber >= len(tbl.Rows) {
+			continue
+		}
+		cells := tbl.Rows[rowNumber].Cells
+		rowNumber++
+		cellNumber := 0
+		for c := hl.List; c != nil; c = c.Next() {
+			td, ok := c.(*node.VList)
+			if !ok || td.Attributes["origin"] != "td" || cellNumber >= len(cells) {
+				continue
+			}
+			cell := cells[cellNumber]
+			cellNumber++
+			if dec := decorations[cell]; dec != nil {
+				if err := decorateCell(td, cell, dec); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// decorateCell draws the background of the cell and restyles the borders.
+func decorateCell(td *node.VList, cell *frontend.TableCell, dec *cellDecoration) error {
+	for e := td.List; e != nil; e = e.Next() {
+		switch t := e.(type) {
+		case *node.Rule:
+			switch t.Attributes["origin"] {
+			case "top rule":
+				styleBorder(t, dec.borderStyle["top"], cell.BorderTopColor, true)
+			case "bottom rule":
+				styleBorder(t, dec.borderStyle["bottom"], cell.BorderBottomColor, true)
+			}
+		case *node.HList:
+			for r := t.List; r != nil; r = r.Next() {
+				if rule, ok := r.(*node.Rule); ok {
+					switch rule.Attributes["origin"] {
+					case "left rule":
+						styleBorder(rule, dec.borderStyle["left"], cell.BorderLeftColor, false)
+					case "right rule":
+						styleBorder(rule, dec.borderStyle["right"], cell.BorderRightColor, false)
+					}
+				}
+			}
+		}
+	}
+	if dec.drawing != nil {
+		bg, err := dec.drawing.Background(td.Width, td.Height+td.Depth)
+		if err != nil {
+			return fmt.Errorf("background: %w", err)
+		}
+		td.List = node.InsertBefore(td.List, td.List, bg)
+	}
+	if dec.background != nil {
+		// an invisible rule at the top of the cell which draws the background
+		// before the contents
+		bg := node.NewRule()
+		bg.Hide = true
+		bg.Pre = pdfdraw.New().Save().ColorNonstroking(*dec.background).Rect(0, 0, td.Width, -td.Height-td.Depth).Fill().Restore().String()
+		bg.Attributes = node.H{"origin": "cell background"}
+		td.List = node.InsertBefore(td.List, td.List, bg)
+	}
+	return nil
+}
+
+// styleBorder replaces the filled border rule by a dashed or dotted line.
+// Horizontal rules are in the cell vlist and are drawn downwards from the
+// origin, vertical rules are in an hlist and are drawn upwards.
+func styleBorder(r *node.Rule, style string, col *color.Color, horizontal bool) {
+	switch style {
+	case "", "solid":
+		return
+	case "none":
+		r.Hide = true
+		r.Pre, r.Post = "", ""
+		return
+	}
+	pd := pdfdraw.New().Save()
+	if col != nil {
+		pd.ColorStroking(*col)
+	}
+	thickness := r.Width
+	if horizontal {
+		thickness = r.Height + r.Depth
+	}
+	pd.LineWidth(thickness)
+	if style == "dotted" {
+		pd.Literal(fmt.Sprintf("1 J [0 %s] 0 d", 2*thickness))
+	} else {
+		dash := max(3*thickness, bag.MustSP("2pt"))
+		pd.Literal(fmt.Sprintf("[%s %s] 0 d", dash, dash*2/3))
+	}
+	if horizontal {
+		pd.Moveto(0, -thickness/2).Lineto(r.Width, -thickness/2)
+	} else {
+		pd.Moveto(r.Width/2, -r.Depth).Lineto(r.Width/2, r.Height)
+	}
+	r.Pre = pd.Stroke().Restore().String()
+	r.Post = ""
+	r.Hide = true
+}
@@ -37,6 +37,11 @@ func (txt *text) GetAttr(name string) (object.Object, bool) {
 	switch name {
 	case "settings":
 		return &settings{txt: txt.Value}, true
+	case "class":
+		if name := styleName(txt.Value); name != "" {
+			return object.NewString(name), true
+		}
+		return object.Nil, true
 	}
 	return nil, false
 }
@@ -62,8 +67,27 @@ func (txt *text) SetAttr(name string, value object.Object) error {
 		default:
 			// fmt.Println("~~> not a list")
 		}
+	case "class":
+		if value == object.Nil {
+			setStyleName(txt.Value, "")
+			return nil
+		}
+		name, err := object.AsString(value)
+		if err != nil {
+			return err.Value()
+		}
+		setStyleName(txt.Value, name)
+		return nil
 	case "settings":
-		// fmt.Println("~~> SetAttr/settings")
+		// the new settings are checked before the old ones are replaced, the
+		// class is kept
+		s := &settings{txt: frontend.NewText()}
+		if err := s.Update(value); err != nil {
+			return err.Value()
+		}
+		setStyleName(s.txt, styleName(txt.Value))
+		txt.Value.Settings = s.txt.Settings
+		return nil
 	}
 	return object.Errorf("cannot set attribute %s on text", name)
 }
@@ -4,9 +4,7 @@ import (
 	"context"
 	"sort"
 
-	"github.com/boxesandglue/boxesandglue/backend/bag"
 	"github.com/boxesandglue/boxesandglue/frontend"
-	rcolor "github.com/boxesandglue/cli/risor/backend/color"
 	"github.com/risor-io/risor/object"
 	"github.com/risor-io/risor/op"
 )
@@ -18,111 +16,17 @@ type settings struct {
 }
 
 func settingTostring(s frontend.SettingType) string {
+	if def, ok := settingDefs[s]; ok {
+		return def.name
+	}
 	return s.String()
 }
 
 func stringToSetting(s string) frontend.SettingType {
-	switch s {
-	case "backgroundcolor":
-		return frontend.SettingBackgroundColor
-	case "borderbottomcolor":
-		return frontend.SettingBorderBottomColor
-	case "borderbottomleftradius":
-		return frontend.SettingBorderBottomLeftRadius
-	case "borderbottomrightradius":
-		return frontend.SettingBorderBottomRightRadius
-	case "borderbottomstyle":
-		return frontend.SettingBorderBottomStyle
-	case "borderbottomwidth":
-		return frontend.SettingBorderBottomWidth
-	case "borderleftcolor":
-		return frontend.SettingBorderLeftColor
-	case "borderleftstyle":
-		return frontend.SettingBorderLeftStyle
-	case "borderleftwidth":
-		return frontend.SettingBorderLeftWidth
-	case "borderrightcolor":
-		return frontend.SettingBorderRightColor
-	case "borderrightstyle":
-		return frontend.SettingBorderRightStyle
-	case "borderrightwidth":
-		return frontend.SettingBorderRightWidth
-	case "bordertopcolor":
-		return frontend.SettingBorderTopColor
-	case "bordertopleftradius":
-		return frontend.SettingBorderTopLeftRadius
-	case "bordertoprightradius":
-		return frontend.SettingBorderTopRightRadius
-	case "bordertopstyle":
-		return frontend.SettingBorderTopStyle
-	case "bordertopwidth":
-		return frontend.SettingBorderTopWidth
-	case "box":
-		return frontend.SettingBox
-	case "color":
-		return frontend.SettingColor
-	case "debug":
-		return frontend.SettingDebug
-	case "fontexpansion":
-		return frontend.SettingFontExpansion
-	case "fontfamily":
-		return frontend.SettingFontFamily
-	case "fontweight":
-		return frontend.SettingFontWeight
-	case "halign":
-		return frontend.SettingHAlign
-	case "hangingpunctuation":
-		return frontend.SettingHangingPunctuation
-	case "height":
-		return frontend.SettingHeight
-	case "hyperlink":
-		return frontend.SettingHyperlink
-	case "indentleft":
-		return frontend.SettingIndentLeft
-	case "indentleftrows":
-		return frontend.SettingIndentLeftRows
-	case "leading":
-		return frontend.SettingLeading
-	case "marginbottom":
-		return frontend.SettingMarginBottom
-	case "marginleft":
-		return frontend.SettingMarginLeft
-	case "marginright":
-		return frontend.SettingMarginRight
-	case "margintop":
-		return frontend.SettingMarginTop
-	case "opentypefeature":
-		return frontend.SettingOpenTypeFeature
-	case "paddingbottom":
-		return frontend.SettingPaddingBottom
-	case "paddingleft":
-		return frontend.SettingPaddingLeft
-	case "paddingright":
-		return frontend.SettingPaddingRight
-	case "paddingtop":
-		return frontend.SettingPaddingTop
-	case "prepend":
-		return frontend.SettingPrepend
-	case "preservewhitespace":
-		return frontend.SettingPreserveWhitespace
-	case "size":
-		return frontend.SettingSize
-	case "style":
-		return frontend.SettingStyle
-	case "tabsize":
-		return frontend.SettingTabSize
-	case "tabsizespaces":
-		return frontend.SettingTabSizeSpaces
-	case "textdecorationline":
-		return frontend.SettingTextDecorationLine
-	case "valign":
-		return frontend.SettingVAlign
-	case "width":
-		return frontend.SettingWidth
-	case "yoffset":
-		return frontend.SettingYOffset
+	if st, ok := settingNames[s]; ok {
+		return st
 	}
-	return frontend.SettingType(0)
+	return frontend.SettingDummy
 }
 
 func AsSettings(obj object.Object) (*settings, *object.Error) {
@@ -145,13 +49,23 @@ func (m *settings) String() string {
 	return m.Inspect()
 }
 
+// Value returns the settings as a map. The style name of the text is not
+// part of the settings.
 func (m *settings) Value() map[string]object.Object {
-	// FIXME: this is a hack to make the settings work with the frontend
-	return map[string]object.Object{}
+	result := make(map[string]object.Object, len(m.txt.Settings))
+	for k, v := range m.txt.Settings {
+		if k == settingStyle {
+			continue
+		}
+		result[settingTostring(k)] = settingToRisor(k, v)
+	}
+	return result
 }
 
 func (m *settings) SetAttr(name string, value object.Object) error {
-	bag.Logger.Error("Unhandled function", "function", "SetAttr", "where", "textsettings.go")
+	if err := m.SetItem(object.NewString(name), value); err != nil {
+		return err.Value()
+	}
 	return nil
 }
 
@@ -176,7 +90,14 @@ func (m *settings) GetAttr(name string) (object.Object, bool) {
 			if len(args) < 1 || len(args) > 2 {
 				return object.NewArgsRangeError("map.get", 1, 2, len(args))
 			}
-			return object.NewString("settings/get")
+			key, err := object.AsString(args[0])
+			if err != nil {
+				return err
+			}
+			if len(args) == 2 {
+				return m.GetWithDefault(key, args[1])
+			}
+			return m.Get(key)
 		}), true
 	case "clear":
 		return object.NewBuiltin("map.clear", func(ctx context.Context, args ...object.Object) object.Object {
@@ -232,50 +153,94 @@ func (m *settings) GetAttr(name string) (object.Object, bool) {
 			if len(args) != 1 {
 				return object.NewArgsError("map.update", 1, len(args))
 			}
-			other, err := AsSettings(args[0])
-			if err != nil {
+			if err := m.Update(args[0]); err != nil {
 				return err
 			}
-			m.Update(other)
 			return m
 		}), true
 	}
-	return object.NewString("settings/default get"), true
-	// o, ok := m.items[name]
-	// return o, ok
+	if st := stringToSetting(name); st != frontend.SettingDummy {
+		return m.Get(name), true
+	}
+	return nil, false
 }
 
 func (m *settings) ListItems() *object.List {
-	bag.Logger.Error("Unhandled function", "function", "ListItems", "where", "textsettings.go")
-	return object.NewList(nil)
+	items := make([]object.Object, 0, len(m.txt.Settings))
+	for _, k := range m.SortedKeys() {
+		items = append(items, object.NewList([]object.Object{object.NewString(k), m.Get(k)}))
+	}
+	return object.NewList(items)
 }
 
 func (m *settings) Clear() {
+	name := styleName(m.txt)
 	m.txt.Settings = frontend.TypesettingSettings{}
+	setStyleName(m.txt, name)
 }
 
-func (m *settings) Copy() *settings {
-	bag.Logger.Error("Unhandled function", "function", "Copy", "where", "textsettings.go")
-	return &settings{}
+// Copy returns a risor map with the settings. The map can be assigned to the
+// settings of another text.
+func (m *settings) Copy() *object.Map {
+	return object.NewMap(m.Value())
 }
 
 func (m *settings) Pop(key string, def object.Object) object.Object {
-	bag.Logger.Error("Unhandled function", "function", "Pop", "where", "textsettings.go")
+	st := stringToSetting(key)
+	if v, found := m.txt.Settings[st]; found {
+		delete(m.txt.Settings, st)
+		return settingToRisor(st, v)
+	}
+	if def != nil {
+		return def
+	}
 	return object.Nil
 }
 
 func (m *settings) SetDefault(key string, value object.Object) object.Object {
-	bag.Logger.Error("Unhandled function", "function", "SetDefault", "where", "textsettings.go")
-	return object.Nil
+	st := stringToSetting(key)
+	if _, found := m.txt.Settings[st]; !found {
+		if err := m.SetItem(object.NewString(key), value); err != nil {
+			return err
+		}
+	}
+	return m.Get(key)
 }
 
-func (m *settings) Update(other *settings) {
-	bag.Logger.Error("Unhandled function", "function", "Update", "where", "textsettings.go")
+// Update sets all settings from other, which can be a map or a settings
+// object. Nothing is changed if one of the values is invalid.
+func (m *settings) Update(other object.Object) *object.Error {
+	switch t := other.(type) {
+	case *settings:
+		for k, v := range t.txt.Settings {
+			if k != settingStyle {
+				m.txt.Settings[k] = v
+			}
+		}
+		return nil
+	case *object.Map:
+		values := make(frontend.TypesettingSettings, t.Size())
+		for _, k := range t.SortedKeys() {
+			st, v, err := convertSetting(k, t.Get(k))
+			if err != nil {
+				return object.TypeErrorf("type error: %s", err)
+			}
+			values[st] = v
+		}
+		for k, v := range values {
+			m.txt.Settings[k] = v
+		}
+		return nil
+	}
+	return object.TypeErrorf("type error: expected a map (%s given)", other.Type())
 }
 
 func (m *settings) SortedKeys() []string {
-	keys := make([]string, 0, len(m.txt.Items))
+	keys := make([]string, 0, len(m.txt.Settings))
 	for k := range m.txt.Settings {
+		if k == settingStyle {
+			continue
+		}
 		keys = append(keys, settingTostring(k))
 	}
 	sort.Strings(keys)
@@ -292,43 +257,50 @@ func (m *settings) Keys() *object.List {
 }
 
 func (m *settings) Values() *object.List {
-	// bag.Logger.Error("Unhandled function", "function", "Values","where", "textsettings.go")
-	l := object.NewList(nil)
-	return l
+	items := make([]object.Object, 0, len(m.txt.Settings))
+	for _, k := range m.SortedKeys() {
+		items = append(items, m.Get(k))
+	}
+	return object.NewList(items)
 }
 
 func (m *settings) GetWithObject(key *object.String) object.Object {
-	value, found := m.txt.Settings[stringToSetting(key.String())]
-	if !found {
-		return object.Nil
-	}
-
-	return object.NewInt(int64(value.(frontend.SettingType)))
+	return m.Get(key.Value())
 }
 
 func (m *settings) Get(key string) object.Object {
-	bag.Logger.Error("Unhandled function", "function", "Get", "where", "textsettings.go")
-	return object.Nil
+	return m.GetWithDefault(key, object.Nil)
 }
 
 func (m *settings) GetWithDefault(key string, defaultValue object.Object) object.Object {
-	bag.Logger.Error("Unhandled function", "function", "GetWithDefault", "where", "textsettings.go")
-	return nil
+	st := stringToSetting(key)
+	value, found := m.txt.Settings[st]
+	if !found {
+		return defaultValue
+	}
+	return settingToRisor(st, value)
 }
 
 func (m *settings) Delete(key string) object.Object {
+	delete(m.txt.Settings, stringToSetting(key))
 	return object.Nil
 }
 
 func (m *settings) Interface() any {
 	result := make(map[string]any, len(m.txt.Settings))
 	for k, v := range m.txt.Settings {
+		if k == settingStyle {
+			continue
+		}
 		result[settingTostring(k)] = v
 	}
 	return result
 }
 
 func (m *settings) Equals(other object.Object) object.Object {
+	if o, ok := other.(*settings); ok {
+		return object.NewBool(m.txt == o.txt)
+	}
 	return object.False
 }
 
@@ -337,8 +309,16 @@ func (m *settings) RunOperation(opType op.BinaryOpType, right object.Object) obj
 }
 
 func (m *settings) GetItem(key object.Object) (object.Object, *object.Error) {
-	bag.Logger.Error("Unhandled function", "function", "GetItem", "where", "textsettings.go")
-	return object.Nil, nil
+	strObj, ok := key.(*object.String)
+	if !ok {
+		return nil, object.TypeErrorf("type error: map key must be a string (got %s)", key.Type())
+	}
+	st := stringToSetting(strObj.Value())
+	value, found := m.txt.Settings[st]
+	if !found {
+		return nil, object.Errorf("key error: %q", strObj.Value())
+	}
+	return settingToRisor(st, value), nil
 }
 
 // GetSlice implements the [start:stop] operator for a container type.
@@ -346,110 +326,60 @@ func (m *settings) GetSlice(s object.Slice) (object.Object, *object.Error) {
 	return nil, object.TypeErrorf("map does not support slice operations")
 }
 
-// SetItem assigns a value to the given key in the map.
+// SetItem assigns a value to the given key in the map. The value is checked
+// and converted to the type the setting requires.
 func (m *settings) SetItem(key, value object.Object) *object.Error {
 	strObj, ok := key.(*object.String)
 	if !ok {
 		return object.TypeErrorf("type error: map key must be a string (got %s)", key.Type())
 	}
-	switch strObj.String() {
-	case "backgroundcolor":
-		if value.Type() == rcolor.BackendColorType {
-			v := value.(*rcolor.RColor).Value
-			m.txt.Settings[frontend.SettingBackgroundColor] = v
-		}
-	case "color":
-		if value.Type() == rcolor.BackendColorType {
-			v := value.(*rcolor.RColor).Value
-			m.txt.Settings[frontend.SettingColor] = v
-		}
-	case "fontfamily":
-		m.txt.Settings[frontend.SettingFontFamily] = value.(*FontFamily).Value
-	case "halign":
-		switch value.(*object.String).String() {
-		case "left":
-			m.txt.Settings[frontend.SettingHAlign] = frontend.HAlignLeft
-		case "center":
-			m.txt.Settings[frontend.SettingHAlign] = frontend.HAlignCenter
-		case "right":
-			m.txt.Settings[frontend.SettingHAlign] = frontend.HAlignRight
-		case "justify":
-			m.txt.Settings[frontend.SettingHAlign] = frontend.HAlignJustified
-		default:
-			return object.TypeErrorf("type error: invalid value for SettingHAlign: %T", value)
-		}
-	case "fontexpansion":
-		switch value.Type() {
-		case object.FLOAT:
-			// Convert the float value to a font expansion
-			m.txt.Settings[frontend.SettingFontExpansion] = value.(*object.Float).Value()
-		}
-	case "fontstyle":
-		switch value.Type() {
-		case object.STRING:
-			// Convert the string value to a font style
-			switch value.(*object.String).String() {
-			case "normal":
-				m.txt.Settings[frontend.SettingStyle] = frontend.FontStyleNormal
-			case "italic":
-				m.txt.Settings[frontend.SettingStyle] = frontend.FontStyleItalic
-			case "oblique":
-				m.txt.Settings[frontend.SettingStyle] = frontend.FontStyleOblique
-			default:
-				return object.TypeErrorf("type error: invalid value for SettingStyle: %s", value.(*object.String).String())
-			}
-		}
-	case "fontweight":
-		switch value.Type() {
-		case object.INT:
-			// Convert the int value to a font weight
-			m.txt.Settings[frontend.SettingFontWeight] = int(value.(*object.Int).Value())
-		case object.STRING:
-			switch value.(*object.String).String() {
-			case "normal":
-				m.txt.Settings[frontend.SettingFontWeight] = frontend.FontWeight400
-			case "bold":
-				m.txt.Settings[frontend.SettingFontWeight] = frontend.FontWeight700
-			}
-		}
-	case "hangingpunctuation":
-		switch value.Type() {
-		case object.BOOL:
-			// Convert the bool value to a hanging punctuation setting
-			hp := value.(*object.Bool).Value()
-			if hp {
-				m.txt.Settings[frontend.SettingHangingPunctuation] = frontend.HangingPunctuation(1)
-			}
-		}
-	default:
-		bag.Logger.Error("Unhandled setting", "value", strObj.String())
+	st, v, err := convertSetting(strObj.Value(), value)
+	if err != nil {
+		return object.TypeErrorf("type error: %s", err)
 	}
+	m.txt.Settings[st] = v
 	return nil
 }
 
 // DelItem deletes the item with the given key from the map.
 func (m *settings) DelItem(key object.Object) *object.Error {
-	bag.Logger.Error("Unhandled function", "function", "DelItem", "where", "textsettings.go")
+	strObj, ok := key.(*object.String)
+	if !ok {
+		return object.TypeErrorf("type error: map key must be a string (got %s)", key.Type())
+	}
+	m.Delete(strObj.Value())
 	return nil
 }
 
 // Contains returns true if the given item is found in this container.
 func (m *settings) Contains(key object.Object) *object.Bool {
-	bag.Logger.Error("Unhandled function", "function", "Contains", "where", "textsettings.go")
-	return object.False
+	strObj, ok := key.(*object.String)
+	if !ok {
+		return object.False
+	}
+	_, found := m.txt.Settings[stringToSetting(strObj.Value())]
+	return object.NewBool(found)
 }
 
 func (m *settings) IsTruthy() bool {
-	return len(m.txt.Settings) > 0
+	return m.size() > 0
 }
 
 // Len returns the number of items in this container.
 func (m *settings) Len() *object.Int {
-	return object.NewInt(int64(len(m.txt.Settings)))
+	return object.NewInt(int64(m.size()))
+}
+
+// size returns the number of settings without the style name.
+func (m *settings) size() int {
+	if _, ok := m.txt.Settings[settingStyle]; ok {
+		return len(m.txt.Settings) - 1
+	}
+	return len(m.txt.Settings)
 }
 
 func (m *settings) Iter() object.Iterator {
-	return nil
+	return object.NewMapIter(object.NewMap(m.Value()))
 }
 
 func (m *settings) Cost() int {
@@ -0,0 +1,143 @@
+// Package pdfpage writes one page PDF files with transparency and shading
+// resources. The page resources of the PDF writer only have fonts, images and
+// color spaces, so drawings and SVG images that need ExtGState or Shading
+// resources are written to a separate PDF file and loaded as an image. The
+// files are stored in the user's cache directory, see Cached.
+package pdfpage
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pdf "github.com/boxesandglue/baseline-pdf"
+)
+
+// Page is the content of a one page PDF file. The content stream refers to
+// the ExtGState resources as /GS1, /GS2, ... and to the Shading resources as
+// /Sh1, /Sh2, ...
+type Page struct {
+	// Width and Height are the size of the page in PDF points.
+	Width, Height float64
+	Content       []byte
+	ExtGStates    []string
+	Shadings      []string
+}
+
+// Write writes the page as a PDF file.
+func (p *Page) Write(w io.Writer) error {
+	pw := pdf.NewPDFWriter(w)
+	pw.DefaultPageWidth = p.Width
+	pw.DefaultPageHeight = p.Height
+	content := pw.NewObject()
+	content.SetCompression(9)
+	content.Data.Write(p.Content)
+	page := pw.AddPage(content, 0)
+	resources := pdf.Dict{}
+	addResources := func(key, prefix string, list []string) {
+		if len(list) == 0 {
+			return
+		}
+		d := pdf.Dict{}
+		for i, dict := range list {
+			d[pdf.Name(fmt.Sprintf("%s%d", prefix, i+1))] = dict
+		}
+		resources[pdf.Name(key)] = d
+	}
+	addResources("ExtGState", "GS", p.ExtGStates)
+	addResources("Shading", "Sh", p.Shadings)
+	page.Dict = pdf.Dict{"Resources": resources}
+	return pw.Finish()
+}
+
+// CacheDir returns the directory with the given name in the user's cache
+// directory.
+func CacheDir(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "boxesandglue", name)
+}
+
+// Cached returns the name of the PDF file for key in the directory dir. If the
+// file does not exist, it is created with write. The key must change when
+// the contents of the file change.
+func Cached(dir, key string, write func(w io.Writer) error) (string, error) {
+	filename := filepath.Join(dir, key+".pdf")
+	if _, err := os.Stat(filename); err == nil {
+		return filename, nil
+	}
+	if err := WriteFile(filename, write); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// WriteFile creates the file and its directory with write. The contents are
+// written to a temporary file first, so no incomplete file is found in the
+// cache.
+func WriteFile(filename string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if err = write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Stop is a color stop of a gradient. Offset is between 0 and 1 and Color has
+// the color values in the color space of the shading, such as "1 0 0".
+type Stop struct {
+	Offset float64
+	Color  string
+}
+
+// GradientFunction returns the PDF function for the color stops, which must
+// be in increasing order. There must be at least one stop. The colors of the
+// first and the last stop continue to the ends.
+func GradientFunction(stops []Stop) string {
+	if first := stops[0]; first.Offset > 0 {
+		stops = append([]Stop{{Offset: 0, Color: first.Color}}, stops...)
+	}
+	if last := stops[len(stops)-1]; last.Offset < 1 {
+		stops = append(stops, Stop{Offset: 1, Color: last.Color})
+	}
+	functions := make([]string, 0, len(stops)-1)
+	for i := 0; i < len(stops)-1; i++ {
+		functions = append(functions, fmt.Sprintf("<< /FunctionType 2 /Domain [0 1] /C0 [%s] /C1 [%s] /N 1 >>", stops[i].Color, stops[i+1].Color))
+	}
+	if len(functions) == 1 {
+		return functions[0]
+	}
+	bounds := make([]string, 0, len(stops)-2)
+	encode := make([]string, 0, len(functions))
+	for i := 1; i < len(stops)-1; i++ {
+		bounds = append(bounds, strconv.FormatFloat(math.Round(stops[i].Offset*100000)/100000, 'f', -1, 64))
+	}
+	for range functions {
+		encode = append(encode, "0 1")
+	}
+	return fmt.Sprintf("<< /FunctionType 3 /Domain [0 1] /Functions [%s] /Bounds [%s] /Encode [%s] >>",
+		strings.Join(functions, " "), strings.Join(bounds, " "), strings.Join(encode, " "))
+}
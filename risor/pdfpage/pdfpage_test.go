@@ -0,0 +1,57 @@
+package pdfpage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGradientFunction(t *testing.T) {
+	testdata := []struct {
+		stops []Stop
+		want  string
+	}{
+		{[]Stop{{0, "1 0 0"}, {1, "0 0 1"}}, "<< /FunctionType 2 /Domain [0 1] /C0 [1 0 0] /C1 [0 0 1] /N 1 >>"},
+		{[]Stop{{0, "0"}, {0.25, "0.5"}, {1, "1"}}, "<< /FunctionType 3 /Domain [0 1] /Functions [<< /FunctionType 2 /Domain [0 1] /C0 [0] /C1 [0.5] /N 1 >> << /FunctionType 2 /Domain [0 1] /C0 [0.5] /C1 [1] /N 1 >>] /Bounds [0.25] /Encode [0 1 0 1] >>"},
+		// the colors continue to the ends
+		{[]Stop{{0.5, "1"}}, "<< /FunctionType 3 /Domain [0 1] /Functions [<< /FunctionType 2 /Domain [0 1] /C0 [1] /C1 [1] /N 1 >> << /FunctionType 2 /Domain [0 1] /C0 [1] /C1 [1] /N 1 >>] /Bounds [0.5] /Encode [0 1 0 1] >>"},
+	}
+	for _, td := range testdata {
+		if got := GradientFunction(td.stops); got != td.want {
+			t.Errorf("GradientFunction(%v) = %s, want %s", td.stops, got, td.want)
+		}
+	}
+}
+
+func TestCached(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	calls := 0
+	write := func(w io.Writer) error {
+		calls++
+		p := &Page{Width: 10, Height: 20, Content: []byte("/GS1 gs 0 0 10 20 re f"), ExtGStates: []string{"<< /ca 0.5 >>"}}
+		return p.Write(w)
+	}
+	filename, err := Cached(dir, "abc", write)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != filepath.Join(dir, "abc.pdf") {
+		t.Errorf("file name %s, want abc.pdf in %s", filename, dir)
+	}
+	if again, err := Cached(dir, "abc", write); err != nil || again != filename || calls != 1 {
+		t.Errorf("second call: %s, %v, %d writes, want %s and one write", again, err, calls, filename)
+	}
+	// a failed write leaves no file in the cache
+	if _, err = Cached(dir, "failed", func(w io.Writer) error { return errors.New("failed") }); err == nil {
+		t.Error("Cached returns no error for a failed write")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "abc.pdf" {
+		t.Errorf("the cache has %d files, want only abc.pdf", len(entries))
+	}
+}
@@ -0,0 +1,173 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/cli/risor/pdfpage"
+)
+
+// maxHrefDepth limits the chain of gradients that reference each other.
+const maxHrefDepth = 10
+
+// gradientStop is a color at a position between 0 and 1 of a gradient.
+type gradientStop struct {
+	offset float64
+	col    rgb
+}
+
+// gradientChain returns the gradient and the gradients it references with
+// href.
+func (c *converter) gradientChain(el *element) []*element {
+	chain := []*element{el}
+	for len(chain) < maxHrefDepth {
+		ref := c.ids[strings.TrimPrefix(chain[len(chain)-1].attrs["href"], "#")]
+		if ref == nil || (ref.name != "linearGradient" && ref.name != "radialGradient") {
+			break
+		}
+		chain = append(chain, ref)
+	}
+	return chain
+}
+
+// gradientAttr returns the attribute of the gradient, which is inherited from
+// referenced gradients.
+func (c *converter) gradientAttr(el *element, name string) (string, bool) {
+	for _, g := range c.gradientChain(el) {
+		if v, ok := g.attrs[name]; ok {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
+
+// gradientStops returns the color stops of the gradient. The stops of the
+// first gradient in the href chain that has stops are used.
+func (c *converter) gradientStops(el *element, st *style) []gradientStop {
+	var stops []gradientStop
+	for _, g := range c.gradientChain(el) {
+		for _, child := range g.children {
+			if child.name != "stop" {
+				continue
+			}
+			props := c.properties(child)
+			offset := parseOpacity(strings.TrimSpace(child.attrs["offset"]), 0)
+			if len(stops) > 0 {
+				offset = math.Max(offset, stops[len(stops)-1].offset)
+			}
+			col := rgb{}
+			switch v := props["stop-color"]; v {
+			case "currentColor", "currentcolor":
+				col = st.color
+			default:
+				if cl, ok := parseColor(v); ok {
+					col = cl
+				}
+			}
+			if o, ok := props["stop-opacity"]; ok && parseOpacity(o, 1) < 1 {
+				c.warn("the opacity of gradient stops is ignored")
+			}
+			stops = append(stops, gradientStop{offset: offset, col: col})
+		}
+		if len(stops) > 0 {
+			break
+		}
+	}
+	return stops
+}
+
+// gradientFunction returns the PDF function for the color stops.
+func gradientFunction(stops []gradientStop) string {
+	pstops := make([]pdfpage.Stop, len(stops))
+	for i, st := range stops {
+		pstops[i] = pdfpage.Stop{Offset: st.offset, Color: st.col.String()}
+	}
+	return pdfpage.GradientFunction(pstops)
+}
+
+// fraction parses a number or a percentage for gradients in object bounding
+// box units.
+func fraction(s string, def float64) float64 {
+	pct := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return def
+	}
+	if pct {
+		f /= 100
+	}
+	return f
+}
+
+// gradientFill fills the path with the gradient.
+func (c *converter) gradientFill(el *element, pb *pathBuilder, evenOdd bool, st *style) {
+	stops := c.gradientStops(el, st)
+	switch len(stops) {
+	case 0:
+		return
+	case 1:
+		op := "f"
+		if evenOdd {
+			op = "f*"
+		}
+		c.printf("%s rg %s %s", stops[0].col, pb, op)
+		return
+	}
+	userSpace := false
+	if units, _ := c.gradientAttr(el, "gradientUnits"); units == "userSpaceOnUse" {
+		userSpace = true
+	}
+	if method, _ := c.gradientAttr(el, "spreadMethod"); method == "reflect" || method == "repeat" {
+		c.warn("the spread method " + method + " is not supported")
+	}
+	// coord returns a coordinate of the gradient. ref is the viewport size for
+	// percentages in user space.
+	coord := func(name, def string, ref float64) float64 {
+		v, ok := c.gradientAttr(el, name)
+		if !ok {
+			v = def
+		}
+		if userSpace {
+			return c.length(v, ref, 0)
+		}
+		return fraction(v, 0)
+	}
+	w, h, diag := c.vpWidth, c.vpHeight, c.diagonal()
+	var shading string
+	if el.name == "linearGradient" {
+		shading = fmt.Sprintf("<< /ShadingType 2 /ColorSpace /DeviceRGB /Coords [%s %s %s %s] /Function %s /Extend [true true] >>",
+			num(coord("x1", "0%", w)), num(coord("y1", "0%", h)), num(coord("x2", "100%", w)), num(coord("y2", "0%", h)),
+			gradientFunction(stops))
+	} else {
+		cx, cy, r := coord("cx", "50%", w), coord("cy", "50%", h), coord("r", "50%", diag)
+		fx, fy := cx, cy
+		if _, ok := c.gradientAttr(el, "fx"); ok {
+			fx = coord("fx", "50%", w)
+		}
+		if _, ok := c.gradientAttr(el, "fy"); ok {
+			fy = coord("fy", "50%", h)
+		}
+		fr := coord("fr", "0%", diag)
+		shading = fmt.Sprintf("<< /ShadingType 3 /ColorSpace /DeviceRGB /Coords [%s %s %s %s %s %s] /Function %s /Extend [true true] >>",
+			num(fx), num(fy), num(fr), num(cx), num(cy), num(r), gradientFunction(stops))
+	}
+	clip := "W n"
+	if evenOdd {
+		clip = "W* n"
+	}
+	c.printf("q %s %s", pb, clip)
+	if !userSpace {
+		bw, bh := pb.maxX-pb.minX, pb.maxY-pb.minY
+		if bw <= 0 || bh <= 0 {
+			c.printf("Q")
+			return
+		}
+		c.printf("%s", matrix{bw, 0, 0, bh, pb.minX, pb.minY})
+	}
+	if t, ok := c.gradientAttr(el, "gradientTransform"); ok {
+		c.printf("%s", parseTransform(t))
+	}
+	c.printf("/Sh%d sh Q", resource(&c.shadings, shading))
+}
@@ -0,0 +1,504 @@
+package svg
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matrix is a transformation matrix [a b c d e f] as in PDF.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the matrix that applies m first and then n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// apply returns the transformed point.
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+func (m matrix) String() string {
+	return num(m[0]) + " " + num(m[1]) + " " + num(m[2]) + " " + num(m[3]) + " " + num(m[4]) + " " + num(m[5]) + " cm"
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10000)/10000+0, 'f', -1, 64)
+}
+
+var transformRE = regexp.MustCompile(`([a-zA-Z]+)\s*\(([^)]*)\)`)
+
+// parseTransform parses the value of a transform attribute.
+func parseTransform(s string) matrix {
+	m := identity
+	for _, match := range transformRE.FindAllStringSubmatch(s, -1) {
+		v := numbers(match[2])
+		var t matrix
+		switch {
+		case match[1] == "matrix" && len(v) == 6:
+			t = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+		case match[1] == "translate" && len(v) == 1:
+			t = matrix{1, 0, 0, 1, v[0], 0}
+		case match[1] == "translate" && len(v) == 2:
+			t = matrix{1, 0, 0, 1, v[0], v[1]}
+		case match[1] == "scale" && len(v) == 1:
+			t = matrix{v[0], 0, 0, v[0], 0, 0}
+		case match[1] == "scale" && len(v) == 2:
+			t = matrix{v[0], 0, 0, v[1], 0, 0}
+		case match[1] == "rotate" && (len(v) == 1 || len(v) == 3):
+			a := v[0] * math.Pi / 180
+			t = matrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}
+			if len(v) == 3 {
+				t = matrix{1, 0, 0, 1, -v[1], -v[2]}.mul(t).mul(matrix{1, 0, 0, 1, v[1], v[2]})
+			}
+		case match[1] == "skewX" && len(v) == 1:
+			t = matrix{1, 0, math.Tan(v[0] * math.Pi / 180), 1, 0, 0}
+		case match[1] == "skewY" && len(v) == 1:
+			t = matrix{1, math.Tan(v[0] * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			continue
+		}
+		// the last transformation in the list is applied first
+		m = t.mul(m)
+	}
+	return m
+}
+
+// pathParser reads numbers and commands from path data.
+type pathParser struct {
+	s   string
+	pos int
+}
+
+func (p *pathParser) skipSeparators() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n,", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// number reads the next number.
+func (p *pathParser) number() (float64, bool) {
+	p.skipSeparators()
+	start := p.pos
+	if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+		p.pos++
+	}
+	digits, dot := false, false
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c >= '0' && c <= '9' {
+			digits = true
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+		p.pos++
+	}
+	if !digits {
+		p.pos = start
+		return 0, false
+	}
+	if p.pos < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+		save := p.pos
+		p.pos++
+		if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+			p.pos++
+		}
+		expDigits := false
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+			expDigits = true
+		}
+		if !expDigits {
+			p.pos = save
+		}
+	}
+	f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return 0, false
+	}
+	return f, true
+}
+
+// flag reads an arc flag, which can be written without a separator.
+func (p *pathParser) flag() (bool, bool) {
+	p.skipSeparators()
+	if p.pos < len(p.s) && (p.s[p.pos] == '0' || p.s[p.pos] == '1') {
+		p.pos++
+		return p.s[p.pos-1] == '1', true
+	}
+	return false, false
+}
+
+// numbers reads n numbers.
+func (p *pathParser) numbers(n int) ([]float64, bool) {
+	ret := make([]float64, n)
+	for i := range n {
+		f, ok := p.number()
+		if !ok {
+			return nil, false
+		}
+		ret[i] = f
+	}
+	return ret, true
+}
+
+// command reads the next command letter.
+func (p *pathParser) command() (byte, bool) {
+	p.skipSeparators()
+	if p.pos < len(p.s) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *pathParser) done() bool {
+	p.skipSeparators()
+	return p.pos >= len(p.s)
+}
+
+// pathBuilder collects the PDF code of a path. The points are transformed by
+// m, the bounding box is in untransformed coordinates.
+type pathBuilder struct {
+	ops                    []string
+	m                      matrix
+	minX, minY, maxX, maxY float64
+	hasPoints              bool
+	// the current point and the start of the subpath
+	x, y, startX, startY float64
+}
+
+func newPathBuilder(m matrix) *pathBuilder {
+	return &pathBuilder{m: m}
+}
+
+func (pb *pathBuilder) point(x, y float64) string {
+	if !pb.hasPoints {
+		pb.minX, pb.minY, pb.maxX, pb.maxY = x, y, x, y
+		pb.hasPoints = true
+	} else {
+		pb.minX, pb.maxX = math.Min(pb.minX, x), math.Max(pb.maxX, x)
+		pb.minY, pb.maxY = math.Min(pb.minY, y), math.Max(pb.maxY, y)
+	}
+	tx, ty := pb.m.apply(x, y)
+	return num(tx) + " " + num(ty)
+}
+
+func (pb *pathBuilder) moveTo(x, y float64) {
+	pb.ops = append(pb.ops, pb.point(x, y)+" m")
+	pb.x, pb.y, pb.startX, pb.startY = x, y, x, y
+}
+
+func (pb *pathBuilder) lineTo(x, y float64) {
+	pb.ops = append(pb.ops, pb.point(x, y)+" l")
+	pb.x, pb.y = x, y
+}
+
+func (pb *pathBuilder) curveTo(x1, y1, x2, y2, x, y float64) {
+	pb.ops = append(pb.ops, pb.point(x1, y1)+" "+pb.point(x2, y2)+" "+pb.point(x, y)+" c")
+	pb.x, pb.y = x, y
+}
+
+func (pb *pathBuilder) closePath() {
+	pb.ops = append(pb.ops, "h")
+	pb.x, pb.y = pb.startX, pb.startY
+}
+
+func (pb *pathBuilder) String() string {
+	return strings.Join(pb.ops, " ")
+}
+
+// kappa is the distance of the control points for a quarter circle.
+const kappa = 0.5522847498
+
+// ellipse adds an ellipse around (cx, cy).
+func (pb *pathBuilder) ellipse(cx, cy, rx, ry float64) {
+	kx, ky := rx*kappa, ry*kappa
+	pb.moveTo(cx+rx, cy)
+	pb.curveTo(cx+rx, cy+ky, cx+kx, cy+ry, cx, cy+ry)
+	pb.curveTo(cx-kx, cy+ry, cx-rx, cy+ky, cx-rx, cy)
+	pb.curveTo(cx-rx, cy-ky, cx-kx, cy-ry, cx, cy-ry)
+	pb.curveTo(cx+kx, cy-ry, cx+rx, cy-ky, cx+rx, cy)
+	pb.closePath()
+}
+
+// arcTo adds an elliptical arc from the current point to (x, y) with the
+// parameters of the SVG arc command.
+func (pb *pathBuilder) arcTo(rx, ry, rotation float64, large, sweep bool, x, y float64) {
+	x0, y0 := pb.x, pb.y
+	if x0 == x && y0 == y {
+		return
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		pb.lineTo(x, y)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	// conversion from endpoint to center parameterization
+	dx, dy := (x0-x)/2, (y0-y)/2
+	x1p := cosPhi*dx + sinPhi*dy
+	y1p := -sinPhi*dx + cosPhi*dy
+	lambda := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry)
+	if lambda > 1 {
+		s := math.Sqrt(lambda)
+		rx, ry = rx*s, ry*s
+	}
+	numer := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := math.Sqrt(math.Max(0, numer/den))
+	if large == sweep {
+		coef = -coef
+	}
+	cxp := coef * rx * y1p / ry
+	cyp := -coef * ry * x1p / rx
+	cx := cosPhi*cxp - sinPhi*cyp + (x0+x)/2
+	cy := sinPhi*cxp + cosPhi*cyp + (y0+y)/2
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta1 := angle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	dtheta := angle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !sweep && dtheta > 0 {
+		dtheta -= 2 * math.Pi
+	} else if sweep && dtheta < 0 {
+		dtheta += 2 * math.Pi
+	}
+	// bezier segments of at most 90 degrees
+	segments := max(1, int(math.Ceil(math.Abs(dtheta)/(math.Pi/2)-1e-9)))
+	step := dtheta / float64(segments)
+	k := 4.0 / 3.0 * math.Tan(step/4)
+	pt := func(a float64) (float64, float64) {
+		ex, ey := rx*math.Cos(a), ry*math.Sin(a)
+		return cx + cosPhi*ex - sinPhi*ey, cy + sinPhi*ex + cosPhi*ey
+	}
+	deriv := func(a float64) (float64, float64) {
+		ex, ey := -rx*math.Sin(a), ry*math.Cos(a)
+		return cosPhi*ex - sinPhi*ey, sinPhi*ex + cosPhi*ey
+	}
+	for i := range segments {
+		a0 := theta1 + float64(i)*step
+		a1 := a0 + step
+		p0x, p0y := pt(a0)
+		d0x, d0y := deriv(a0)
+		p1x, p1y := pt(a1)
+		d1x, d1y := deriv(a1)
+		if i == segments-1 {
+			p1x, p1y = x, y
+		}
+		pb.curveTo(p0x+k*d0x, p0y+k*d0y, p1x-k*d1x, p1y-k*d1y, p1x, p1y)
+	}
+}
+
+// pathData adds the path of the SVG path data d. Path data with an error is
+// used up to the error as required by the SVG specification.
+func (pb *pathBuilder) pathData(d string) {
+	p := &pathParser{s: d}
+	var cmd byte
+	// the last control point for the S and T commands
+	var lastCX, lastCY float64
+	var lastCmd byte
+	hasCurrent := false
+	for !p.done() {
+		if c, ok := p.command(); ok {
+			cmd = c
+		} else if cmd == 0 {
+			return
+		}
+		upper := cmd &^ 0x20
+		rel := cmd != upper
+		if upper != 'M' && upper != 'Z' && !hasCurrent {
+			return
+		}
+		ox, oy := 0.0, 0.0
+		if rel {
+			ox, oy = pb.x, pb.y
+		}
+		switch upper {
+		case 'M':
+			v, ok := p.numbers(2)
+			if !ok {
+				return
+			}
+			pb.moveTo(ox+v[0], oy+v[1])
+			hasCurrent = true
+			// following coordinate pairs are lineto commands
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L':
+			v, ok := p.numbers(2)
+			if !ok {
+				return
+			}
+			pb.lineTo(ox+v[0], oy+v[1])
+		case 'H':
+			v, ok := p.numbers(1)
+			if !ok {
+				return
+			}
+			pb.lineTo(ox+v[0], pb.y)
+		case 'V':
+			v, ok := p.numbers(1)
+			if !ok {
+				return
+			}
+			pb.lineTo(pb.x, oy+v[0])
+		case 'C':
+			v, ok := p.numbers(6)
+			if !ok {
+				return
+			}
+			pb.curveTo(ox+v[0], oy+v[1], ox+v[2], oy+v[3], ox+v[4], oy+v[5])
+			lastCX, lastCY = ox+v[2], oy+v[3]
+		case 'S':
+			v, ok := p.numbers(4)
+			if !ok {
+				return
+			}
+			c1x, c1y := pb.x, pb.y
+			if lastCmd == 'C' || lastCmd == 'S' {
+				c1x, c1y = 2*pb.x-lastCX, 2*pb.y-lastCY
+			}
+			pb.curveTo(c1x, c1y, ox+v[0], oy+v[1], ox+v[2], oy+v[3])
+			lastCX, lastCY = ox+v[0], oy+v[1]
+		case 'Q', 'T':
+			var qx, qy, x, y float64
+			if upper == 'Q' {
+				v, ok := p.numbers(4)
+				if !ok {
+					return
+				}
+				qx, qy, x, y = ox+v[0], oy+v[1], ox+v[2], oy+v[3]
+			} else {
+				v, ok := p.numbers(2)
+				if !ok {
+					return
+				}
+				qx, qy = pb.x, pb.y
+				if lastCmd == 'Q' || lastCmd == 'T' {
+					qx, qy = 2*pb.x-lastCX, 2*pb.y-lastCY
+				}
+				x, y = ox+v[0], oy+v[1]
+			}
+			x0, y0 := pb.x, pb.y
+			pb.curveTo(x0+2.0/3.0*(qx-x0), y0+2.0/3.0*(qy-y0), x+2.0/3.0*(qx-x), y+2.0/3.0*(qy-y), x, y)
+			lastCX, lastCY = qx, qy
+		case 'A':
+			r, ok := p.numbers(3)
+			if !ok {
+				return
+			}
+			large, ok1 := p.flag()
+			sweep, ok2 := p.flag()
+			v, ok3 := p.numbers(2)
+			if !ok1 || !ok2 || !ok3 {
+				return
+			}
+			pb.arcTo(r[0], r[1], r[2], large, sweep, ox+v[0], oy+v[1])
+		case 'Z':
+			pb.closePath()
+			// a command must follow
+			cmd = 0
+		}
+		lastCmd = upper
+	}
+}
+
+// points adds a polyline with the points of the attribute value.
+func (pb *pathBuilder) points(s string, closed bool) {
+	v := numbers(s)
+	if len(v) < 4 {
+		return
+	}
+	pb.moveTo(v[0], v[1])
+	for i := 2; i+1 < len(v); i += 2 {
+		pb.lineTo(v[i], v[i+1])
+	}
+	if closed {
+		pb.closePath()
+	}
+}
+
+// shape adds the path of a shape element. The result is false for elements
+// that are no shapes.
+func (c *converter) shape(pb *pathBuilder, el *element) bool {
+	attr := func(name string, ref float64) float64 {
+		return c.length(el.attrs[name], ref, 0)
+	}
+	w, h, diag := c.vpWidth, c.vpHeight, c.diagonal()
+	switch el.name {
+	case "path":
+		pb.pathData(el.attrs["d"])
+	case "rect":
+		x, y, wd, ht := attr("x", w), attr("y", h), attr("width", w), attr("height", h)
+		if wd <= 0 || ht <= 0 {
+			return true
+		}
+		_, hasRX := el.attrs["rx"]
+		_, hasRY := el.attrs["ry"]
+		rx, ry := attr("rx", w), attr("ry", h)
+		if !hasRX {
+			rx = ry
+		}
+		if !hasRY {
+			ry = rx
+		}
+		rx, ry = math.Min(math.Max(rx, 0), wd/2), math.Min(math.Max(ry, 0), ht/2)
+		if rx == 0 || ry == 0 {
+			pb.moveTo(x, y)
+			pb.lineTo(x+wd, y)
+			pb.lineTo(x+wd, y+ht)
+			pb.lineTo(x, y+ht)
+			pb.closePath()
+			return true
+		}
+		kx, ky := rx*(1-kappa), ry*(1-kappa)
+		pb.moveTo(x+rx, y)
+		pb.lineTo(x+wd-rx, y)
+		pb.curveTo(x+wd-kx, y, x+wd, y+ky, x+wd, y+ry)
+		pb.lineTo(x+wd, y+ht-ry)
+		pb.curveTo(x+wd, y+ht-ky, x+wd-kx, y+ht, x+wd-rx, y+ht)
+		pb.lineTo(x+rx, y+ht)
+		pb.curveTo(x+kx, y+ht, x, y+ht-ky, x, y+ht-ry)
+		pb.lineTo(x, y+ry)
+		pb.curveTo(x, y+ky, x+kx, y, x+rx, y)
+		pb.closePath()
+	case "circle":
+		if r := attr("r", diag); r > 0 {
+			pb.ellipse(attr("cx", w), attr("cy", h), r, r)
+		}
+	case "ellipse":
+		rx, ry := attr("rx", w), attr("ry", h)
+		if rx > 0 && ry > 0 {
+			pb.ellipse(attr("cx", w), attr("cy", h), rx, ry)
+		}
+	case "line":
+		pb.moveTo(attr("x1", w), attr("y1", h))
+		pb.lineTo(attr("x2", w), attr("y2", h))
+	case "polyline":
+		pb.points(el.attrs["points"], false)
+	case "polygon":
+		pb.points(el.attrs["points"], true)
+	default:
+		return false
+	}
+	return true
+}
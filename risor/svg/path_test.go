@@ -0,0 +1,111 @@
+package svg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	testdata := []struct {
+		transform string
+		want      string
+	}{
+		{"", "1 0 0 1 0 0 cm"},
+		{"translate(10)", "1 0 0 1 10 0 cm"},
+		{"translate(10 20) scale(2)", "2 0 0 2 10 20 cm"},
+		{"scale(3,2)", "3 0 0 2 0 0 cm"},
+		{"rotate(90)", "0 1 -1 0 0 0 cm"},
+		{"rotate(90 10 10)", "0 1 -1 0 20 0 cm"},
+		{"matrix(1,2,3,4,5,6)", "1 2 3 4 5 6 cm"},
+		{"skewX(45)", "1 0 1 1 0 0 cm"},
+		{"foo(1) scale(3, 2)", "3 0 0 2 0 0 cm"},
+		{"translate(1 2 3)", "1 0 0 1 0 0 cm"},
+	}
+	for _, td := range testdata {
+		if got := parseTransform(td.transform).String(); got != td.want {
+			t.Errorf("parseTransform(%q) = %q, want %q", td.transform, got, td.want)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	testdata := []struct {
+		s    string
+		want []float64
+	}{
+		{"1 2,3", []float64{1, 2, 3}},
+		{"-1-2", []float64{-1, -2}},
+		{".5.5", []float64{0.5, 0.5}},
+		{"1e2 2E-1", []float64{100, 0.2}},
+		{"1e", []float64{1}},
+		{"", nil},
+		{"x", nil},
+	}
+	for _, td := range testdata {
+		got := numbers(td.s)
+		if len(got) != len(td.want) {
+			t.Errorf("numbers(%q) = %v, want %v", td.s, got, td.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != td.want[i] {
+				t.Errorf("numbers(%q) = %v, want %v", td.s, got, td.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPathData(t *testing.T) {
+	testdata := []struct {
+		d    string
+		want string
+	}{
+		{"M10 20L30 40Z", "10 20 m 30 40 l h"},
+		{"m10 20 l5 5 h10 v-5 z", "10 20 m 15 25 l 25 25 l 25 20 l h"},
+		{"M0 0 10 0 10 10", "0 0 m 10 0 l 10 10 l"},
+		{"M.5.5-1e1 1", "0.5 0.5 m -10 1 l"},
+		{"M0,0C1,2,3,4,5,6S9,10,11,12", "0 0 m 1 2 3 4 5 6 c 7 8 9 10 11 12 c"},
+		{"M0 0Q3 3 6 0", "0 0 m 2 2 4 2 6 0 c"},
+		{"M0 0Q3 3 6 0T12 0", "0 0 m 2 2 4 2 6 0 c 8 -2 10 -2 12 0 c"},
+		{"M0 0h10Z l5 5", "0 0 m 10 0 l h 5 5 l"},
+		// the path is used up to the error
+		{"M10 10 L20 20 L30", "10 10 m 20 20 l"},
+		{"L10 10", ""},
+		{"10 10", ""},
+	}
+	for _, td := range testdata {
+		pb := newPathBuilder(identity)
+		pb.pathData(td.d)
+		if got := pb.String(); got != td.want {
+			t.Errorf("pathData(%q) = %q, want %q", td.d, got, td.want)
+		}
+	}
+}
+
+func TestPathDataArc(t *testing.T) {
+	testdata := []struct {
+		d      string
+		suffix string
+	}{
+		// flags without separators
+		{"M0 0a5 5 0 0010 0", " 10 0 c"},
+		{"M0 0A5 5 0 1 1 10 0", " 10 0 c"},
+		// the radii are scaled up if they are too small
+		{"M0 0A1 1 0 0 0 10 0", " 10 0 c"},
+	}
+	for _, td := range testdata {
+		pb := newPathBuilder(identity)
+		pb.pathData(td.d)
+		got := pb.String()
+		if !strings.HasPrefix(got, "0 0 m ") || !strings.HasSuffix(got, td.suffix) {
+			t.Errorf("pathData(%q) = %q, want a curve to %q", td.d, got, td.suffix)
+		}
+	}
+	// a zero radius is a straight line
+	pb := newPathBuilder(identity)
+	pb.pathData("M0 0A0 5 0 0 0 10 0")
+	if got := pb.String(); got != "0 0 m 10 0 l" {
+		t.Errorf("pathData with a zero radius = %q, want a line", got)
+	}
+}
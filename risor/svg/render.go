@@ -0,0 +1,321 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// viewBoxMatrix returns the transformation from the view box vb (x, y, width,
+// height) to a viewport of the given size.
+func viewBoxMatrix(vb []float64, wd, ht float64, preserveAspectRatio string) matrix {
+	sx, sy := wd/vb[2], ht/vb[3]
+	fields := strings.Fields(preserveAspectRatio)
+	if len(fields) > 0 && fields[0] == "defer" {
+		fields = fields[1:]
+	}
+	align := "xMidYMid"
+	if len(fields) > 0 {
+		align = fields[0]
+	}
+	if align != "none" {
+		s := math.Min(sx, sy)
+		if len(fields) > 1 && fields[1] == "slice" {
+			s = math.Max(sx, sy)
+		}
+		sx, sy = s, s
+	}
+	tx, ty := -vb[0]*sx, -vb[1]*sy
+	extraX, extraY := wd-vb[2]*sx, ht-vb[3]*sy
+	switch {
+	case strings.Contains(align, "xMid"):
+		tx += extraX / 2
+	case strings.Contains(align, "xMax"):
+		tx += extraX
+	}
+	switch {
+	case strings.Contains(align, "YMid"):
+		ty += extraY / 2
+	case strings.Contains(align, "YMax"):
+		ty += extraY
+	}
+	return matrix{sx, 0, 0, sy, tx, ty}
+}
+
+// viewBox returns the view box of the element or nil.
+func viewBox(el *element) []float64 {
+	vb := numbers(el.attrs["viewBox"])
+	if len(vb) != 4 || vb[2] <= 0 || vb[3] <= 0 {
+		return nil
+	}
+	return vb
+}
+
+// setupViewport writes the transformation from the PDF coordinates to the user
+// units of the SVG file and returns the size of the image in PDF points.
+func (c *converter) setupViewport() (float64, float64) {
+	vb := viewBox(c.root)
+	size := func(name string, vbSize, def float64) float64 {
+		s := strings.TrimSpace(c.root.attrs[name])
+		if s == "" || strings.HasSuffix(s, "%") {
+			if vb != nil {
+				return vbSize
+			}
+			return def
+		}
+		return c.length(s, 0, 0)
+	}
+	var vbWd, vbHt float64
+	if vb != nil {
+		vbWd, vbHt = vb[2], vb[3]
+	}
+	wd, ht := size("width", vbWd, 300), size("height", vbHt, 150)
+	if wd <= 0 || ht <= 0 {
+		return 0, 0
+	}
+	// SVG has 96 pixels per inch and the y axis points downwards.
+	c.printf("%s", matrix{0.75, 0, 0, -0.75, 0, ht * 0.75})
+	c.printf("0 0 %s %s re W n", num(wd), num(ht))
+	c.vpWidth, c.vpHeight = wd, ht
+	if vb != nil {
+		c.printf("%s", viewBoxMatrix(vb, wd, ht, c.root.attrs["preserveAspectRatio"]))
+		c.vpWidth, c.vpHeight = vb[2], vb[3]
+	}
+	return wd * 0.75, ht * 0.75
+}
+
+func (c *converter) renderChildren(el *element, st *style) {
+	for _, child := range el.children {
+		if child.name != "" {
+			c.render(child, st)
+		}
+	}
+}
+
+// render writes the PDF code of the element and its children.
+func (c *converter) render(el *element, parent *style) {
+	switch el.name {
+	case "defs", "symbol", "clipPath", "linearGradient", "radialGradient", "mask",
+		"pattern", "marker", "style", "title", "desc", "metadata", "filter", "script":
+		return
+	}
+	props := c.properties(el)
+	if props["display"] == "none" {
+		return
+	}
+	st := c.computeStyle(parent, props)
+	switch el.name {
+	case "g", "a", "switch":
+		c.group(el, props, func() { c.renderChildren(el, st) })
+	case "svg":
+		c.group(el, props, func() { c.nestedViewport(el, el, st) })
+	case "use":
+		c.use(el, st, props)
+	case "text":
+		c.group(el, props, func() { c.text(el, st) })
+	case "image":
+		c.warn("images are not supported")
+	default:
+		pb := newPathBuilder(identity)
+		if !c.shape(pb, el) {
+			c.warn(fmt.Sprintf("element %s is not supported", el.name))
+			return
+		}
+		if len(pb.ops) == 0 {
+			return
+		}
+		c.group(el, props, func() { c.paintPath(pb, st) })
+	}
+}
+
+// group saves the graphics state, applies the transformation and the clip
+// path of the element and restores the graphics state after fn.
+func (c *converter) group(el *element, props map[string]string, fn func()) {
+	c.printf("q")
+	if t, ok := el.attrs["transform"]; ok {
+		c.printf("%s", parseTransform(t))
+	}
+	if cp := props["clip-path"]; strings.HasPrefix(cp, "url(") {
+		c.clip(strings.Trim(strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(cp, "url("), ")")), `"'#`))
+	}
+	fn()
+	c.printf("Q")
+}
+
+// nestedViewport renders the children of el (an svg or symbol element) in a
+// new viewport. sizeEl has the position and the size of the viewport.
+// The size defaults to the size of the current viewport.
+func (c *converter) nestedViewport(el, sizeEl *element, st *style) {
+	x := c.length(sizeEl.attrs["x"], c.vpWidth, 0)
+	y := c.length(sizeEl.attrs["y"], c.vpHeight, 0)
+	wd := c.length(sizeEl.attrs["width"], c.vpWidth, c.vpWidth)
+	ht := c.length(sizeEl.attrs["height"], c.vpHeight, c.vpHeight)
+	if wd <= 0 || ht <= 0 {
+		return
+	}
+	saveWd, saveHt := c.vpWidth, c.vpHeight
+	c.printf("%s", matrix{1, 0, 0, 1, x, y})
+	if vb := viewBox(el); vb != nil {
+		c.printf("0 0 %s %s re W n", num(wd), num(ht))
+		c.printf("%s", viewBoxMatrix(vb, wd, ht, el.attrs["preserveAspectRatio"]))
+		c.vpWidth, c.vpHeight = vb[2], vb[3]
+	} else {
+		c.vpWidth, c.vpHeight = wd, ht
+	}
+	c.renderChildren(el, st)
+	c.vpWidth, c.vpHeight = saveWd, saveHt
+}
+
+// use renders the element referenced by a use element.
+func (c *converter) use(el *element, st *style, props map[string]string) {
+	target := c.ids[strings.TrimPrefix(el.attrs["href"], "#")]
+	if target == nil {
+		return
+	}
+	if c.useDepth >= maxUseDepth {
+		c.warn("use elements are nested too deep")
+		return
+	}
+	c.useDepth++
+	defer func() { c.useDepth-- }()
+	c.group(el, props, func() {
+		if target.name == "symbol" {
+			tprops := c.properties(target)
+			if tprops["display"] == "none" {
+				return
+			}
+			c.nestedViewport(target, el, c.computeStyle(st, tprops))
+			return
+		}
+		x := c.length(el.attrs["x"], c.vpWidth, 0)
+		y := c.length(el.attrs["y"], c.vpHeight, 0)
+		if x != 0 || y != 0 {
+			c.printf("%s", matrix{1, 0, 0, 1, x, y})
+		}
+		c.render(target, st)
+	})
+}
+
+// clip sets the clip path with the id.
+func (c *converter) clip(id string) {
+	el := c.ids[id]
+	if el == nil || el.name != "clipPath" {
+		return
+	}
+	if el.attrs["clipPathUnits"] == "objectBoundingBox" {
+		c.warn("clip paths in object bounding box units are not supported")
+		return
+	}
+	m := parseTransform(el.attrs["transform"])
+	pb := newPathBuilder(m)
+	evenOdd := false
+	for _, child := range el.children {
+		if child.name == "" {
+			continue
+		}
+		props := c.properties(child)
+		if props["display"] == "none" || props["visibility"] == "hidden" {
+			continue
+		}
+		pb.m = parseTransform(child.attrs["transform"]).mul(m)
+		if c.shape(pb, child) && props["clip-rule"] == "evenodd" {
+			evenOdd = true
+		}
+	}
+	if len(pb.ops) == 0 {
+		// an empty clip path hides the element
+		c.printf("0 0 0 0 re W n")
+		return
+	}
+	if evenOdd {
+		c.printf("%s W* n", pb)
+	} else {
+		c.printf("%s W n", pb)
+	}
+}
+
+// setAlpha selects the opacity for filling and stroking.
+func (c *converter) setAlpha(fill, stroke float64) {
+	if fill >= 1 && stroke >= 1 {
+		return
+	}
+	n := resource(&c.extGStates, fmt.Sprintf("<< /Type /ExtGState /ca %s /CA %s >>", num(fill), num(stroke)))
+	c.printf("/GS%d gs", n)
+}
+
+func (col rgb) String() string {
+	return num(col.r) + " " + num(col.g) + " " + num(col.b)
+}
+
+// resolvePaint returns the color or the gradient of a paint. ok is false if
+// nothing is painted.
+func (c *converter) resolvePaint(p paint) (col rgb, grad *element, ok bool) {
+	switch p.kind {
+	case paintColor:
+		return p.col, nil, true
+	case paintURL:
+		if el := c.ids[p.url]; el != nil {
+			switch el.name {
+			case "linearGradient", "radialGradient":
+				return rgb{}, el, true
+			case "pattern":
+				c.warn("patterns are not supported")
+			}
+		}
+		if p.fallback != nil {
+			return c.resolvePaint(*p.fallback)
+		}
+	}
+	return rgb{}, nil, false
+}
+
+var lineCaps = map[string]int{"butt": 0, "round": 1, "square": 2}
+var lineJoins = map[string]int{"miter": 0, "miter-clip": 0, "arcs": 0, "round": 1, "bevel": 2}
+
+// paintPath fills and strokes the path.
+func (c *converter) paintPath(pb *pathBuilder, st *style) {
+	if !st.visible {
+		return
+	}
+	c.setAlpha(st.fillOpacity*st.opacity, st.strokeOpacity*st.opacity)
+	if col, grad, ok := c.resolvePaint(st.fill); ok {
+		op := "f"
+		if st.fillRule == "evenodd" {
+			op = "f*"
+		}
+		if grad != nil {
+			c.gradientFill(grad, pb, op == "f*", st)
+		} else {
+			c.printf("%s rg %s %s", col, pb, op)
+		}
+	}
+	col, grad, ok := c.resolvePaint(st.stroke)
+	if !ok || st.strokeWidth <= 0 {
+		return
+	}
+	if grad != nil {
+		// strokes with gradients get the color of the first stop
+		stops := c.gradientStops(grad, st)
+		if len(stops) == 0 {
+			return
+		}
+		col = stops[0].col
+	}
+	c.printf("%s w %d J %d j %s M", num(st.strokeWidth), lineCaps[st.lineCap], lineJoins[st.lineJoin], num(st.miterLimit))
+	if len(st.dashArray) > 0 {
+		dashes := st.dashArray
+		if len(dashes)%2 == 1 {
+			dashes = append(dashes, dashes...)
+		}
+		sum := 0.0
+		values := make([]string, len(dashes))
+		for i, d := range dashes {
+			sum += d
+			values[i] = num(d)
+		}
+		if sum > 0 {
+			c.printf("[%s] %s d", strings.Join(values, " "), num(st.dashOffset))
+		}
+	}
+	c.printf("%s RG %s S", col, pb)
+}
@@ -0,0 +1,508 @@
+package svg
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rgb is a color with the values between 0 and 1.
+type rgb struct {
+	r, g, b float64
+}
+
+// paintKind is the type of a fill or a stroke.
+type paintKind int
+
+const (
+	paintNone paintKind = iota
+	paintColor
+	paintURL
+)
+
+// paint is the value of the fill and stroke properties.
+type paint struct {
+	kind paintKind
+	col  rgb
+	url  string
+	// the color if the url can't be used
+	fallback *paint
+	// the paint is currentColor
+	current bool
+}
+
+// style holds the computed values of the properties.
+type style struct {
+	fill, stroke      paint
+	color             rgb
+	fillOpacity       float64
+	strokeOpacity     float64
+	opacity           float64
+	strokeWidth       float64
+	lineCap, lineJoin string
+	miterLimit        float64
+	dashArray         []float64
+	dashOffset        float64
+	fillRule          string
+	clipRule          string
+	fontSize          float64
+	fontFamily        string
+	fontWeight        string
+	fontStyle         string
+	textAnchor        string
+	visible           bool
+}
+
+// rootStyle returns the initial values of the properties.
+func (c *converter) rootStyle() *style {
+	return &style{
+		fill:          paint{kind: paintColor},
+		stroke:        paint{kind: paintNone},
+		fillOpacity:   1,
+		strokeOpacity: 1,
+		opacity:       1,
+		strokeWidth:   1,
+		lineCap:       "butt",
+		lineJoin:      "miter",
+		miterLimit:    4,
+		fillRule:      "nonzero",
+		clipRule:      "nonzero",
+		fontSize:      16,
+		fontFamily:    "serif",
+		fontWeight:    "normal",
+		fontStyle:     "normal",
+		textAnchor:    "start",
+		visible:       true,
+	}
+}
+
+// presentationAttributes are the attributes that can also be set in style
+// sheets.
+var presentationAttributes = []string{
+	"fill", "stroke", "color", "fill-opacity", "stroke-opacity", "opacity",
+	"stroke-width", "stroke-linecap", "stroke-linejoin", "stroke-miterlimit",
+	"stroke-dasharray", "stroke-dashoffset", "fill-rule", "clip-rule",
+	"font-size", "font-family", "font-weight", "font-style", "text-anchor",
+	"visibility", "display", "clip-path", "stop-color", "stop-opacity",
+}
+
+// properties returns the properties of the element from the presentation
+// attributes, the style sheets and the style attribute in increasing priority.
+func (c *converter) properties(el *element) map[string]string {
+	props := map[string]string{}
+	for _, attr := range presentationAttributes {
+		if v, ok := el.attrs[attr]; ok {
+			props[attr] = strings.TrimSpace(v)
+		}
+	}
+	for _, rule := range c.rules {
+		if rule.sel.matches(el) {
+			for k, v := range rule.decls {
+				props[k] = v
+			}
+		}
+	}
+	for k, v := range parseDeclarations(el.attrs["style"]) {
+		props[k] = v
+	}
+	return props
+}
+
+// computeStyle returns the style of an element with the properties props. The
+// opacity of the parent is multiplied with the opacity of the element.
+func (c *converter) computeStyle(parent *style, props map[string]string) *style {
+	st := *parent
+	if st.dashArray != nil {
+		st.dashArray = append([]float64(nil), parent.dashArray...)
+	}
+	// color first, so that currentColor gets the new value
+	if v, ok := props["color"]; ok && v != "inherit" {
+		if col, ok := parseColor(v); ok {
+			st.color = col
+		}
+	}
+	if st.fill.current {
+		st.fill.col = st.color
+	}
+	if st.stroke.current {
+		st.stroke.col = st.color
+	}
+	for k, v := range props {
+		if v == "inherit" {
+			continue
+		}
+		switch k {
+		case "fill":
+			if p, ok := c.parsePaint(v, st.color); ok {
+				st.fill = p
+			}
+		case "stroke":
+			if p, ok := c.parsePaint(v, st.color); ok {
+				st.stroke = p
+			}
+		case "fill-opacity":
+			st.fillOpacity = parseOpacity(v, st.fillOpacity)
+		case "stroke-opacity":
+			st.strokeOpacity = parseOpacity(v, st.strokeOpacity)
+		case "opacity":
+			st.opacity *= parseOpacity(v, 1)
+		case "stroke-width":
+			st.strokeWidth = c.length(v, c.diagonal(), st.strokeWidth)
+		case "stroke-linecap":
+			st.lineCap = v
+		case "stroke-linejoin":
+			st.lineJoin = v
+		case "stroke-miterlimit":
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 1 {
+				st.miterLimit = f
+			}
+		case "stroke-dasharray":
+			st.dashArray = nil
+			if v != "none" {
+				for _, f := range numbers(v) {
+					if f < 0 {
+						st.dashArray = nil
+						break
+					}
+					st.dashArray = append(st.dashArray, f)
+				}
+			}
+		case "stroke-dashoffset":
+			st.dashOffset = c.length(v, c.diagonal(), 0)
+		case "fill-rule":
+			st.fillRule = v
+		case "clip-rule":
+			st.clipRule = v
+		case "font-size":
+			st.fontSize = c.fontSize(v, parent.fontSize)
+		case "font-family":
+			st.fontFamily = v
+		case "font-weight":
+			st.fontWeight = v
+		case "font-style":
+			st.fontStyle = v
+		case "text-anchor":
+			st.textAnchor = v
+		case "visibility":
+			st.visible = v != "hidden" && v != "collapse"
+		}
+	}
+	return &st
+}
+
+// parseOpacity returns the value of an opacity (a number or a percentage)
+// between 0 and 1.
+func parseOpacity(s string, def float64) float64 {
+	pct := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return def
+	}
+	if pct {
+		f /= 100
+	}
+	return math.Max(0, math.Min(1, f))
+}
+
+// parsePaint parses the value of fill or stroke.
+func (c *converter) parsePaint(s string, current rgb) (paint, bool) {
+	switch s {
+	case "none", "transparent":
+		return paint{kind: paintNone}, true
+	case "currentColor", "currentcolor":
+		return paint{kind: paintColor, col: current, current: true}, true
+	}
+	if strings.HasPrefix(s, "url(") {
+		end := strings.Index(s, ")")
+		if end < 0 {
+			return paint{}, false
+		}
+		p := paint{kind: paintURL, url: strings.Trim(strings.TrimSpace(s[4:end]), `"'`)}
+		p.url = strings.TrimPrefix(p.url, "#")
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" {
+			if fb, ok := c.parsePaint(rest, current); ok {
+				p.fallback = &fb
+			}
+		}
+		return p, true
+	}
+	if col, ok := parseColor(s); ok {
+		return paint{kind: paintColor, col: col}, true
+	}
+	return paint{}, false
+}
+
+// parseColor parses a color name, a hex color (#rgb, #rrggbb) or an rgb()
+// color.
+func parseColor(s string) (rgb, bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		hx := s[1:]
+		if len(hx) == 3 || len(hx) == 4 {
+			hx = string([]byte{hx[0], hx[0], hx[1], hx[1], hx[2], hx[2]})
+		}
+		if len(hx) == 8 {
+			hx = hx[:6]
+		}
+		if len(hx) != 6 {
+			return rgb{}, false
+		}
+		v, err := strconv.ParseUint(hx, 16, 32)
+		if err != nil {
+			return rgb{}, false
+		}
+		return hexColor(uint32(v)), true
+	}
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "rgb") {
+		start, end := strings.Index(s, "("), strings.LastIndex(s, ")")
+		if start < 0 || end < start {
+			return rgb{}, false
+		}
+		parts := strings.FieldsFunc(s[start+1:end], func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+		if len(parts) < 3 {
+			return rgb{}, false
+		}
+		var values [3]float64
+		for i := range 3 {
+			p := parts[i]
+			pct := strings.HasSuffix(p, "%")
+			f, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+			if err != nil {
+				return rgb{}, false
+			}
+			if pct {
+				f /= 100
+			} else {
+				f /= 255
+			}
+			values[i] = math.Max(0, math.Min(1, f))
+		}
+		return rgb{values[0], values[1], values[2]}, true
+	}
+	if v, ok := namedColors[lower]; ok {
+		return hexColor(v), true
+	}
+	return rgb{}, false
+}
+
+func hexColor(v uint32) rgb {
+	return rgb{
+		r: float64(v>>16&0xff) / 255,
+		g: float64(v>>8&0xff) / 255,
+		b: float64(v&0xff) / 255,
+	}
+}
+
+// length parses a length with an optional unit and returns it in user units.
+// Percentages are relative to ref.
+func (c *converter) length(s string, ref float64, def float64) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def
+	}
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"%", ref / 100},
+		{"px", 1},
+		{"pt", 96.0 / 72.0},
+		{"pc", 16},
+		{"mm", 96 / 25.4},
+		{"cm", 96 / 2.54},
+		{"in", 96},
+		{"em", 16},
+		{"ex", 8},
+	}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSuffix(s, u.suffix), u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return def
+	}
+	return f * factor
+}
+
+// fontSize parses the value of font-size, em and percentages are relative to
+// the font size of the parent.
+func (c *converter) fontSize(s string, parent float64) float64 {
+	switch {
+	case strings.HasSuffix(s, "em"):
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(s, "em"), 64); err == nil {
+			return f * parent
+		}
+		return parent
+	case strings.HasSuffix(s, "%"):
+		return c.length(s, parent, parent)
+	}
+	return c.length(s, parent, parent)
+}
+
+// diagonal is the reference for percentages that are neither horizontal nor
+// vertical.
+func (c *converter) diagonal() float64 {
+	return math.Hypot(c.vpWidth, c.vpHeight) / math.Sqrt2
+}
+
+// numbers returns the numbers in s which are separated by commas or white
+// space.
+func numbers(s string) []float64 {
+	var ret []float64
+	p := &pathParser{s: s}
+	for {
+		f, ok := p.number()
+		if !ok {
+			return ret
+		}
+		ret = append(ret, f)
+	}
+}
+
+// parseDeclarations parses CSS declarations such as "fill: red; stroke: none".
+func parseDeclarations(s string) map[string]string {
+	ret := map[string]string{}
+	for _, decl := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "!important"))
+		ret[strings.TrimSpace(k)] = v
+	}
+	return ret
+}
+
+// selector is a simple CSS selector such as rect, .cls, #id or path.cls1.cls2.
+type selector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+func (sel selector) specificity() int {
+	s := len(sel.classes) * 10
+	if sel.id != "" {
+		s += 100
+	}
+	if sel.tag != "" {
+		s++
+	}
+	return s
+}
+
+func (sel selector) matches(el *element) bool {
+	if sel.tag != "" && sel.tag != el.name {
+		return false
+	}
+	if sel.id != "" && sel.id != el.attrs["id"] {
+		return false
+	}
+	classes := strings.Fields(el.attrs["class"])
+	for _, cls := range sel.classes {
+		found := false
+		for _, c := range classes {
+			if c == cls {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSelector returns the selector of s and false if s is not a simple
+// selector.
+func parseSelector(s string) (selector, bool) {
+	var sel selector
+	if s == "" || strings.ContainsAny(s, " >+~:[") {
+		return sel, false
+	}
+	if s == "*" {
+		return sel, true
+	}
+	i := strings.IndexAny(s, ".#")
+	if i < 0 {
+		sel.tag = s
+		return sel, true
+	}
+	sel.tag = s[:i]
+	s = s[i:]
+	for s != "" {
+		kind := s[0]
+		s = s[1:]
+		end := strings.IndexAny(s, ".#")
+		if end < 0 {
+			end = len(s)
+		}
+		name := s[:end]
+		s = s[end:]
+		if name == "" {
+			return sel, false
+		}
+		if kind == '#' {
+			sel.id = name
+		} else {
+			sel.classes = append(sel.classes, name)
+		}
+	}
+	return sel, true
+}
+
+// cssRule is a rule of a style sheet with one selector.
+type cssRule struct {
+	sel   selector
+	decls map[string]string
+}
+
+// parseCSS returns the rules of the style sheet. Rules with selectors other
+// than simple selectors and at-rules are ignored.
+func parseCSS(css string) []cssRule {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			css = css[:start]
+			break
+		}
+		css = css[:start] + css[start+2+end+2:]
+	}
+	var rules []cssRule
+	for _, block := range strings.Split(css, "}") {
+		sels, decls, ok := strings.Cut(block, "{")
+		if !ok {
+			continue
+		}
+		sels = strings.TrimSpace(sels)
+		if strings.HasPrefix(sels, "@") || strings.Contains(decls, "{") {
+			continue
+		}
+		d := parseDeclarations(decls)
+		for _, s := range strings.Split(sels, ",") {
+			if sel, ok := parseSelector(strings.TrimSpace(s)); ok {
+				rules = append(rules, cssRule{sel: sel, decls: d})
+			}
+		}
+	}
+	return rules
+}
+
+// sortRules sorts the rules by specificity. Rules with the same specificity
+// keep the order of the style sheets.
+func sortRules(rules []cssRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].sel.specificity() < rules[j].sel.specificity()
+	})
+}
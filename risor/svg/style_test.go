@@ -0,0 +1,158 @@
+package svg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	testdata := []struct {
+		s    string
+		want rgb
+		ok   bool
+	}{
+		{"#ff0000", rgb{1, 0, 0}, true},
+		{"#0f0", rgb{0, 1, 0}, true},
+		{"#0000ff80", rgb{0, 0, 1}, true},
+		{" #FFF ", rgb{1, 1, 1}, true},
+		{"rgb(255, 0, 0)", rgb{1, 0, 0}, true},
+		{"rgb(0 255 0 / 0.5)", rgb{0, 1, 0}, true},
+		{"rgb(100%,50%,0%)", rgb{1, 0.5, 0}, true},
+		{"rgb(300,-10,0)", rgb{1, 0, 0}, true},
+		{"Black", rgb{0, 0, 0}, true},
+		{"white", rgb{1, 1, 1}, true},
+		{"#12", rgb{}, false},
+		{"#ggg", rgb{}, false},
+		{"rgb(1,2)", rgb{}, false},
+		{"nocolor", rgb{}, false},
+	}
+	for _, td := range testdata {
+		got, ok := parseColor(td.s)
+		if ok != td.ok || got != td.want {
+			t.Errorf("parseColor(%q) = %v, %t, want %v, %t", td.s, got, ok, td.want, td.ok)
+		}
+	}
+}
+
+func TestParseDeclarations(t *testing.T) {
+	testdata := []struct {
+		s    string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"fill: red; stroke:none", map[string]string{"fill": "red", "stroke": "none"}},
+		{" fill : red ; ; stroke-width: 2 ;", map[string]string{"fill": "red", "stroke-width": "2"}},
+		{"fill: red !important", map[string]string{"fill": "red"}},
+		{"fill: url(#a:b)", map[string]string{"fill": "url(#a:b)"}},
+		{"fill red", map[string]string{}},
+	}
+	for _, td := range testdata {
+		if got := parseDeclarations(td.s); !reflect.DeepEqual(got, td.want) {
+			t.Errorf("parseDeclarations(%q) = %v, want %v", td.s, got, td.want)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	testdata := []struct {
+		s           string
+		want        selector
+		ok          bool
+		specificity int
+	}{
+		{"*", selector{}, true, 0},
+		{"rect", selector{tag: "rect"}, true, 1},
+		{".a", selector{classes: []string{"a"}}, true, 10},
+		{"#id", selector{id: "id"}, true, 100},
+		{"path.a.b", selector{tag: "path", classes: []string{"a", "b"}}, true, 21},
+		{"g#id.a", selector{tag: "g", id: "id", classes: []string{"a"}}, true, 111},
+		{"", selector{}, false, 0},
+		{"g rect", selector{}, false, 0},
+		{"g > rect", selector{}, false, 0},
+		{"a:hover", selector{}, false, 0},
+		{"rect[x]", selector{}, false, 0},
+		{"rect.", selector{}, false, 0},
+	}
+	for _, td := range testdata {
+		got, ok := parseSelector(td.s)
+		if ok != td.ok {
+			t.Errorf("parseSelector(%q) ok = %t, want %t", td.s, ok, td.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(got, td.want) {
+			t.Errorf("parseSelector(%q) = %+v, want %+v", td.s, got, td.want)
+		}
+		if s := got.specificity(); s != td.specificity {
+			t.Errorf("parseSelector(%q).specificity() = %d, want %d", td.s, s, td.specificity)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	el := &element{name: "rect", attrs: map[string]string{"id": "r1", "class": " a  b "}}
+	testdata := []struct {
+		s    string
+		want bool
+	}{
+		{"*", true},
+		{"rect", true},
+		{"circle", false},
+		{".a", true},
+		{".b.a", true},
+		{".c", false},
+		{"rect#r1.b", true},
+		{"#r2", false},
+	}
+	for _, td := range testdata {
+		sel, _ := parseSelector(td.s)
+		if got := sel.matches(el); got != td.want {
+			t.Errorf("%q matches = %t, want %t", td.s, got, td.want)
+		}
+	}
+}
+
+func TestParseCSS(t *testing.T) {
+	css := `
+	/* a comment { fill: red } */
+	@media print { rect { fill: blue } }
+	rect, .a { fill: green; stroke: black }
+	g rect { fill: red }
+	#x { opacity: 0.5 }
+	/* unterminated comment`
+	rules := parseCSS(css)
+	type rule struct {
+		sel   string
+		decls map[string]string
+	}
+	var got []rule
+	for _, r := range rules {
+		name := r.sel.tag
+		if r.sel.id != "" {
+			name += "#" + r.sel.id
+		}
+		for _, cls := range r.sel.classes {
+			name += "." + cls
+		}
+		got = append(got, rule{name, r.decls})
+	}
+	green := map[string]string{"fill": "green", "stroke": "black"}
+	want := []rule{
+		{"rect", green},
+		{".a", green},
+		{"#x", map[string]string{"opacity": "0.5"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCSS() = %v, want %v", got, want)
+	}
+	sortRules(rules)
+	var order []string
+	for _, r := range rules {
+		order = append(order, r.sel.tag+r.sel.id+"/"+r.decls["fill"])
+	}
+	if want := []string{"rect/green", "/green", "x/"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("sortRules() = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Package svg converts SVG images to PDF files. The PDF file has one page with
+// the size of the SVG image and can be loaded like any other PDF image.
+//
+// The converter handles the shapes (path, rect, circle, ellipse, line,
+// polyline and polygon), groups, use, transformations, fills and strokes,
+// opacity, linear and radial gradients, clip paths with shapes, style sheets
+// with simple selectors and text. Text is converted to outlines with the fonts
+// of the caller, see Fonts. Other elements such as images, masks, patterns
+// and filters are ignored.
+package svg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/cli/risor/pdfpage"
+)
+
+// cacheVersion is part of the cache key, so changes to the converter create
+// new PDF files.
+const cacheVersion = "3"
+
+// maxUseDepth limits the nesting of use elements.
+const maxUseDepth = 20
+
+// element is an XML element of the SVG file. Character data is stored in
+// elements without a name.
+type element struct {
+	name     string
+	attrs    map[string]string
+	children []*element
+	text     string
+}
+
+// parse reads the XML tree of the SVG file and returns the root element.
+func parse(r io.Reader) (*element, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	var root *element
+	var stack []*element
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &element{name: t.Name.Local, attrs: map[string]string{}}
+			for _, attr := range t.Attr {
+				el.attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			} else if root == nil {
+				root = el
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &element{text: string(t)})
+			}
+		}
+	}
+	if root == nil || root.name != "svg" {
+		return nil, fmt.Errorf("no svg element found")
+	}
+	return root, nil
+}
+
+// converter holds the state of the conversion.
+type converter struct {
+	root   *element
+	ids    map[string]*element
+	rules  []cssRule
+	buf    bytes.Buffer
+	warned map[string]bool
+	// the size of the viewport in user units for percentages
+	vpWidth, vpHeight float64
+	// the size of the image in PDF points
+	width, height float64
+	// resources of the page
+	extGStates []string
+	shadings   []string
+	useDepth   int
+	// the fonts for the text, nil if text is left out
+	fonts Fonts
+	// the fonts the text has asked for
+	fontRequests []fontRequest
+}
+
+// printf appends PDF code to the content stream.
+func (c *converter) printf(format string, a ...any) {
+	if c.buf.Len() > 0 {
+		c.buf.WriteByte(' ')
+	}
+	fmt.Fprintf(&c.buf, format, a...)
+}
+
+// warn logs a message once.
+func (c *converter) warn(msg string) {
+	if c.warned[msg] {
+		return
+	}
+	c.warned[msg] = true
+	bag.Logger.Warn("SVG: " + msg)
+}
+
+// collect records the elements with an id and the style sheets.
+func (c *converter) collect(el *element) {
+	if id := el.attrs["id"]; id != "" {
+		if _, ok := c.ids[id]; !ok {
+			c.ids[id] = el
+		}
+	}
+	if el.name == "style" {
+		var sb strings.Builder
+		for _, child := range el.children {
+			sb.WriteString(child.text)
+		}
+		c.rules = append(c.rules, parseCSS(sb.String())...)
+	}
+	for _, child := range el.children {
+		if child.name != "" {
+			c.collect(child)
+		}
+	}
+}
+
+// resource returns the index (starting at 1) of dict in the list of resources
+// and adds it if necessary.
+func resource(list *[]string, dict string) int {
+	for i, d := range *list {
+		if d == dict {
+			return i + 1
+		}
+	}
+	*list = append(*list, dict)
+	return len(*list)
+}
+
+// Convert reads an SVG image and writes it as a one page PDF file. The text
+// is set with the fonts from fonts, which can be nil if the image has no
+// text.
+func Convert(r io.Reader, w io.Writer, fonts Fonts) error {
+	c, err := convert(r, fonts)
+	if err != nil {
+		return err
+	}
+	return c.page().Write(w)
+}
+
+// convert renders the SVG image into the content stream and the resources of
+// the converter.
+func convert(r io.Reader, fonts Fonts) (*converter, error) {
+	root, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &converter{
+		root:   root,
+		ids:    map[string]*element{},
+		warned: map[string]bool{},
+		fonts:  fonts,
+	}
+	c.collect(root)
+	sortRules(c.rules)
+	c.width, c.height = c.setupViewport()
+	if c.width <= 0 || c.height <= 0 {
+		return nil, fmt.Errorf("the image has no size")
+	}
+	c.renderChildren(root, c.rootStyle())
+	return c, nil
+}
+
+// page returns the converted image as a PDF page.
+func (c *converter) page() *pdfpage.Page {
+	return &pdfpage.Page{
+		Width:      c.width,
+		Height:     c.height,
+		Content:    c.buf.Bytes(),
+		ExtGStates: c.extGStates,
+		Shadings:   c.shadings,
+	}
+}
+
+// IsSVG returns true if the file name has the extension .svg.
+func IsSVG(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".svg")
+}
+
+// ToPDF converts the SVG file to a PDF file and returns the name of the PDF
+// file. The text is set with the fonts from fonts. The PDF files are stored
+// in the user's cache directory with a name derived from the contents of the
+// SVG file and the fonts the text asks for, so each image is converted only
+// once. The fonts are known after the conversion, they are stored in an index
+// file next to the PDF files.
+func ToPDF(filename string, fonts Fonts) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", cacheVersion)
+	h.Write(data)
+	sum := h.Sum(nil)
+	dir := pdfpage.CacheDir("svg")
+	indexFilename := filepath.Join(dir, hex.EncodeToString(sum[:16])+".fonts")
+	if index, err := os.ReadFile(indexFilename); err == nil {
+		if requests, err := parseFontRequests(index); err == nil {
+			pdfFilename := filepath.Join(dir, cacheKey(sum, requests, fonts)+".pdf")
+			if _, err = os.Stat(pdfFilename); err == nil {
+				return pdfFilename, nil
+			}
+		}
+	}
+	bag.Logger.Info("Convert SVG", "filename", filename)
+	c, err := convert(bytes.NewReader(data), fonts)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filename, err)
+	}
+	if err = pdfpage.WriteFile(indexFilename, c.writeFontRequests); err != nil {
+		return "", err
+	}
+	return pdfpage.Cached(dir, cacheKey(sum, c.fontRequests, fonts), c.page().Write)
+}
+
+// cacheKey returns the name of the cached PDF file for the SVG file with the
+// hash sum and the fonts the text asks for.
+func cacheKey(sum []byte, requests []fontRequest, fonts Fonts) string {
+	h := sha256.New()
+	h.Write(sum)
+	for _, fr := range requests {
+		id := ""
+		if fonts != nil {
+			id = fonts.ID(fr.family, fr.weight, fr.italic)
+		}
+		fmt.Fprintf(h, "\n%s %q", fr, id)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,334 @@
+package svg
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/textlayout/fonts"
+	"github.com/boxesandglue/textlayout/fonts/truetype"
+)
+
+// Text is converted to outlines with the fonts of the conversion, so the PDF
+// file contains no fonts. Text without a font is left out.
+
+// Fonts provides the fonts for the text of SVG images.
+type Fonts interface {
+	// Font returns the font for a family of the font-family property, the
+	// font weight (100 to 900) and the font style. ok is false if there is
+	// no font for the family.
+	Font(family string, weight int, italic bool) (font *truetype.Font, ok bool)
+	// ID identifies the font Font returns, such as the file name of the
+	// font. It is "" if there is no font. The IDs are part of the names of
+	// the cached PDF files, so the images are converted again when the fonts
+	// change.
+	ID(family string, weight int, italic bool) string
+}
+
+// fontRequest is a font the conversion has asked for.
+type fontRequest struct {
+	family string
+	weight int
+	italic bool
+}
+
+func (fr fontRequest) String() string {
+	return fmt.Sprintf("%q %d %t", fr.family, fr.weight, fr.italic)
+}
+
+// parseFontRequests reads the font requests written by writeFontRequests.
+func parseFontRequests(data []byte) ([]fontRequest, error) {
+	var requests []fontRequest
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var fr fontRequest
+		if _, err := fmt.Sscanf(line, "%q %d %t", &fr.family, &fr.weight, &fr.italic); err != nil {
+			return nil, err
+		}
+		requests = append(requests, fr)
+	}
+	return requests, nil
+}
+
+// writeFontRequests writes the fonts the conversion has asked for, one per
+// line.
+func (c *converter) writeFontRequests(w io.Writer) error {
+	for _, fr := range c.fontRequests {
+		if _, err := fmt.Fprintln(w, fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fontWeight returns the numeric value of the font-weight property.
+func fontWeight(s string) int {
+	switch s {
+	case "bold", "bolder":
+		return 700
+	case "normal", "lighter":
+		return 400
+	}
+	if w, err := strconv.Atoi(s); err == nil && w >= 1 && w <= 1000 {
+		return w
+	}
+	return 400
+}
+
+// fontFor returns the font of the first family in the font-family property
+// that has a font, nil if there is none.
+func (c *converter) fontFor(st *style) *truetype.Font {
+	if c.fonts == nil {
+		return nil
+	}
+	weight := fontWeight(st.fontWeight)
+	italic := st.fontStyle == "italic" || st.fontStyle == "oblique"
+	for _, family := range strings.Split(st.fontFamily, ",") {
+		family = strings.Trim(strings.TrimSpace(family), `"'`)
+		if family == "" {
+			continue
+		}
+		fr := fontRequest{family: family, weight: weight, italic: italic}
+		if !slices.Contains(c.fontRequests, fr) {
+			c.fontRequests = append(c.fontRequests, fr)
+		}
+		if font, ok := c.fonts.Font(family, weight, italic); ok {
+			return font
+		}
+	}
+	return nil
+}
+
+// shapeRun sets the font, the glyphs and the width of the run. Characters
+// that are not in the font get the glyph 0 of the font.
+func (c *converter) shapeRun(run *textRun) {
+	run.font = c.fontFor(run.st)
+	if run.font == nil {
+		if strings.TrimSpace(run.text) != "" {
+			c.warn("no font for the font family " + run.st.fontFamily + ", the text is left out")
+		}
+		return
+	}
+	advance := 0.0
+	for _, r := range run.text {
+		gid, _ := run.font.NominalGlyph(r)
+		run.glyphs = append(run.glyphs, gid)
+		advance += float64(run.font.HorizontalAdvance(gid))
+	}
+	run.width = advance * run.st.fontSize / float64(run.font.Upem())
+}
+
+// collapseSpace replaces each sequence of white space by a single space.
+func collapseSpace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteRune(r)
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// textRun is a part of a text element with the same style.
+type textRun struct {
+	text string
+	st   *style
+	// absolute position, if given
+	x, y   *float64
+	dx, dy float64
+	// the font is nil if the font family has no font
+	font       *truetype.Font
+	glyphs     []fonts.GID
+	width      float64
+	startChunk bool
+}
+
+// collectRuns collects the text of the element and the tspan children.
+func (c *converter) collectRuns(el *element, st *style, runs []*textRun) []*textRun {
+	first := true
+	for _, child := range el.children {
+		if child.name == "" {
+			text := collapseSpace(child.text)
+			run := &textRun{text: text, st: st}
+			if first {
+				c.runPosition(el, run)
+				first = false
+			}
+			runs = append(runs, run)
+			continue
+		}
+		if child.name != "tspan" {
+			continue
+		}
+		props := c.properties(child)
+		if props["display"] == "none" {
+			continue
+		}
+		cst := c.computeStyle(st, props)
+		start := len(runs)
+		runs = c.collectRuns(child, cst, runs)
+		if first && len(runs) > start {
+			// the position of the parent applies to the first run
+			c.runPosition(el, runs[start])
+			first = false
+		}
+	}
+	return runs
+}
+
+// runPosition sets the position attributes of el on the run, the first values
+// of x, y, dx and dy are used.
+func (c *converter) runPosition(el *element, run *textRun) {
+	if v := numbers(el.attrs["x"]); len(v) > 0 && run.x == nil {
+		run.x = &v[0]
+	}
+	if v := numbers(el.attrs["y"]); len(v) > 0 && run.y == nil {
+		run.y = &v[0]
+	}
+	if v := numbers(el.attrs["dx"]); len(v) > 0 {
+		run.dx += v[0]
+	}
+	if v := numbers(el.attrs["dy"]); len(v) > 0 {
+		run.dy += v[0]
+	}
+}
+
+// text writes a text element.
+func (c *converter) text(el *element, st *style) {
+	runs := c.collectRuns(el, st, nil)
+	// remove white space at the beginning and at the end of the text
+	for len(runs) > 0 && strings.TrimSpace(runs[0].text) == "" && runs[0].x == nil {
+		runs = runs[1:]
+	}
+	if len(runs) == 0 {
+		return
+	}
+	// spaces collapse across the runs
+	prevSpace := true
+	for _, run := range runs {
+		if prevSpace {
+			run.text = strings.TrimPrefix(run.text, " ")
+		}
+		if run.text != "" {
+			prevSpace = strings.HasSuffix(run.text, " ")
+		}
+	}
+	last := runs[len(runs)-1]
+	last.text = strings.TrimSuffix(last.text, " ")
+
+	// a chunk starts at each absolute position, text-anchor applies to chunks
+	var chunkStarts []int
+	for i, run := range runs {
+		c.shapeRun(run)
+		if i == 0 || run.x != nil {
+			run.startChunk = true
+			chunkStarts = append(chunkStarts, i)
+		}
+	}
+	x, y := 0.0, 0.0
+	for ci, start := range chunkStarts {
+		end := len(runs)
+		if ci+1 < len(chunkStarts) {
+			end = chunkStarts[ci+1]
+		}
+		width := 0.0
+		for _, run := range runs[start:end] {
+			width += run.width + run.dx
+		}
+		if runs[start].x != nil {
+			x = *runs[start].x
+		}
+		switch runs[start].st.textAnchor {
+		case "middle":
+			x -= width / 2
+		case "end":
+			x -= width
+		}
+		for _, run := range runs[start:end] {
+			if run.y != nil {
+				y = *run.y
+			}
+			x += run.dx
+			y += run.dy
+			c.textRun(run, x, y)
+			x += run.width
+		}
+	}
+}
+
+// textRun draws the outlines of the glyphs of the run at the position.
+func (c *converter) textRun(run *textRun, x, y float64) {
+	if run.font == nil || strings.TrimSpace(run.text) == "" {
+		return
+	}
+	scale := run.st.fontSize / float64(run.font.Upem())
+	pb := newPathBuilder(identity)
+	for _, gid := range run.glyphs {
+		glyphOutline(pb, run.font, gid, x, y, scale)
+		x += float64(run.font.HorizontalAdvance(gid)) * scale
+	}
+	if len(pb.ops) == 0 {
+		return
+	}
+	c.printf("q")
+	c.paintPath(pb, run.st)
+	c.printf("Q")
+}
+
+// glyphOutline adds the outline of the glyph with the origin at (x, y) to the
+// path. The y axis of the font points upwards.
+func glyphOutline(pb *pathBuilder, font *truetype.Font, gid fonts.GID, x, y, scale float64) {
+	var outline fonts.GlyphOutline
+	switch g := font.GlyphData(gid, 0, 0).(type) {
+	case fonts.GlyphOutline:
+		outline = g
+	case fonts.GlyphSVG:
+		outline = g.Outline
+	default:
+		return
+	}
+	pt := func(p fonts.SegmentPoint) (float64, float64) {
+		return x + float64(p.X)*scale, y - float64(p.Y)*scale
+	}
+	open := false
+	for _, seg := range outline.Segments {
+		switch seg.Op {
+		case fonts.SegmentOpMoveTo:
+			if open {
+				pb.closePath()
+			}
+			pb.moveTo(pt(seg.Args[0]))
+			open = true
+		case fonts.SegmentOpLineTo:
+			pb.lineTo(pt(seg.Args[0]))
+		case fonts.SegmentOpQuadTo:
+			// the quadratic curve as a cubic curve
+			x0, y0 := pb.x, pb.y
+			qx, qy := pt(seg.Args[0])
+			ex, ey := pt(seg.Args[1])
+			pb.curveTo(x0+2*(qx-x0)/3, y0+2*(qy-y0)/3, ex+2*(qx-ex)/3, ey+2*(qy-ey)/3, ex, ey)
+		case fonts.SegmentOpCubeTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			x3, y3 := pt(seg.Args[2])
+			pb.curveTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	if open {
+		pb.closePath()
+	}
+}
@@ -0,0 +1,64 @@
+package svg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boxesandglue/textlayout/fonts/truetype"
+)
+
+// testFonts has no fonts, the IDs are taken from the map.
+type testFonts map[string]string
+
+func (tf testFonts) Font(family string, weight int, italic bool) (*truetype.Font, bool) {
+	return nil, false
+}
+
+func (tf testFonts) ID(family string, weight int, italic bool) string {
+	return tf[family]
+}
+
+func TestFontRequests(t *testing.T) {
+	src := `<svg width="100" height="50">
+		<text font-family="Serif, 'Sans'" font-weight="bold">a</text>
+		<text font-family="Sans" font-weight="bold">b</text>
+		<text font-family="Mono" font-style="italic">c</text>
+	</svg>`
+	fonts := testFonts{"Sans": "sans.ttf"}
+	c, err := convert(strings.NewReader(src), fonts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fontRequest{{"Serif", 700, false}, {"Sans", 700, false}, {"Mono", 400, true}}
+	if !reflect.DeepEqual(c.fontRequests, want) {
+		t.Errorf("font requests %v, want %v", c.fontRequests, want)
+	}
+	var buf bytes.Buffer
+	if err = c.writeFontRequests(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseFontRequests(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed font requests %v, want %v", got, want)
+	}
+
+	sum := []byte("svg")
+	key := cacheKey(sum, want, fonts)
+	if cacheKey(sum, want, testFonts{"Sans": "sans.ttf"}) != key {
+		t.Error("the cache key changes with the same fonts")
+	}
+	if cacheKey(sum, want, testFonts{"Sans": "other.ttf"}) == key {
+		t.Error("the cache key does not change with the font of a requested family")
+	}
+	if cacheKey(sum, want, testFonts{"Sans": "sans.ttf", "Serif": "serif.ttf"}) == key {
+		t.Error("the cache key does not change when a requested family gets a font")
+	}
+	if cacheKey(sum, want, testFonts{"Sans": "sans.ttf", "Other": "other.ttf"}) != key {
+		t.Error("the cache key changes with a font that is not requested")
+	}
+}